@@ -0,0 +1,63 @@
+// Command topical-reply posts an emailed reply read from stdin. Mail servers
+// pipe mail sent to reply addresses into it, e.g. with a Postfix alias.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jkulton/topical/internal/api"
+	"github.com/jkulton/topical/internal/config"
+	"github.com/jkulton/topical/internal/digest"
+	"github.com/jkulton/topical/internal/session"
+	"github.com/jkulton/topical/internal/storage"
+	_ "github.com/lib/pq" // Postgres driver
+	"log"
+	"os"
+)
+
+// Exit codes from sysexits.h, telling the mail server whether to bounce the
+// reply or try delivering it again later
+const (
+	exitDataErr  = 65
+	exitTempFail = 75
+)
+
+func main() {
+	// Grab configuration from flags or ENV, shared with the server. Reply
+	// addresses are checked against the signing key, so it must be set.
+	ac := config.ParseAppConfig()
+
+	if ac.ReplyDomain == "" {
+		log.Fatal("reply-domain: replying by email is disabled")
+	}
+
+	db, err := sql.Open("postgres", ac.DBConnectionURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	store := storage.New(db)
+
+	// The digester only checks reply addresses here, it sends no email
+	digests := digest.New(store, nil, nil, digest.Config{
+		BaseURL:     ac.BaseURL,
+		Key:         []byte(ac.SigningKey),
+		ReplyDomain: ac.ReplyDomain,
+	})
+	// No templates are loaded, ReceiveReply never renders a page
+	a := api.New(nil, store, session.NewCookieSession(session.CookieOptions{}, []byte(ac.SessionKey)), ac, digests)
+
+	if err := a.ReceiveReply(os.Stdin); err != nil {
+		var replyErr *api.ReplyError
+
+		log.Print("Error receiving reply: ", err.Error())
+		db.Close()
+
+		if errors.As(err, &replyErr) {
+			os.Exit(exitDataErr)
+		}
+
+		os.Exit(exitTempFail)
+	}
+}
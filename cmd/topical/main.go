@@ -6,13 +6,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/jkulton/topical/internal/api"
 	"github.com/jkulton/topical/internal/config"
+	"github.com/jkulton/topical/internal/digest"
+	"github.com/jkulton/topical/internal/mailer"
 	"github.com/jkulton/topical/internal/middleware"
 	"github.com/jkulton/topical/internal/session"
 	"github.com/jkulton/topical/internal/storage"
 	"github.com/jkulton/topical/internal/templates"
+	"github.com/jkulton/topical/internal/webhook"
 	_ "github.com/lib/pq" // Postgres driver
 	"log"
 	"net/http"
+	"time"
 )
 
 func main() {
@@ -27,7 +31,8 @@ func main() {
 	defer db.Close()
 
 	// Initialize session, HTML templates, and storage interface
-	session := session.NewSession(ac.SessionKey)
+	session, stopJanitor := newSession(ac, db)
+	defer stopJanitor()
 	templates, err := templates.GenerateTemplates("./web/views/*.gohtml")
 
 	if err != nil {
@@ -36,8 +41,18 @@ func main() {
 
 	storage := storage.New(db)
 
+	// Email digests are sent in the background when an SMTP relay is configured
+	digests, stopDigests := newDigester(ac, storage)
+	defer stopDigests()
+
+	// Webhooks queued as messages are posted are delivered in the background
+	if ac.WebhookInterval > 0 {
+		stopWebhooks := webhook.New(storage, nil, ac.BaseURL).Start(ac.WebhookInterval)
+		defer stopWebhooks()
+	}
+
 	// Create API & router, register routes
-	a := api.New(templates, storage, session)
+	a := api.New(templates, storage, session, ac, digests)
 	r := mux.NewRouter()
 	a.RegisterRoutes(r)
 
@@ -46,6 +61,89 @@ func main() {
 
 	// Middleware Registration
 	r.Use(middleware.RequestLogger)
+	r.Use(middleware.SecurityHeaders(middleware.SecurityOptions{
+		ReportOnly:     ac.CSPReportOnly,
+		ReportURI:      "/csp-report",
+		FrameAncestors: ac.FrameAncestors,
+		HSTSMaxAge:     ac.HSTSMaxAge,
+	}))
+	r.Use(middleware.CSRF(session, "/csp-report", "/digest/unsubscribe"))
 
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", ac.Port), r))
 }
+
+// newSession returns the session configured by session-store, with the
+// configured keys and cookie attributes. Server-side stores start a janitor
+// purging expired sessions, stopped by the returned func.
+func newSession(ac config.AppConfig, db *sql.DB) (*session.Session, func()) {
+	var keyPairs [][]byte
+
+	for _, pair := range ac.SessionKeys {
+		var encryption []byte
+		if pair.Encryption != "" {
+			encryption = []byte(pair.Encryption)
+		}
+
+		keyPairs = append(keyPairs, []byte(pair.Authentication), encryption)
+	}
+
+	sameSite := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}
+
+	cookie := session.CookieOptions{
+		MaxAge:   ac.SessionMaxAge,
+		Domain:   ac.CookieDomain,
+		Secure:   ac.CookieSecure,
+		HTTPOnly: ac.CookieHTTPOnly,
+		SameSite: sameSite[ac.CookieSameSite],
+	}
+
+	var backend session.Backend
+
+	switch ac.SessionStore {
+	case "memory":
+		backend = session.NewMemoryBackend()
+	case "postgres":
+		backend = session.NewPostgresBackend(db)
+	default:
+		return session.NewCookieSession(cookie, keyPairs...), func() {}
+	}
+
+	store := session.NewServerStore(backend, cookie, ac.SessionIdleTimeout, keyPairs...)
+	stop := store.StartJanitor(10 * time.Minute)
+
+	return session.NewStoreSession(store), stop
+}
+
+// newDigester returns a digester sending email digests through the
+// configured SMTP relay every digest-interval, stopped by the returned func.
+// Digests are disabled, returning nil, if no relay is configured.
+func newDigester(ac config.AppConfig, store *storage.Storage) (*digest.Digester, func()) {
+	if ac.SMTPAddr == "" {
+		return nil, func() {}
+	}
+
+	emails, err := templates.GenerateEmailTemplates("./web/emails/*.tmpl")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m := mailer.New(mailer.Config{
+		Addr:     ac.SMTPAddr,
+		Username: ac.SMTPUsername,
+		Password: ac.SMTPPassword,
+		From:     ac.SMTPFrom,
+	})
+
+	d := digest.New(store, m, emails, digest.Config{
+		BaseURL:     ac.BaseURL,
+		Key:         []byte(ac.SigningKey),
+		ReplyDomain: ac.ReplyDomain,
+	})
+
+	return d, d.Start(ac.DigestInterval)
+}
@@ -4,9 +4,11 @@ go 1.14
 
 require (
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.1
 	github.com/lib/pq v1.10.0
 	github.com/microcosm-cc/bluemonday v1.0.16
 	github.com/testcontainers/testcontainers-go v0.10.0
 	github.com/yuin/goldmark v1.3.2
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 )
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// honeypotField names a form field hidden from people, so only bots fill it in
+const honeypotField = "website"
+
+// challengeFailedFlash is shown when a protected form fails the anti-bot check
+const challengeFailedFlash = "Your browser didn't pass our anti-bot check, please try again with JavaScript enabled"
+
+var errHoneypot = errors.New("honeypot field filled in")
+
+// challengeForm is the proof-of-work challenge rendered into a protected form
+type challengeForm struct {
+	Token      string
+	Difficulty int
+}
+
+// newChallenge issues a challenge for a protected form, or nil if challenges are disabled
+func (api *TopicalAPI) newChallenge() (*challengeForm, error) {
+	if api.challenger == nil {
+		return nil, nil
+	}
+
+	token, err := api.challenger.Issue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &challengeForm{token, api.challenger.Difficulty}, nil
+}
+
+// checkChallenge verifies the honeypot and challenge solution posted with a
+// protected form, always passing if challenges are disabled
+func (api *TopicalAPI) checkChallenge(r *http.Request) error {
+	if api.challenger == nil {
+		return nil
+	}
+
+	if r.FormValue(honeypotField) != "" {
+		return errHoneypot
+	}
+
+	return api.challenger.Verify(r.FormValue("challenge"), r.FormValue("challenge_solution"))
+}
@@ -2,34 +2,122 @@ package api
 
 import (
 	"html/template"
+	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/challenge"
+	"github.com/jkulton/topical/internal/config"
+	"github.com/jkulton/topical/internal/digest"
+	"github.com/jkulton/topical/internal/filter"
+	"github.com/jkulton/topical/internal/middleware"
+	"github.com/jkulton/topical/internal/oidc"
 	"github.com/jkulton/topical/internal/session"
 	"github.com/jkulton/topical/internal/storage"
 )
 
 // TopicalAPI represents an API instance, with internal state for
-// templates, storage, and session used by handlers.
+// templates, storage, session, app config, content filter, anti-bot
+// challenger, single sign-on provider, and email digester used by handlers.
+// challenger, oidc, and digests are nil when their features are disabled.
 type TopicalAPI struct {
-	templates *template.Template
-	storage   storage.TopicalStore
-	session   session.TopicalSession
+	templates  *template.Template
+	storage    storage.TopicalStore
+	session    session.TopicalSession
+	config     config.AppConfig
+	filter     *filter.Policy
+	challenger *challenge.Challenger
+	oidc       *oidc.Provider
+	digests    *digest.Digester
 }
 
-// New returns a new TopicalAPI instance
-func New(templates *template.Template, storage storage.TopicalStore, session session.TopicalSession) *TopicalAPI {
-	return &TopicalAPI{templates, storage, session}
+// New returns a new TopicalAPI instance, digests may be nil to disable email digests
+func New(templates *template.Template, storage storage.TopicalStore, session session.TopicalSession, config config.AppConfig, digests *digest.Digester) *TopicalAPI {
+	filterAction := filter.Reject
+	if config.FilterAction == "hold" {
+		filterAction = filter.Hold
+	}
+
+	f := filter.New(config.BannedTerms, config.DisallowedDomains, config.MaxLinks, config.MaxMessageLength, filterAction)
+
+	var c *challenge.Challenger
+	if config.Challenge {
+		c = challenge.New([]byte(config.SigningKey), config.ChallengeDifficulty, 10*time.Minute)
+	}
+
+	var p *oidc.Provider
+	if config.OIDCIssuer != "" {
+		p = oidc.New(oidc.Config{
+			Issuer:       config.OIDCIssuer,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+		})
+	}
+
+	return &TopicalAPI{templates, storage, session, config, f, c, p, digests}
 }
 
 // RegisterRoutes registers handler functions defined in this package on a router instance
 func (t *TopicalAPI) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/topics", t.TopicCreate).Methods("POST")
+	topicLimit := t.rateLimit(t.config.TopicRateLimit)
+	messageLimit := t.rateLimit(t.config.MessageRateLimit)
+	joinLimit := t.rateLimit(t.config.JoinRateLimit)
+
+	r.Handle("/topics", topicLimit(http.HandlerFunc(t.TopicCreate))).Methods("POST")
 	r.HandleFunc("/topics/new", t.TopicNew).Methods("GET")
-	r.HandleFunc("/topics/{id:[0-9]+}/messages", t.MessageCreate).Methods("POST")
+	r.Handle("/topics/{id:[0-9]+}/messages", messageLimit(http.HandlerFunc(t.MessageCreate))).Methods("POST")
+	r.HandleFunc("/topics/{id:[0-9]+}/subscription", t.SubscriptionUpdate).Methods("POST")
+	r.HandleFunc("/topics/{id:[0-9]+}/poll", t.PollUpdate).Methods("POST")
+	r.HandleFunc("/topics/{id:[0-9]+}/poll/votes", t.VoteCreate).Methods("POST")
+	r.HandleFunc("/topics/{id:[0-9]+}/messages/{messageID:[0-9]+}/report", t.ReportNew).Methods("GET")
+	r.HandleFunc("/topics/{id:[0-9]+}/messages/{messageID:[0-9]+}/reports", t.ReportCreate).Methods("POST")
+	r.HandleFunc("/topics/{id:[0-9]+}/messages/{messageID:[0-9]+}/reactions", t.ReactionUpdate).Methods("POST")
 	r.HandleFunc("/join", t.JoinShow).Methods("GET")
-	r.HandleFunc("/join", t.JoinCreate).Methods("POST")
+	r.Handle("/join", joinLimit(http.HandlerFunc(t.JoinCreate))).Methods("POST")
+	r.HandleFunc("/register", t.RegisterShow).Methods("GET")
+	r.Handle("/register", joinLimit(http.HandlerFunc(t.RegisterCreate))).Methods("POST")
+	r.HandleFunc("/login", t.LoginShow).Methods("GET")
+	r.Handle("/login", joinLimit(http.HandlerFunc(t.LoginCreate))).Methods("POST")
+	r.HandleFunc("/logout", t.LogoutCreate).Methods("POST")
+	r.HandleFunc("/logout/everywhere", t.LogoutEverywhereCreate).Methods("POST")
+	r.HandleFunc("/notifications", t.NotificationList).Methods("GET")
+	r.HandleFunc("/settings", t.SettingsShow).Methods("GET")
+	r.HandleFunc("/settings", t.SettingsUpdate).Methods("POST")
+	r.Handle("/settings/digest", joinLimit(http.HandlerFunc(t.DigestUpdate))).Methods("POST")
+	r.HandleFunc("/digest/confirm", t.DigestConfirm).Methods("GET")
+	r.HandleFunc("/digest/unsubscribe", t.DigestUnsubscribeShow).Methods("GET")
+	r.HandleFunc("/digest/unsubscribe", t.DigestUnsubscribeCreate).Methods("POST")
+	r.HandleFunc("/settings/data/export", t.DataExport).Methods("GET")
+	r.HandleFunc("/settings/data/erase", t.DataEraseShow).Methods("GET")
+	r.HandleFunc("/settings/data/erase", t.DataEraseCreate).Methods("POST")
+	r.HandleFunc("/auth/oidc/login", t.OIDCLogin).Methods("GET")
+	r.HandleFunc("/auth/oidc/callback", t.OIDCCallback).Methods("GET")
+	r.HandleFunc("/moderation/login", t.ModerationLoginShow).Methods("GET")
+	r.Handle("/moderation/login", joinLimit(http.HandlerFunc(t.ModerationLoginCreate))).Methods("POST")
+	r.HandleFunc("/moderation/reports", t.ReportList).Methods("GET")
+	r.HandleFunc("/moderation/reports/{id:[0-9]+}", t.ReportUpdate).Methods("POST")
+	r.HandleFunc("/moderation/pending", t.PendingList).Methods("GET")
+	r.HandleFunc("/moderation/pending/{id:[0-9]+}", t.PendingUpdate).Methods("POST")
+	r.HandleFunc("/moderation/webhooks", t.WebhookList).Methods("GET")
+	r.HandleFunc("/moderation/webhooks", t.WebhookCreate).Methods("POST")
+	r.HandleFunc("/moderation/webhooks/{id:[0-9]+}", t.WebhookUpdate).Methods("POST")
+	r.HandleFunc("/moderation/webhooks/deliveries/{id:[0-9]+}", t.WebhookDeliveryUpdate).Methods("POST")
+	r.HandleFunc("/csp-report", t.CSPReportCreate).Methods("POST")
 	r.HandleFunc("/", t.TopicList).Methods("GET")
 	r.HandleFunc("/topics", t.TopicList).Methods("GET")
 	r.HandleFunc("/topics/", t.TopicList).Methods("GET")
 	r.HandleFunc("/topics/{id:[0-9]+}", t.TopicShow).Methods("GET")
+	r.HandleFunc("/topics/{id:[0-9]+}/unread", t.TopicUnread).Methods("GET")
+	r.HandleFunc("/u/{initials:[A-Za-z]{2}}", t.ProfileShow).Methods("GET")
+	r.HandleFunc("/u/{initials:[A-Za-z]{2}}-{theme:[0-9]+}", t.ProfileShow).Methods("GET")
+}
+
+// rateLimit returns middleware enforcing the given limit, or a no-op if the limit is disabled
+func (t *TopicalAPI) rateLimit(limit config.RateLimit) mux.MiddlewareFunc {
+	if limit.Requests == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return middleware.NewRateLimiter(limit.Requests, limit.Per, t.session, t.config.TrustedProxies, t.RateLimited).Limit
 }
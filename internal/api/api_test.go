@@ -1,31 +1,93 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/challenge"
+	"github.com/jkulton/topical/internal/config"
+	"github.com/jkulton/topical/internal/digest"
+	"github.com/jkulton/topical/internal/mailer"
+	"github.com/jkulton/topical/internal/mailer/mailertest"
+	"github.com/jkulton/topical/internal/middleware"
 	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/oidc"
+	"github.com/jkulton/topical/internal/oidc/oidctest"
 	"github.com/jkulton/topical/internal/session"
+	"github.com/jkulton/topical/internal/storage"
 	"github.com/jkulton/topical/internal/templates"
+	"golang.org/x/crypto/bcrypt"
 	"html/template"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 type MockStorage struct {
-	GetTopicFunc        func(id int) (*models.Topic, error)
-	GetRecentTopicsFunc func() ([]models.Topic, error)
-	CreateMessageFunc   func(m *models.Message) (*models.Message, error)
-	CreateTopicFunc     func(title string) (*models.Topic, error)
+	GetTopicFunc          func(id int, v storage.Viewer) (*models.Topic, error)
+	GetMessageFunc        func(id int, v storage.Viewer) (*models.Message, error)
+	GetRecentTopicsFunc   func(v storage.Viewer) ([]models.Topic, error)
+	CreateMessageFunc     func(m *models.Message) (*models.Message, error)
+	CreateTopicFunc       func(title string) (*models.Topic, error)
+	CreateReportFunc      func(r *models.Report) (*models.Report, error)
+	GetOpenReportsFunc    func() ([]models.Report, error)
+	ResolveReportFunc     func(id int, status string, hideMessage bool) error
+	ApproveReportFunc     func(id int) error
+	HasApprovedFunc       func(authorKey string) (bool, error)
+	GetPendingFunc        func() ([]models.Message, error)
+	SetMessageStatusFunc  func(id int, status string) error
+	CreateUserFunc        func(u *models.User, passwordHash string) (*models.User, error)
+	GetUserFunc           func(id int) (*models.User, error)
+	GetCredentialsFunc    func(handle string) (*models.User, string, error)
+	GetExternalUserFunc   func(externalID string, u *models.User) (*models.User, error)
+	GetAuthorFunc         func(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error)
+	GetByAuthorKeyFunc    func(authorKey string) ([]models.Message, error)
+	CountByAuthorKeyFunc  func(authorKey string) (int, error)
+	EraseByAuthorKeyFunc  func(authorKey string, anonymize bool) (int, error)
+	GetLastReadFunc       func(readerKey string, topicID int) (int, error)
+	MarkReadFunc          func(readerKey string, topicID int, messageID int) error
+	SubscribeFunc         func(subscriberKey string, topicID int) error
+	UnsubscribeFunc       func(subscriberKey string, topicID int) error
+	IsSubscribedFunc      func(subscriberKey string, topicID int) (bool, error)
+	GetNotificationsFunc  func(recipientKey string, limit int) ([]models.Notification, error)
+	CountUnreadFunc       func(recipientKey string) (int, error)
+	MarkAllReadFunc       func(recipientKey string) error
+	SaveDigestFunc        func(d *models.Digest) (*models.Digest, error)
+	GetDigestFunc         func(recipientKey string) (*models.Digest, error)
+	ClaimConfirmationFunc func(recipientKey string, interval time.Duration) (bool, error)
+	ConfirmDigestFunc     func(recipientKey string, email string) (bool, error)
+	DeleteDigestFunc      func(recipientKey string) error
+	GetDigestsByEmailFunc func(email string) ([]models.Digest, error)
+	GetLatestAuthorFunc   func(authorKey string) (*models.Message, error)
+	CreateWebhookFunc     func(w *models.Webhook) (*models.Webhook, error)
+	GetWebhooksFunc       func() ([]models.Webhook, error)
+	DeleteWebhookFunc     func(id int) error
+	GetDeliveriesFunc     func(limit int) ([]models.WebhookDelivery, error)
+	RetryDeliveryFunc     func(id int) error
+	ToggleReactionFunc    func(messageID int, reactorKey string, emoji string) error
+	GetReactionsFunc      func(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error)
+	CreatePollFunc        func(p *models.Poll) (*models.Poll, error)
+	GetPollFunc           func(topicID int, v storage.Viewer) (*models.Poll, error)
+	VoteFunc              func(pollID int, voterKey string, optionIDs []int) error
+	SetPollClosedFunc     func(pollID int, closed bool) error
 }
 
-func (s *MockStorage) GetTopic(id int) (*models.Topic, error) {
-	return s.GetTopicFunc(id)
+func (s *MockStorage) GetTopic(id int, v storage.Viewer) (*models.Topic, error) {
+	return s.GetTopicFunc(id, v)
 }
 
-func (s *MockStorage) GetRecentTopics() ([]models.Topic, error) {
-	return s.GetRecentTopicsFunc()
+func (s *MockStorage) GetMessage(id int, v storage.Viewer) (*models.Message, error) {
+	return s.GetMessageFunc(id, v)
+}
+
+func (s *MockStorage) GetRecentTopics(v storage.Viewer) ([]models.Topic, error) {
+	return s.GetRecentTopicsFunc(v)
 }
 
 func (s *MockStorage) CreateMessage(m *models.Message) (*models.Message, error) {
@@ -36,10 +98,175 @@ func (s *MockStorage) CreateTopic(title string) (*models.Topic, error) {
 	return s.CreateTopicFunc(title)
 }
 
+func (s *MockStorage) CreateReport(r *models.Report) (*models.Report, error) {
+	return s.CreateReportFunc(r)
+}
+
+func (s *MockStorage) GetOpenReports() ([]models.Report, error) {
+	return s.GetOpenReportsFunc()
+}
+
+func (s *MockStorage) ResolveReport(id int, status string, hideMessage bool) error {
+	return s.ResolveReportFunc(id, status, hideMessage)
+}
+
+func (s *MockStorage) ApproveReport(id int) error {
+	return s.ApproveReportFunc(id)
+}
+
+func (s *MockStorage) HasApprovedMessage(authorKey string) (bool, error) {
+	return s.HasApprovedFunc(authorKey)
+}
+
+func (s *MockStorage) GetPendingMessages() ([]models.Message, error) {
+	return s.GetPendingFunc()
+}
+
+func (s *MockStorage) SetMessageStatus(id int, status string) error {
+	return s.SetMessageStatusFunc(id, status)
+}
+
+func (s *MockStorage) CreateUser(u *models.User, passwordHash string) (*models.User, error) {
+	return s.CreateUserFunc(u, passwordHash)
+}
+
+func (s *MockStorage) GetUser(id int) (*models.User, error) {
+	return s.GetUserFunc(id)
+}
+
+func (s *MockStorage) GetUserCredentials(handle string) (*models.User, string, error) {
+	return s.GetCredentialsFunc(handle)
+}
+
+func (s *MockStorage) GetOrCreateExternalUser(externalID string, u *models.User) (*models.User, error) {
+	return s.GetExternalUserFunc(externalID, u)
+}
+
+func (s *MockStorage) GetAuthorMessages(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error) {
+	return s.GetAuthorFunc(initials, theme, limit, offset, v)
+}
+
+func (s *MockStorage) GetMessagesByAuthorKey(authorKey string) ([]models.Message, error) {
+	return s.GetByAuthorKeyFunc(authorKey)
+}
+
+func (s *MockStorage) CountMessagesByAuthorKey(authorKey string) (int, error) {
+	return s.CountByAuthorKeyFunc(authorKey)
+}
+
+func (s *MockStorage) EraseMessagesByAuthorKey(authorKey string, anonymize bool) (int, error) {
+	return s.EraseByAuthorKeyFunc(authorKey, anonymize)
+}
+
+func (s *MockStorage) GetLastRead(readerKey string, topicID int) (int, error) {
+	return s.GetLastReadFunc(readerKey, topicID)
+}
+
+func (s *MockStorage) MarkRead(readerKey string, topicID int, messageID int) error {
+	return s.MarkReadFunc(readerKey, topicID, messageID)
+}
+
+func (s *MockStorage) Subscribe(subscriberKey string, topicID int) error {
+	return s.SubscribeFunc(subscriberKey, topicID)
+}
+
+func (s *MockStorage) Unsubscribe(subscriberKey string, topicID int) error {
+	return s.UnsubscribeFunc(subscriberKey, topicID)
+}
+
+func (s *MockStorage) IsSubscribed(subscriberKey string, topicID int) (bool, error) {
+	return s.IsSubscribedFunc(subscriberKey, topicID)
+}
+
+func (s *MockStorage) GetNotifications(recipientKey string, limit int) ([]models.Notification, error) {
+	return s.GetNotificationsFunc(recipientKey, limit)
+}
+
+func (s *MockStorage) CountUnreadNotifications(recipientKey string) (int, error) {
+	return s.CountUnreadFunc(recipientKey)
+}
+
+func (s *MockStorage) MarkNotificationsRead(recipientKey string) error {
+	return s.MarkAllReadFunc(recipientKey)
+}
+
+func (s *MockStorage) SaveDigest(d *models.Digest) (*models.Digest, error) {
+	return s.SaveDigestFunc(d)
+}
+
+func (s *MockStorage) GetDigest(recipientKey string) (*models.Digest, error) {
+	return s.GetDigestFunc(recipientKey)
+}
+
+func (s *MockStorage) ClaimDigestConfirmation(recipientKey string, interval time.Duration) (bool, error) {
+	return s.ClaimConfirmationFunc(recipientKey, interval)
+}
+
+func (s *MockStorage) ConfirmDigest(recipientKey string, email string) (bool, error) {
+	return s.ConfirmDigestFunc(recipientKey, email)
+}
+
+func (s *MockStorage) DeleteDigest(recipientKey string) error {
+	return s.DeleteDigestFunc(recipientKey)
+}
+
+func (s *MockStorage) GetConfirmedDigestsByEmail(email string) ([]models.Digest, error) {
+	return s.GetDigestsByEmailFunc(email)
+}
+
+func (s *MockStorage) GetLatestAuthorMessage(authorKey string) (*models.Message, error) {
+	return s.GetLatestAuthorFunc(authorKey)
+}
+
+func (s *MockStorage) CreateWebhook(w *models.Webhook) (*models.Webhook, error) {
+	return s.CreateWebhookFunc(w)
+}
+
+func (s *MockStorage) GetWebhooks() ([]models.Webhook, error) {
+	return s.GetWebhooksFunc()
+}
+
+func (s *MockStorage) DeleteWebhook(id int) error {
+	return s.DeleteWebhookFunc(id)
+}
+
+func (s *MockStorage) GetWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	return s.GetDeliveriesFunc(limit)
+}
+
+func (s *MockStorage) RetryWebhookDelivery(id int) error {
+	return s.RetryDeliveryFunc(id)
+}
+
+func (s *MockStorage) ToggleReaction(messageID int, reactorKey string, emoji string) error {
+	return s.ToggleReactionFunc(messageID, reactorKey, emoji)
+}
+
+func (s *MockStorage) GetReactions(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error) {
+	return s.GetReactionsFunc(messageIDs, reactorKey)
+}
+
+func (s *MockStorage) CreatePoll(p *models.Poll) (*models.Poll, error) {
+	return s.CreatePollFunc(p)
+}
+
+func (s *MockStorage) GetPoll(topicID int, v storage.Viewer) (*models.Poll, error) {
+	return s.GetPollFunc(topicID, v)
+}
+
+func (s *MockStorage) Vote(pollID int, voterKey string, optionIDs []int) error {
+	return s.VoteFunc(pollID, voterKey, optionIDs)
+}
+
+func (s *MockStorage) SetPollClosed(pollID int, closed bool) error {
+	return s.SetPollClosedFunc(pollID, closed)
+}
+
 var (
 	testSession   *session.Session
 	testTemplates *template.Template
 	testStorage   MockStorage
+	testConfig    config.AppConfig
 	api           TopicalAPI
 )
 
@@ -47,10 +274,13 @@ func setupTests() {
 	testSession = session.NewSession("test")
 	testTemplates, _ = templates.GenerateTemplates("../../web/views/*.gohtml")
 	testStorage = MockStorage{
-		GetTopicFunc: func(id int) (*models.Topic, error) {
-			return &models.Topic{ID: &id, Title: "First Title"}, nil
+		GetTopicFunc: func(id int, v storage.Viewer) (*models.Topic, error) {
+			return &models.Topic{ID: &id, Title: "First Title", Messages: &[]models.Message{}}, nil
 		},
-		GetRecentTopicsFunc: func() ([]models.Topic, error) {
+		GetMessageFunc: func(id int, v storage.Viewer) (*models.Message, error) {
+			return nil, storage.ErrMessageNotFound
+		},
+		GetRecentTopicsFunc: func(v storage.Viewer) ([]models.Topic, error) {
 			return []models.Topic{}, nil
 		},
 		CreateMessageFunc: func(m *models.Message) (*models.Message, error) {
@@ -59,9 +289,144 @@ func setupTests() {
 		CreateTopicFunc: func(title string) (*models.Topic, error) {
 			return nil, nil
 		},
+		CreateReportFunc: func(r *models.Report) (*models.Report, error) {
+			return r, nil
+		},
+		GetOpenReportsFunc: func() ([]models.Report, error) {
+			return []models.Report{}, nil
+		},
+		ResolveReportFunc: func(id int, status string, hideMessage bool) error {
+			return nil
+		},
+		ApproveReportFunc: func(id int) error {
+			return nil
+		},
+		HasApprovedFunc: func(authorKey string) (bool, error) {
+			return true, nil
+		},
+		GetPendingFunc: func() ([]models.Message, error) {
+			return []models.Message{}, nil
+		},
+		SetMessageStatusFunc: func(id int, status string) error {
+			return nil
+		},
+		CreateUserFunc: func(u *models.User, passwordHash string) (*models.User, error) {
+			id := 1
+			u.ID = &id
+			return u, nil
+		},
+		GetUserFunc: func(id int) (*models.User, error) {
+			return &models.User{ID: &id, Handle: "jon", Initials: "JK", Theme: 3}, nil
+		},
+		GetCredentialsFunc: func(handle string) (*models.User, string, error) {
+			return nil, "", storage.ErrUserNotFound
+		},
+		GetExternalUserFunc: func(externalID string, u *models.User) (*models.User, error) {
+			id := 1
+			u.ID = &id
+			return u, nil
+		},
+		GetAuthorFunc: func(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error) {
+			return []models.Message{}, nil
+		},
+		GetByAuthorKeyFunc: func(authorKey string) ([]models.Message, error) {
+			return []models.Message{}, nil
+		},
+		CountByAuthorKeyFunc: func(authorKey string) (int, error) {
+			return 0, nil
+		},
+		EraseByAuthorKeyFunc: func(authorKey string, anonymize bool) (int, error) {
+			return 0, nil
+		},
+		GetLastReadFunc: func(readerKey string, topicID int) (int, error) {
+			return 0, nil
+		},
+		MarkReadFunc: func(readerKey string, topicID int, messageID int) error {
+			return nil
+		},
+		SubscribeFunc: func(subscriberKey string, topicID int) error {
+			return nil
+		},
+		UnsubscribeFunc: func(subscriberKey string, topicID int) error {
+			return nil
+		},
+		IsSubscribedFunc: func(subscriberKey string, topicID int) (bool, error) {
+			return false, nil
+		},
+		GetNotificationsFunc: func(recipientKey string, limit int) ([]models.Notification, error) {
+			return []models.Notification{}, nil
+		},
+		CountUnreadFunc: func(recipientKey string) (int, error) {
+			return 0, nil
+		},
+		MarkAllReadFunc: func(recipientKey string) error {
+			return nil
+		},
+		SaveDigestFunc: func(d *models.Digest) (*models.Digest, error) {
+			return d, nil
+		},
+		GetDigestFunc: func(recipientKey string) (*models.Digest, error) {
+			return nil, nil
+		},
+		ClaimConfirmationFunc: func(recipientKey string, interval time.Duration) (bool, error) {
+			return true, nil
+		},
+		ConfirmDigestFunc: func(recipientKey string, email string) (bool, error) {
+			return true, nil
+		},
+		DeleteDigestFunc: func(recipientKey string) error {
+			return nil
+		},
+		GetDigestsByEmailFunc: func(email string) ([]models.Digest, error) {
+			return []models.Digest{}, nil
+		},
+		GetLatestAuthorFunc: func(authorKey string) (*models.Message, error) {
+			return nil, storage.ErrAuthorNotFound
+		},
+		CreateWebhookFunc: func(w *models.Webhook) (*models.Webhook, error) {
+			return w, nil
+		},
+		GetWebhooksFunc: func() ([]models.Webhook, error) {
+			return []models.Webhook{}, nil
+		},
+		DeleteWebhookFunc: func(id int) error {
+			return nil
+		},
+		GetDeliveriesFunc: func(limit int) ([]models.WebhookDelivery, error) {
+			return []models.WebhookDelivery{}, nil
+		},
+		RetryDeliveryFunc: func(id int) error {
+			return nil
+		},
+		ToggleReactionFunc: func(messageID int, reactorKey string, emoji string) error {
+			return nil
+		},
+		GetReactionsFunc: func(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error) {
+			return map[int][]models.Reaction{}, nil
+		},
+		CreatePollFunc: func(p *models.Poll) (*models.Poll, error) {
+			return p, nil
+		},
+		GetPollFunc: func(topicID int, v storage.Viewer) (*models.Poll, error) {
+			return nil, nil
+		},
+		VoteFunc: func(pollID int, voterKey string, optionIDs []int) error {
+			return nil
+		},
+		SetPollClosedFunc: func(pollID int, closed bool) error {
+			return nil
+		},
+	}
+	testConfig = config.AppConfig{
+		ModeratorKey:     "mod_key",
+		BannedTerms:      []string{"casino"},
+		MaxMessageLength: 100,
+		FilterAction:     "hold",
+		Anonymous:        true,
+		Reactions:        []string{"👍", "🎉"},
 	}
 
-	api = TopicalAPI{testTemplates, &testStorage, testSession}
+	api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
 }
 
 func assertRedirect(location string, t *testing.T, res *httptest.ResponseRecorder) {
@@ -84,7 +449,7 @@ func TestTopicShow(t *testing.T) {
 		vars := map[string]string{"id": "12"}
 		req = mux.SetURLVars(req, vars)
 
-		testStorage.GetTopicFunc = func(id int) (*models.Topic, error) {
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
 			return &models.Topic{}, nil
 		}
 
@@ -114,7 +479,7 @@ func TestTopicShow(t *testing.T) {
 		vars := map[string]string{"id": "12"}
 		req = mux.SetURLVars(req, vars)
 
-		testStorage.GetTopicFunc = func(id int) (*models.Topic, error) {
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
 			return nil, errors.New("get topic error")
 		}
 
@@ -125,6 +490,31 @@ func TestTopicShow(t *testing.T) {
 		}
 	})
 
+	t.Run("shows pending messages to moderators", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "12"})
+		api.session.SetModerator(true, req, res)
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		var viewer storage.Viewer
+
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+			viewer = v
+			return &models.Topic{ID: &id, Title: "First Title", Messages: &[]models.Message{{ID: &id, Status: "pending"}}}, nil
+		}
+
+		api.TopicShow(res, req)
+
+		if viewer.Moderator == false || viewer.ReaderKey == "" {
+			t.Error("topic should be fetched for a moderator viewer with an author key")
+		}
+
+		if strings.Contains(res.Body.String(), "awaiting approval") == false {
+			t.Error("response body should mark pending messages")
+		}
+	})
+
 	t.Run("renders topic successfully", func(t *testing.T) {
 		setupTests()
 		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
@@ -164,7 +554,7 @@ func TestTopicList(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
 		res := httptest.NewRecorder()
 
-		testStorage.GetRecentTopicsFunc = func() ([]models.Topic, error) {
+		testStorage.GetRecentTopicsFunc = func(v storage.Viewer) ([]models.Topic, error) {
 			return nil, errors.New("get recent topics error")
 		}
 
@@ -180,7 +570,7 @@ func TestTopicList(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
 		res := httptest.NewRecorder()
 
-		testStorage.GetRecentTopicsFunc = func() ([]models.Topic, error) {
+		testStorage.GetRecentTopicsFunc = func(v storage.Viewer) ([]models.Topic, error) {
 			return []models.Topic{{Title: "First list title"}, {Title: "Second list title"}}, nil
 		}
 
@@ -196,6 +586,192 @@ func TestTopicList(t *testing.T) {
 	})
 }
 
+func TestQuoting(t *testing.T) {
+	quoted := func(id int, v storage.Viewer) (*models.Message, error) {
+		topicID := 3
+
+		if id == 8 {
+			topicID = 4
+		}
+
+		return &models.Message{ID: &id, TopicID: &topicID, AuthorInitials: "JK", Content: "First line\r\n\nsecond line"}, nil
+	}
+
+	t.Run("starts the reply quoting a message in the topic", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/3?quote=7", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		testStorage.GetMessageFunc = quoted
+
+		api.TopicShow(res, req)
+		body := res.Body.String()
+
+		for _, want := range []string{
+			"[JK wrote](/topics/3#message-7):\n\n&gt; First line\n&gt;\n&gt; second line\n\n</textarea>",
+			`name="reply_to" value="7"`,
+			"Replying to JK",
+		} {
+			if strings.Contains(body, want) == false {
+				t.Errorf("response body should include %q", want)
+			}
+		}
+	})
+
+	t.Run("ignores quotes of messages in other topics", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/3?quote=8", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		testStorage.GetMessageFunc = quoted
+
+		api.TopicShow(res, req)
+
+		if strings.Contains(res.Body.String(), "reply_to") {
+			t.Error("response body should not quote the message")
+		}
+	})
+
+	t.Run("links replies to the message they refer to", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/3", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		firstID, secondID := 7, 9
+
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+			return &models.Topic{ID: &id, Title: "Quoted", Messages: &[]models.Message{
+				{ID: &firstID, AuthorInitials: "JK", Content: "first"},
+				{ID: &secondID, AuthorInitials: "AK", Content: "second", ReplyToID: &firstID, ReplyToInitials: "JK"},
+			}}, nil
+		}
+
+		api.TopicShow(res, req)
+
+		if strings.Contains(res.Body.String(), `<a class="message-reply-to" href="#message-7">in reply to JK</a>`) == false {
+			t.Error("response body should link the reply to the message it refers to")
+		}
+	})
+
+	t.Run("saves the message a reply refers to", func(t *testing.T) {
+		for replyTo, want := range map[string]int{"7": 7, "8": 0, "abc": 0} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=Agreed&reply_to="+replyTo, nil)
+			res := httptest.NewRecorder()
+			api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+			req = mux.SetURLVars(req, map[string]string{"id": "3"})
+			testStorage.GetMessageFunc = quoted
+			var saved *models.Message
+
+			testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+				saved = m
+				return m, nil
+			}
+
+			api.MessageCreate(res, req)
+
+			got := 0
+
+			if saved != nil && saved.ReplyToID != nil {
+				got = *saved.ReplyToID
+			}
+
+			if got != want {
+				t.Errorf("reply_to %s: got reply to %d but wanted %d", replyTo, got, want)
+			}
+		}
+	})
+}
+
+func TestThreads(t *testing.T) {
+	// chain returns n messages each replying to the one before, after a
+	// message replying to one which isn't shown
+	chain := func(n int) []models.Message {
+		hidden := 99
+		messages := []models.Message{{ID: new(int), ReplyToID: &hidden}}
+
+		for i := 1; i <= n; i++ {
+			id, parent := i, i-1
+			messages = append(messages, models.Message{ID: &id, ReplyToID: &parent})
+		}
+
+		return messages
+	}
+
+	t.Run("nests replies under the messages they reply to", func(t *testing.T) {
+		got := threads(&topicView{}, chain(2), true)
+
+		if len(got) != 1 || len(got[0].Replies) != 1 || *got[0].Replies[0].Replies[0].ID != 2 {
+			t.Errorf("unexpected threads %+v", got)
+		}
+	})
+
+	t.Run("keeps replies past the deepest level alongside their parent", func(t *testing.T) {
+		got := threads(&topicView{}, chain(maxThreadDepth+2), true)
+		deepest := got[0]
+
+		for i := 1; i < maxThreadDepth; i++ {
+			deepest = deepest.Replies[0]
+		}
+
+		if len(deepest.Replies) != 3 || len(deepest.Replies[0].Replies) != 0 {
+			t.Errorf("got %d replies at the deepest level but wanted 3", len(deepest.Replies))
+		}
+	})
+
+	t.Run("lists messages flat unless nested", func(t *testing.T) {
+		if got := threads(&topicView{}, chain(3), false); len(got) != 4 || len(got[0].Replies) != 0 {
+			t.Errorf("unexpected threads %+v", got)
+		}
+	})
+
+	t.Run("renders reply trees in the threaded view", func(t *testing.T) {
+		for view, want := range map[string]bool{"": false, "threaded": true} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodGet, "/topics/3?view="+view, nil)
+			res := httptest.NewRecorder()
+			req = mux.SetURLVars(req, map[string]string{"id": "3"})
+			firstID, secondID := 7, 9
+
+			testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+				return &models.Topic{ID: &id, Title: "Threaded", Messages: &[]models.Message{
+					{ID: &firstID, AuthorInitials: "JK", Content: "first"},
+					{ID: &secondID, AuthorInitials: "AK", Content: "second", ReplyToID: &firstID, ReplyToInitials: "JK"},
+				}}, nil
+			}
+
+			api.TopicShow(res, req)
+			body := res.Body.String()
+
+			if got := strings.Contains(body, `<details class="thread-replies" open>`); got != want {
+				t.Errorf("view %q: got reply tree %v but wanted %v", view, got, want)
+			}
+
+			if strings.Contains(body, `id="message-9"`) == false {
+				t.Errorf("view %q: response body should include every message", view)
+			}
+		}
+	})
+
+	t.Run("returns to the threaded view after replying", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=Agreed&view=threaded", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			return m, nil
+		}
+
+		api.MessageCreate(res, req)
+
+		assertRedirect("/topics/3?view=threaded", t, res)
+	})
+}
+
 func TestMessageCreate(t *testing.T) {
 	t.Run("responds with 302 to dashboard if user not logged in", func(t *testing.T) {
 		setupTests()
@@ -239,52 +815,158 @@ func TestMessageCreate(t *testing.T) {
 		assertRedirect("/topics", t, res)
 	})
 
-	t.Run("success", func(t *testing.T) {
+	t.Run("rejects messages breaking the content filter's length limit", func(t *testing.T) {
 		setupTests()
-		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=My+New+Message", nil)
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content="+strings.Repeat("a", 101), nil)
 		res := httptest.NewRecorder()
 		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
-		vars := map[string]string{"id": "3"}
-		req = mux.SetURLVars(req, vars)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		called := false
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			called = true
+			return m, nil
+		}
 
 		api.MessageCreate(res, req)
 
+		if called {
+			t.Error("message should not have been saved")
+		}
+
 		assertRedirect("/topics/3", t, res)
 	})
-}
 
-func TestTopicNew(t *testing.T) {
-	t.Run("responds with 302 to dashboard if user not logged in", func(t *testing.T) {
+	t.Run("holds messages with banned terms for moderator review", func(t *testing.T) {
 		setupTests()
-		req := httptest.NewRequest(http.MethodGet, "/topics/new", nil)
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=Visit+my+casino", nil)
 		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		messageID := 42
+		var saved *models.Message
+		var report *models.Report
 
-		api.TopicNew(res, req)
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			m.ID = &messageID
+			saved = m
+			return m, nil
+		}
 
-		assertRedirect("/topics", t, res)
-	})
+		testStorage.CreateReportFunc = func(r *models.Report) (*models.Report, error) {
+			report = r
+			return r, nil
+		}
 
-	t.Run("renders new topic form for logged in users", func(t *testing.T) {
-		setupTests()
-		req := httptest.NewRequest(http.MethodGet, "/topics/new", nil)
-		res := httptest.NewRecorder()
-		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		api.MessageCreate(res, req)
 
-		api.TopicNew(res, req)
+		if saved == nil || saved.Hidden == false {
+			t.Error("message should have been saved hidden")
+		}
 
-		if strings.Contains(res.Body.String(), "<form class=\"new-message-form") == false {
-			t.Error("response body should include new topic form")
+		if report == nil || *report.MessageID != messageID || report.SessionID != filterSessionID {
+			t.Error("held message should have been reported to moderators")
 		}
+
+		assertRedirect("/topics/3", t, res)
 	})
-}
 
-func TestTopicCreate(t *testing.T) {
-	t.Run("responds with 302 to dashboard if user not logged in", func(t *testing.T) {
+	t.Run("saves messages from new sessions as pending with pre-moderation enabled", func(t *testing.T) {
 		setupTests()
-		req := httptest.NewRequest(http.MethodPost, "/topics/new", nil)
+		api.config.PreModeration = true
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=My+New+Message", nil)
 		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		var saved *models.Message
+		var checked string
 
-		api.TopicCreate(res, req)
+		testStorage.HasApprovedFunc = func(authorKey string) (bool, error) {
+			checked = authorKey
+			return false, nil
+		}
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			saved = m
+			return m, nil
+		}
+
+		api.MessageCreate(res, req)
+
+		if saved == nil || saved.Status != "pending" || saved.AuthorKey == "" || checked != saved.AuthorKey {
+			t.Error("message should have been saved pending, checking its author key for approval")
+		}
+
+		assertRedirect("/topics/3", t, res)
+	})
+
+	t.Run("saves messages from approved sessions as approved with pre-moderation enabled", func(t *testing.T) {
+		setupTests()
+		api.config.PreModeration = true
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=My+New+Message", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		var saved *models.Message
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			saved = m
+			return m, nil
+		}
+
+		api.MessageCreate(res, req)
+
+		if saved == nil || saved.Status != "approved" {
+			t.Error("message should have been saved approved")
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages?content=My+New+Message", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		vars := map[string]string{"id": "3"}
+		req = mux.SetURLVars(req, vars)
+
+		api.MessageCreate(res, req)
+
+		assertRedirect("/topics/3", t, res)
+	})
+}
+
+func TestTopicNew(t *testing.T) {
+	t.Run("responds with 302 to dashboard if user not logged in", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/new", nil)
+		res := httptest.NewRecorder()
+
+		api.TopicNew(res, req)
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("renders new topic form for logged in users", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/new", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+
+		api.TopicNew(res, req)
+
+		if strings.Contains(res.Body.String(), "<form class=\"new-message-form") == false {
+			t.Error("response body should include new topic form")
+		}
+	})
+}
+
+func TestTopicCreate(t *testing.T) {
+	t.Run("responds with 302 to dashboard if user not logged in", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/new", nil)
+		res := httptest.NewRecorder()
+
+		api.TopicCreate(res, req)
 
 		assertRedirect("/topics", t, res)
 	})
@@ -328,6 +1010,53 @@ func TestTopicCreate(t *testing.T) {
 		}
 	})
 
+	t.Run("rejects topics with titles breaking the content filter's length limit", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/new?title="+strings.Repeat("a", 101)+"&content=check+it+out", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		called := false
+
+		testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+			called = true
+			return nil, nil
+		}
+
+		api.TopicCreate(res, req)
+
+		if called {
+			t.Error("topic should not have been created")
+		}
+
+		assertRedirect("/topics/new", t, res)
+	})
+
+	t.Run("responds with 302 to topic list when topic is held for review", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/new?title=Casino+night&content=check+it+out", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		topicID := 321
+		var saved *models.Message
+
+		testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+			return &models.Topic{ID: &topicID, Title: title, Messages: &[]models.Message{}}, nil
+		}
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			saved = m
+			return m, nil
+		}
+
+		api.TopicCreate(res, req)
+
+		if saved == nil || saved.Hidden == false {
+			t.Error("first message should have been saved hidden")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+
 	t.Run("responds with 302 to newly created topic on success", func(t *testing.T) {
 		setupTests()
 		req := httptest.NewRequest(http.MethodPost, "/topics/new?title=Birdwatchig+tips&content=check+it+out", nil)
@@ -343,6 +1072,47 @@ func TestTopicCreate(t *testing.T) {
 
 		assertRedirect("/topics/321", t, res)
 	})
+	t.Run("holds topics with banned terms in their title through the shared posting path", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/new?title=Best+casino&content=check+it+out", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		topicID, messageID := 321, 42
+		var saved *models.Message
+		var subscribed, reported bool
+
+		testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+			return &models.Topic{ID: &topicID, Title: title, Messages: &[]models.Message{}}, nil
+		}
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			m.ID = &messageID
+			saved = m
+			return m, nil
+		}
+
+		testStorage.SubscribeFunc = func(subscriberKey string, id int) error {
+			subscribed = id == topicID
+			return nil
+		}
+
+		testStorage.CreateReportFunc = func(r *models.Report) (*models.Report, error) {
+			reported = *r.MessageID == messageID
+			return r, nil
+		}
+
+		api.TopicCreate(res, req)
+
+		if saved == nil || saved.Hidden == false || saved.Status != "approved" {
+			t.Errorf("expected topic's message to be saved hidden, got %+v", saved)
+		}
+
+		if !subscribed || !reported {
+			t.Error("expected author to be subscribed and the message reported to moderators")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
 }
 
 func TestJoinShow(t *testing.T) {
@@ -403,6 +1173,22 @@ func TestJoinCreate(t *testing.T) {
 		assertRedirect("/join", t, res)
 	})
 
+	t.Run("refuses the anonymized initials and themes out of range", func(t *testing.T) {
+		for _, query := range []string{"initials=XX&theme=3", "initials=AK&theme=0", "initials=AK&theme=8"} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/join?"+query, nil)
+			res := httptest.NewRecorder()
+
+			api.JoinCreate(res, req)
+
+			if user, _ := api.session.GetUser(req); user != nil {
+				t.Errorf("user should not have been set for %s", query)
+			}
+
+			assertRedirect("/join", t, res)
+		}
+	})
+
 	t.Run("saves user and redirects home", func(t *testing.T) {
 		setupTests()
 		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3", nil)
@@ -419,3 +1205,2450 @@ func TestJoinCreate(t *testing.T) {
 		assertRedirect("/topics", t, res)
 	})
 }
+
+func TestRegisterCreate(t *testing.T) {
+	t.Run("refuses invalid handles", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/register?handle=a&password=password1&initials=JK&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.RegisterCreate(res, req)
+
+		if _, err := api.session.GetUserID(req); err == nil {
+			t.Error("session should not have been logged in")
+		}
+
+		assertRedirect("/register", t, res)
+	})
+
+	t.Run("refuses themes out of range", func(t *testing.T) {
+		setupTests()
+		testStorage.CreateUserFunc = func(u *models.User, passwordHash string) (*models.User, error) {
+			t.Error("expected no account to be created")
+			return u, nil
+		}
+		req := httptest.NewRequest(http.MethodPost, "/register?handle=jon&password=password1&initials=JK&theme=0", nil)
+		res := httptest.NewRecorder()
+
+		api.RegisterCreate(res, req)
+
+		assertRedirect("/register", t, res)
+	})
+
+	t.Run("refuses short passwords", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/register?handle=jon&password=short&initials=JK&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.RegisterCreate(res, req)
+
+		assertRedirect("/register", t, res)
+	})
+
+	t.Run("refuses taken handles", func(t *testing.T) {
+		setupTests()
+		testStorage.CreateUserFunc = func(u *models.User, passwordHash string) (*models.User, error) {
+			return nil, storage.ErrHandleTaken
+		}
+		req := httptest.NewRequest(http.MethodPost, "/register?handle=jon&password=password1&initials=JK&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.RegisterCreate(res, req)
+
+		flashes, _ := api.session.GetFlashes(req, res)
+
+		if len(flashes) == 0 || flashes[0] != "That handle is already taken" {
+			t.Error("expected taken handle flash")
+		}
+
+		assertRedirect("/register", t, res)
+	})
+
+	t.Run("stores a password hash and logs in", func(t *testing.T) {
+		setupTests()
+		var hash string
+		testStorage.CreateUserFunc = func(u *models.User, passwordHash string) (*models.User, error) {
+			id := 5
+			u.ID = &id
+			hash = passwordHash
+			return u, nil
+		}
+		req := httptest.NewRequest(http.MethodPost, "/register?handle=jon&password=password1&initials=jk&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.RegisterCreate(res, req)
+
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte("password1")) != nil {
+			t.Error("expected password to be stored as a bcrypt hash")
+		}
+
+		if id, _ := api.session.GetUserID(req); id != 5 {
+			t.Errorf("got user ID %d but wanted 5", id)
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+}
+
+func TestLoginCreate(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	setupLoginTests := func() {
+		setupTests()
+		testStorage.GetCredentialsFunc = func(handle string) (*models.User, string, error) {
+			if handle != "jon" {
+				return nil, "", storage.ErrUserNotFound
+			}
+
+			id := 5
+			return &models.User{ID: &id, Handle: "jon"}, string(hash), nil
+		}
+	}
+
+	t.Run("refuses wrong passwords", func(t *testing.T) {
+		setupLoginTests()
+		req := httptest.NewRequest(http.MethodPost, "/login?handle=jon&password=wrong", nil)
+		res := httptest.NewRecorder()
+
+		api.LoginCreate(res, req)
+
+		if _, err := api.session.GetUserID(req); err == nil {
+			t.Error("session should not have been logged in")
+		}
+
+		assertRedirect("/login", t, res)
+	})
+
+	t.Run("refuses unknown handles", func(t *testing.T) {
+		setupLoginTests()
+		req := httptest.NewRequest(http.MethodPost, "/login?handle=someone&password=password1", nil)
+		res := httptest.NewRecorder()
+
+		api.LoginCreate(res, req)
+
+		assertRedirect("/login", t, res)
+	})
+
+	t.Run("logs in with the right password", func(t *testing.T) {
+		setupLoginTests()
+		req := httptest.NewRequest(http.MethodPost, "/login?handle=jon&password=password1", nil)
+		res := httptest.NewRecorder()
+
+		api.LoginCreate(res, req)
+
+		if id, _ := api.session.GetUserID(req); id != 5 {
+			t.Errorf("got user ID %d but wanted 5", id)
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+}
+
+func TestLogoutCreate(t *testing.T) {
+	t.Run("removes the user from the session", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUserID(5, req, res)
+
+		api.LogoutCreate(res, req)
+
+		if _, err := api.currentUser(req); err == nil {
+			t.Error("user should have been removed")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+}
+
+func TestLogoutEverywhereCreate(t *testing.T) {
+	t.Run("explains when sessions can't be revoked", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/logout/everywhere", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUserID(5, req, res)
+
+		api.LogoutEverywhereCreate(res, req)
+
+		flashes, _ := api.session.GetFlashes(req, res)
+
+		if len(flashes) == 0 || flashes[0] != "Logging out everywhere isn't available on this server" {
+			t.Error("expected unavailable flash")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("ends the account's server-side sessions", func(t *testing.T) {
+		setupTests()
+		store := session.NewServerStore(session.NewMemoryBackend(), session.DefaultCookieOptions, 0, []byte("test"))
+		api = *New(testTemplates, &testStorage, session.NewStoreSession(store), testConfig, nil)
+		req := httptest.NewRequest(http.MethodPost, "/logout/everywhere", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUserID(5, req, res)
+
+		api.LogoutEverywhereCreate(res, req)
+
+		if _, err := api.session.GetUserID(req); err == nil {
+			t.Error("expected session to be logged out")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+}
+
+func TestAccounts(t *testing.T) {
+	t.Run("attributes messages to the logged in account", func(t *testing.T) {
+		setupTests()
+		var created *models.Message
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			created = m
+			return m, nil
+		}
+		req := httptest.NewRequest(http.MethodPost, "/topics/1/messages?content=Hello", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		res := httptest.NewRecorder()
+		api.session.SaveUserID(5, req, res)
+
+		api.MessageCreate(res, req)
+
+		if created == nil || created.UserID == nil || *created.UserID != 5 || created.AuthorInitials != "JK" {
+			t.Error("expected message to be attributed to the account")
+		}
+	})
+
+	t.Run("refuses anonymous users when anonymous mode is disabled", func(t *testing.T) {
+		setupTests()
+		testConfig.Anonymous = false
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+		req := httptest.NewRequest(http.MethodPost, "/topics/1/messages?content=Hello", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+
+		api.MessageCreate(res, req)
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("does not join anonymously when anonymous mode is disabled", func(t *testing.T) {
+		setupTests()
+		testConfig.Anonymous = false
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.JoinCreate(res, req)
+
+		if user, _ := api.session.GetUser(req); user != nil {
+			t.Error("user should not have been set")
+		}
+
+		assertRedirect("/join", t, res)
+	})
+}
+
+func TestOIDC(t *testing.T) {
+	setupOIDCTests := func() *oidctest.IdP {
+		setupTests()
+		idp := oidctest.New("topical", "secret")
+		testConfig.OIDCIssuer = idp.Issuer()
+		testConfig.OIDCClientID = "topical"
+		testConfig.OIDCClientSecret = "secret"
+		testConfig.OIDCRedirectURL = "http://topical.test/auth/oidc/callback"
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+		return idp
+	}
+
+	// signIn starts signing in, follows the IdP's redirect, and returns the
+	// callback request carrying the session cookie
+	signIn := func(t *testing.T, idp *oidctest.IdP) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+		res := httptest.NewRecorder()
+
+		api.OIDCLogin(res, req)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		idpRes, err := client.Get(res.Header().Get("Location"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		callback := httptest.NewRequest(http.MethodGet, idpRes.Header.Get("Location"), nil)
+
+		for _, c := range res.Result().Cookies() {
+			callback.AddCookie(c)
+		}
+
+		return callback
+	}
+
+	t.Run("signs in and links the provider's user to an account", func(t *testing.T) {
+		idp := setupOIDCTests()
+		defer idp.Close()
+		idp.User["name"] = "Jane Doe"
+		idp.User["preferred_username"] = "jane.doe"
+		var externalID string
+		var created *models.User
+		testStorage.GetExternalUserFunc = func(id string, u *models.User) (*models.User, error) {
+			externalID, created = id, u
+			userID := 9
+			u.ID = &userID
+			return u, nil
+		}
+
+		req := signIn(t, idp)
+		res := httptest.NewRecorder()
+
+		api.OIDCCallback(res, req)
+
+		if externalID != idp.Issuer()+"|user-1" {
+			t.Errorf("got external ID %q", externalID)
+		}
+
+		if created.Handle != "jane_doe" || created.Initials != "JD" {
+			t.Errorf("got handle %q and initials %q", created.Handle, created.Initials)
+		}
+
+		if id, _ := api.session.GetUserID(req); id != 9 {
+			t.Errorf("got user ID %d but wanted 9", id)
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("refuses callbacks with a mismatched state", func(t *testing.T) {
+		idp := setupOIDCTests()
+		defer idp.Close()
+		req := signIn(t, idp)
+		q := req.URL.Query()
+		q.Set("state", "forged")
+		req.URL.RawQuery = q.Encode()
+		res := httptest.NewRecorder()
+
+		api.OIDCCallback(res, req)
+
+		if _, err := api.session.GetUserID(req); err == nil {
+			t.Error("session should not have been logged in")
+		}
+
+		assertRedirect("/join", t, res)
+	})
+
+	t.Run("responds 404 when single sign-on is disabled", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+		res := httptest.NewRecorder()
+
+		api.OIDCLogin(res, req)
+
+		if res.Code != http.StatusNotFound {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestUserFromClaims(t *testing.T) {
+	tests := []struct {
+		claims   oidc.Claims
+		handle   string
+		initials string
+	}{
+		{oidc.Claims{Subject: "1", Name: "Jane Mary Doe", PreferredUsername: "jdoe"}, "jdoe", "JD"},
+		{oidc.Claims{Subject: "1", Email: "kim.lee@example.com"}, "kim_lee", "KI"},
+		{oidc.Claims{Subject: "1", Name: "Zoë"}, "Zo", "ZO"},
+		{oidc.Claims{Subject: "1"}, "user", "US"},
+		{oidc.Claims{Subject: "1", Name: "Xena Xu"}, "Xena_Xu", "US"},
+	}
+
+	for _, tt := range tests {
+		u := userFromClaims(&tt.claims)
+
+		if u.Initials != tt.initials || u.Theme < 1 || u.Theme > 7 {
+			t.Errorf("got initials %q and theme %d for %+v", u.Initials, u.Theme, tt.claims)
+		}
+
+		if !strings.HasPrefix(u.Handle, tt.handle) || len(u.Handle) < 3 {
+			t.Errorf("got handle %q for %+v", u.Handle, tt.claims)
+		}
+	}
+}
+
+func TestTripcode(t *testing.T) {
+	postMessage := func(user *models.User) string {
+		var created *models.Message
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			created = m
+			return m, nil
+		}
+		req := httptest.NewRequest(http.MethodPost, "/topics/1/messages?content=Hello", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		res := httptest.NewRecorder()
+		api.session.SaveUser(user, req, res)
+
+		api.MessageCreate(res, req)
+
+		return created.AuthorTripcode
+	}
+
+	t.Run("gives joined users a secret to derive their tripcode from", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3", nil)
+		res := httptest.NewRecorder()
+
+		api.JoinCreate(res, req)
+
+		if user, _ := api.session.GetUser(req); user.TripSecret == "" {
+			t.Error("expected user to have a tripcode secret")
+		}
+	})
+
+	t.Run("tells apart authors with the same initials and theme", func(t *testing.T) {
+		setupTests()
+		first := postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"})
+		again := postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"})
+		second := postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "two"})
+
+		if len(first) != tripcodeLength || first != again {
+			t.Errorf("expected a stable tripcode, got %q and %q", first, again)
+		}
+
+		if first == second {
+			t.Error("expected different secrets to give different tripcodes")
+		}
+	})
+
+	t.Run("depends on the server's signing key", func(t *testing.T) {
+		setupTests()
+		first := postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"})
+		testConfig.SigningKey = "other"
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+
+		if postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"}) == first {
+			t.Error("expected tripcode to be keyed")
+		}
+	})
+
+	t.Run("stays the same when session keys are rotated", func(t *testing.T) {
+		setupTests()
+		first := postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"})
+		testConfig.SessionKey = "other"
+		testConfig.SessionKeys = []config.SessionKeyPair{{Authentication: "newer"}, {Authentication: "other"}}
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+
+		if postMessage(&models.User{Initials: "AK", Theme: 3, TripSecret: "one"}) != first {
+			t.Error("expected tripcode not to change with session keys")
+		}
+	})
+}
+
+func TestChallenge(t *testing.T) {
+	setupChallengeTests := func() {
+		setupTests()
+		testConfig.Challenge = true
+		testConfig.ChallengeDifficulty = 4
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+	}
+
+	t.Run("renders challenge on join page when enabled", func(t *testing.T) {
+		setupChallengeTests()
+		req := httptest.NewRequest(http.MethodGet, "/join", nil)
+		res := httptest.NewRecorder()
+
+		api.JoinShow(res, req)
+
+		body := res.Body.String()
+
+		if !strings.Contains(body, `name="challenge"`) || !strings.Contains(body, `data-difficulty="4"`) {
+			t.Error("join page should include challenge")
+		}
+
+		if !strings.Contains(body, "/static/challenge.js") {
+			t.Error("join page should include challenge script")
+		}
+	})
+
+	t.Run("omits challenge when disabled", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/join", nil)
+		res := httptest.NewRecorder()
+
+		api.JoinShow(res, req)
+
+		if strings.Contains(res.Body.String(), `name="challenge"`) {
+			t.Error("join page should not include challenge")
+		}
+	})
+
+	t.Run("rejects join without a solved challenge", func(t *testing.T) {
+		setupChallengeTests()
+		// an unsolved challenge passes by chance at low difficulties
+		testConfig.ChallengeDifficulty = 32
+		api = *New(testTemplates, &testStorage, testSession, testConfig, nil)
+		token, _ := api.challenger.Issue()
+		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3&challenge="+token, nil)
+		res := httptest.NewRecorder()
+
+		api.JoinCreate(res, req)
+
+		if user, _ := api.session.GetUser(req); user != nil {
+			t.Error("user should not have been set")
+		}
+
+		assertRedirect("/join", t, res)
+	})
+
+	t.Run("rejects join with honeypot filled in", func(t *testing.T) {
+		setupChallengeTests()
+		token, _ := api.challenger.Issue()
+		solution := challenge.Solve(token, 4)
+		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3&website=spam&challenge="+token+"&challenge_solution="+solution, nil)
+		res := httptest.NewRecorder()
+
+		api.JoinCreate(res, req)
+
+		if user, _ := api.session.GetUser(req); user != nil {
+			t.Error("user should not have been set")
+		}
+
+		assertRedirect("/join", t, res)
+	})
+
+	t.Run("saves user with a solved challenge", func(t *testing.T) {
+		setupChallengeTests()
+		token, _ := api.challenger.Issue()
+		solution := challenge.Solve(token, 4)
+		req := httptest.NewRequest(http.MethodPost, "/join?initials=AK&theme=3&challenge="+token+"&challenge_solution="+solution, nil)
+		res := httptest.NewRecorder()
+
+		api.JoinCreate(res, req)
+
+		if user, _ := api.session.GetUser(req); user == nil {
+			t.Error("user should have been set")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("rejects topic without a solved challenge", func(t *testing.T) {
+		setupChallengeTests()
+		created := false
+		testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+			created = true
+			return nil, nil
+		}
+		req := httptest.NewRequest(http.MethodPost, "/topics?title=Hello&content=World", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+
+		api.TopicCreate(res, req)
+
+		if created {
+			t.Error("topic should not have been created")
+		}
+
+		assertRedirect("/topics/new", t, res)
+	})
+}
+
+func TestReportCreate(t *testing.T) {
+	// message is a message visible in topic 3
+	message := func(id int, v storage.Viewer) (*models.Message, error) {
+		topicID := 3
+		return &models.Message{ID: &id, TopicID: &topicID}, nil
+	}
+
+	t.Run("redirects back to report form if reason invalid", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reports?reason=boring", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+		testStorage.GetMessageFunc = message
+
+		api.ReportCreate(res, req)
+
+		assertRedirect("/topics/3/messages/7/report", t, res)
+	})
+
+	t.Run("saves report with session id and redirects to topic", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reports?reason=spam&details=buy+now", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+		testStorage.GetMessageFunc = message
+		var saved *models.Report
+
+		testStorage.CreateReportFunc = func(r *models.Report) (*models.Report, error) {
+			saved = r
+			return r, nil
+		}
+
+		api.ReportCreate(res, req)
+
+		if saved == nil || *saved.MessageID != 7 || saved.Reason != "spam" || saved.SessionID == "" {
+			t.Error("report should be saved with message, reason, and session id")
+		}
+
+		assertRedirect("/topics/3", t, res)
+	})
+
+	t.Run("flashes a notice when message already reported", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reports?reason=spam", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+		testStorage.GetMessageFunc = message
+
+		testStorage.CreateReportFunc = func(r *models.Report) (*models.Report, error) {
+			return nil, storage.ErrDuplicateReport
+		}
+
+		api.ReportCreate(res, req)
+
+		flashes, _ := api.session.GetFlashes(req, res)
+
+		if len(flashes) != 1 || flashes[0] != "You've already reported this message" {
+			t.Error("duplicate report flash should be saved")
+		}
+
+		assertRedirect("/topics/3", t, res)
+	})
+
+	t.Run("responds 404 for messages not in the topic", func(t *testing.T) {
+		for name, topicID := range map[string]string{"other topic": "4", "unknown message": "3"} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/topics/"+topicID+"/messages/7/reports?reason=spam", nil)
+			res := httptest.NewRecorder()
+			req = mux.SetURLVars(req, map[string]string{"id": topicID, "messageID": "7"})
+			called := false
+
+			if name == "other topic" {
+				testStorage.GetMessageFunc = message
+			}
+
+			testStorage.CreateReportFunc = func(r *models.Report) (*models.Report, error) {
+				called = true
+				return r, nil
+			}
+
+			api.ReportCreate(res, req)
+
+			if called || res.Code != http.StatusNotFound {
+				t.Errorf("%s: got status %d, report saved %v", name, res.Code, called)
+			}
+		}
+	})
+}
+
+func TestModerationLoginCreate(t *testing.T) {
+	t.Run("redirects back to login if key invalid", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/login?key=wrong", nil)
+		res := httptest.NewRecorder()
+
+		api.ModerationLoginCreate(res, req)
+
+		if api.session.IsModerator(req) {
+			t.Error("session should not be a moderator")
+		}
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("does not log in when moderation is disabled", func(t *testing.T) {
+		setupTests()
+		api.config.ModeratorKey = ""
+		req := httptest.NewRequest(http.MethodPost, "/moderation/login?key=", nil)
+		res := httptest.NewRecorder()
+
+		api.ModerationLoginCreate(res, req)
+
+		if api.session.IsModerator(req) {
+			t.Error("session should not be a moderator")
+		}
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("marks session as moderator and redirects to queue", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/login?key=mod_key", nil)
+		res := httptest.NewRecorder()
+
+		api.ModerationLoginCreate(res, req)
+
+		if api.session.IsModerator(req) == false {
+			t.Error("session should be a moderator")
+		}
+
+		assertRedirect("/moderation/reports", t, res)
+	})
+}
+
+func TestReportList(t *testing.T) {
+	t.Run("redirects to moderator login if not a moderator", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/reports", nil)
+		res := httptest.NewRecorder()
+
+		api.ReportList(res, req)
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("renders open reports for moderators", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/reports", nil)
+		res := httptest.NewRecorder()
+		api.session.SetModerator(true, req, res)
+		reportID, messageID, topicID := 1, 7, 3
+
+		testStorage.GetOpenReportsFunc = func() ([]models.Report, error) {
+			return []models.Report{{
+				ID:      &reportID,
+				Reason:  "spam",
+				Details: "Selling watches",
+				Message: &models.Message{ID: &messageID, TopicID: &topicID, Content: "Cheap watches"},
+			}}, nil
+		}
+
+		api.ReportList(res, req)
+
+		if strings.Contains(res.Body.String(), "Selling watches") == false {
+			t.Error("response body should include report details")
+		}
+
+		if strings.Contains(res.Body.String(), "action=\"/moderation/reports/1\"") == false {
+			t.Error("response body should include report actions")
+		}
+	})
+}
+
+func TestReportUpdate(t *testing.T) {
+	t.Run("redirects to moderator login if not a moderator", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/reports/1?action=dismiss", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		called := false
+
+		testStorage.ResolveReportFunc = func(id int, status string, hideMessage bool) error {
+			called = true
+			return nil
+		}
+
+		api.ReportUpdate(res, req)
+
+		if called {
+			t.Error("report should not be resolved")
+		}
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("hide action resolves report and hides message", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/reports/1?action=hide", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		api.session.SetModerator(true, req, res)
+		var gotStatus string
+		var gotHide bool
+
+		testStorage.ResolveReportFunc = func(id int, status string, hideMessage bool) error {
+			gotStatus, gotHide = status, hideMessage
+			return nil
+		}
+
+		api.ReportUpdate(res, req)
+
+		if gotStatus != "resolved" || gotHide == false {
+			t.Error("report should be resolved with message hidden")
+		}
+
+		assertRedirect("/moderation/reports", t, res)
+	})
+
+	t.Run("approve action publishes the reported message", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/reports/1?action=approve", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		api.session.SetModerator(true, req, res)
+		approved := 0
+
+		testStorage.ApproveReportFunc = func(id int) error {
+			approved = id
+			return nil
+		}
+
+		api.ReportUpdate(res, req)
+
+		if approved != 1 {
+			t.Error("report should have been approved")
+		}
+
+		assertRedirect("/moderation/reports", t, res)
+	})
+
+	t.Run("dismiss action leaves message visible", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/reports/1?action=dismiss", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		api.session.SetModerator(true, req, res)
+		var gotStatus string
+		var gotHide bool
+
+		testStorage.ResolveReportFunc = func(id int, status string, hideMessage bool) error {
+			gotStatus, gotHide = status, hideMessage
+			return nil
+		}
+
+		api.ReportUpdate(res, req)
+
+		if gotStatus != "dismissed" || gotHide {
+			t.Error("report should be dismissed without hiding message")
+		}
+	})
+}
+
+func TestRateLimited(t *testing.T) {
+	t.Run("renders 429 with a notice and link back for browsers", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages", nil)
+		req.Header.Set("Accept", "text/html")
+		req.Header.Set("Referer", "http://example.com/topics/3")
+		res := httptest.NewRecorder()
+
+		api.RateLimited(res, req, 30*time.Second)
+
+		if res.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusTooManyRequests)
+		}
+
+		if strings.Contains(res.Body.String(), "please wait 30 seconds") == false {
+			t.Error("response body should include rate limit notice")
+		}
+
+		if strings.Contains(res.Body.String(), "href=\"/topics/3\"") == false {
+			t.Error("response body should link back to referring page")
+		}
+	})
+
+	t.Run("does not link back to other sites", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages", nil)
+		req.Header.Set("Accept", "text/html")
+		req.Header.Set("Referer", "http://evil.example.org/phish")
+		res := httptest.NewRecorder()
+
+		api.RateLimited(res, req, 30*time.Second)
+
+		if strings.Contains(res.Body.String(), "href=\"/topics\"") == false {
+			t.Error("response body should link back to topics")
+		}
+	})
+}
+
+func TestCSRF(t *testing.T) {
+	newRouter := func() *mux.Router {
+		r := mux.NewRouter()
+		api.RegisterRoutes(r)
+		r.Use(middleware.CSRF(api.session))
+		return r
+	}
+
+	t.Run("rejects form posts missing a CSRF token", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/join", strings.NewReader("initials=AK&theme=3"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+
+		newRouter().ServeHTTP(res, req)
+
+		if res.Code != http.StatusForbidden {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusForbidden)
+		}
+
+		if user, _ := api.session.GetUser(req); user != nil {
+			t.Error("user should not have been set")
+		}
+	})
+
+	t.Run("rejects form posts with a mismatched CSRF token", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/join", strings.NewReader("initials=AK&theme=3&csrf_token=forged"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		api.session.GetCSRFToken(req, res)
+
+		newRouter().ServeHTTP(res, req)
+
+		if res.Code != http.StatusForbidden {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("accepts form posts with the session's CSRF token", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/join", nil)
+		res := httptest.NewRecorder()
+		token, _ := api.session.GetCSRFToken(req, res)
+		req.Body = ioutil.NopCloser(strings.NewReader("initials=AK&theme=3&csrf_token=" + token))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		newRouter().ServeHTTP(res, req)
+
+		assertRedirect("/topics", t, res)
+	})
+
+	t.Run("renders the session's CSRF token into forms", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/join", nil)
+		res := httptest.NewRecorder()
+		token, _ := api.session.GetCSRFToken(req, res)
+
+		newRouter().ServeHTTP(res, req)
+
+		if strings.Contains(res.Body.String(), "name=\"csrf_token\" value=\""+token+"\"") == false {
+			t.Error("response body should include CSRF token field")
+		}
+	})
+}
+
+func TestCSPReportCreate(t *testing.T) {
+	t.Run("accepts violation reports without a CSRF token", func(t *testing.T) {
+		setupTests()
+		r := mux.NewRouter()
+		api.RegisterRoutes(r)
+		r.Use(middleware.CSRF(api.session, "/csp-report"))
+		req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(`{"csp-report":{"violated-directive":"script-src"}}`))
+		req.Header.Set("Content-Type", "application/csp-report")
+		res := httptest.NewRecorder()
+
+		r.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusNoContent)
+		}
+	})
+}
+
+func TestPendingList(t *testing.T) {
+	t.Run("redirects to moderator login if not a moderator", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/pending", nil)
+		res := httptest.NewRecorder()
+
+		api.PendingList(res, req)
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("renders pending messages for moderators", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/pending", nil)
+		res := httptest.NewRecorder()
+		api.session.SetModerator(true, req, res)
+		messageID, topicID := 7, 3
+
+		testStorage.GetPendingFunc = func() ([]models.Message, error) {
+			return []models.Message{{ID: &messageID, TopicID: &topicID, TopicTitle: "Birdwatching", Content: "My first post"}}, nil
+		}
+
+		api.PendingList(res, req)
+
+		if strings.Contains(res.Body.String(), "My first post") == false {
+			t.Error("response body should include pending message")
+		}
+
+		if strings.Contains(res.Body.String(), "action=\"/moderation/pending/7\"") == false {
+			t.Error("response body should include moderation actions")
+		}
+	})
+}
+
+func TestPendingUpdate(t *testing.T) {
+	t.Run("redirects to moderator login if not a moderator", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/pending/7?action=approve", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "7"})
+		called := false
+
+		testStorage.SetMessageStatusFunc = func(id int, status string) error {
+			called = true
+			return nil
+		}
+
+		api.PendingUpdate(res, req)
+
+		if called {
+			t.Error("message status should not be updated")
+		}
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("approves and rejects messages", func(t *testing.T) {
+		for action, want := range map[string]string{"approve": "approved", "reject": "rejected"} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/moderation/pending/7?action="+action, nil)
+			res := httptest.NewRecorder()
+			req = mux.SetURLVars(req, map[string]string{"id": "7"})
+			api.session.SetModerator(true, req, res)
+			var got string
+
+			testStorage.SetMessageStatusFunc = func(id int, status string) error {
+				got = status
+				return nil
+			}
+
+			api.PendingUpdate(res, req)
+
+			if got != want {
+				t.Errorf("got status %s but wanted %s", got, want)
+			}
+
+			assertRedirect("/moderation/pending", t, res)
+		}
+	})
+}
+
+func TestProfileShow(t *testing.T) {
+	t.Run("renders the author's messages with links to their topics", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/u/jk-3", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"initials": "jk", "theme": "3"})
+		topicID, messageID := 4, 12
+		var gotInitials string
+		var gotTheme int
+
+		testStorage.GetAuthorFunc = func(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error) {
+			gotInitials, gotTheme = initials, theme
+			return []models.Message{{ID: &messageID, TopicID: &topicID, TopicTitle: "Gardening", Content: "Tomatoes", AuthorInitials: "JK", AuthorTheme: 3, Posted: time.Now()}}, nil
+		}
+
+		api.ProfileShow(res, req)
+		body := res.Body.String()
+
+		if gotInitials != "JK" || gotTheme != 3 {
+			t.Errorf("got identity %s-%d but wanted JK-3", gotInitials, gotTheme)
+		}
+
+		if !strings.Contains(body, "Tomatoes") || !strings.Contains(body, `href="/topics/4#message-12"`) || !strings.Contains(body, "Gardening") {
+			t.Error("expected message and permalink to be rendered")
+		}
+	})
+
+	t.Run("pages through messages newest first", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/u/JK-3?page=2", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"initials": "JK", "theme": "3"})
+		var gotLimit, gotOffset int
+
+		testStorage.GetAuthorFunc = func(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error) {
+			gotLimit, gotOffset = limit, offset
+			return make([]models.Message, limit), nil
+		}
+
+		api.ProfileShow(res, req)
+		body := res.Body.String()
+
+		if gotLimit != profilePageSize+1 || gotOffset != profilePageSize {
+			t.Errorf("got limit %d and offset %d", gotLimit, gotOffset)
+		}
+
+		if !strings.Contains(body, `href="/u/JK-3?page=1"`) || !strings.Contains(body, `href="/u/JK-3?page=3"`) {
+			t.Error("expected links to newer and older pages")
+		}
+	})
+
+	t.Run("lists every theme when only initials are given", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/u/jk", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"initials": "jk"})
+		gotTheme := -1
+
+		testStorage.GetAuthorFunc = func(initials string, theme int, limit int, offset int, v storage.Viewer) ([]models.Message, error) {
+			gotTheme = theme
+			return make([]models.Message, limit), nil
+		}
+
+		api.ProfileShow(res, req)
+
+		if gotTheme != 0 {
+			t.Errorf("got theme %d but wanted 0", gotTheme)
+		}
+
+		if !strings.Contains(res.Body.String(), `href="/u/JK?page=2"`) {
+			t.Error("expected pagination without a theme")
+		}
+	})
+
+	t.Run("omits the older link on the last page", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/u/JK-3", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"initials": "JK", "theme": "3"})
+
+		api.ProfileShow(res, req)
+
+		if strings.Contains(res.Body.String(), "?page=") {
+			t.Error("expected no pagination links")
+		}
+	})
+}
+
+func TestSettingsShow(t *testing.T) {
+	t.Run("shows display preferences without a user", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		res := httptest.NewRecorder()
+
+		api.SettingsShow(res, req)
+		body := res.Body.String()
+
+		if !strings.Contains(body, `name="appearance"`) || strings.Contains(body, "Your data") {
+			t.Error("expected only display preferences to be shown")
+		}
+	})
+
+	t.Run("shows how many messages the user has posted", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.CountByAuthorKeyFunc = func(authorKey string) (int, error) {
+			return 2, nil
+		}
+
+		api.SettingsShow(res, req)
+
+		if !strings.Contains(res.Body.String(), "posted 2 messages") {
+			t.Error("expected message count to be rendered")
+		}
+	})
+}
+
+func TestDataExport(t *testing.T) {
+	exportRequest := func(format string) (*http.Request, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/settings/data/export?format="+format, nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		return req, res
+	}
+
+	t.Run("exports the user's messages by a stable author key", func(t *testing.T) {
+		setupTests()
+		req, res := exportRequest("json")
+		topicID, messageID := 4, 12
+		keys := []string{}
+
+		testStorage.GetByAuthorKeyFunc = func(authorKey string) ([]models.Message, error) {
+			keys = append(keys, authorKey)
+			reactions := []models.Reaction{{Emoji: "👍", Count: 2}}
+			return []models.Message{{ID: &messageID, TopicID: &topicID, TopicTitle: "Gardening", Content: "**Tomatoes**", Status: "approved", Reactions: reactions}}, nil
+		}
+
+		api.DataExport(res, req)
+		api.DataExport(httptest.NewRecorder(), req)
+
+		var exported []exportedMessage
+		json.Unmarshal(res.Body.Bytes(), &exported)
+
+		if len(exported) != 1 || exported[0].Content != "**Tomatoes**" || exported[0].TopicTitle != "Gardening" || len(exported[0].Reactions) != 1 {
+			t.Errorf("unexpected export %s", res.Body.String())
+		}
+
+		if !strings.HasPrefix(res.Header().Get("Content-Disposition"), "attachment") {
+			t.Error("expected export to be a download")
+		}
+
+		if keys[0] == "" || keys[0] != keys[1] {
+			t.Error("expected the same author key for the same user")
+		}
+	})
+
+	t.Run("exports Markdown", func(t *testing.T) {
+		setupTests()
+		req, res := exportRequest("markdown")
+		topicID, messageID := 4, 12
+
+		testStorage.GetByAuthorKeyFunc = func(authorKey string) ([]models.Message, error) {
+			return []models.Message{{ID: &messageID, TopicID: &topicID, TopicTitle: "Gardening", Content: "**Tomatoes**", Status: "approved"}}, nil
+		}
+
+		api.DataExport(res, req)
+		body := res.Body.String()
+
+		if !strings.Contains(body, "## Gardening") || !strings.Contains(body, "**Tomatoes**") || !strings.Contains(body, "/topics/4#message-12") {
+			t.Errorf("unexpected export %s", body)
+		}
+	})
+
+	t.Run("redirects to settings for unknown formats", func(t *testing.T) {
+		setupTests()
+		req, res := exportRequest("csv")
+
+		api.DataExport(res, req)
+		assertRedirect("/settings", t, res)
+	})
+}
+
+func TestDataErase(t *testing.T) {
+	t.Run("asks for confirmation before erasing", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/settings/data/erase?mode=delete", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.EraseByAuthorKeyFunc = func(authorKey string, anonymize bool) (int, error) {
+			t.Error("expected nothing to be erased")
+			return 0, nil
+		}
+
+		api.DataEraseShow(res, req)
+
+		if !strings.Contains(res.Body.String(), `action="/settings/data/erase"`) {
+			t.Error("expected confirmation form")
+		}
+	})
+
+	t.Run("anonymizes the user's messages", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/settings/data/erase?mode=anonymize", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		var anonymized bool
+
+		testStorage.EraseByAuthorKeyFunc = func(authorKey string, anonymize bool) (int, error) {
+			anonymized = anonymize
+			return 3, nil
+		}
+
+		api.DataEraseCreate(res, req)
+		assertRedirect("/settings", t, res)
+
+		if !anonymized {
+			t.Error("expected messages to be anonymized")
+		}
+
+		if flashes, _ := api.session.GetFlashes(req, res); len(flashes) != 1 || flashes[0] != "Anonymized 3 messages" {
+			t.Errorf("unexpected flashes %v", flashes)
+		}
+	})
+
+	t.Run("ignores unknown modes", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/settings/data/erase?mode=shred", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.EraseByAuthorKeyFunc = func(authorKey string, anonymize bool) (int, error) {
+			t.Error("expected nothing to be erased")
+			return 0, nil
+		}
+
+		api.DataEraseCreate(res, req)
+		assertRedirect("/settings", t, res)
+	})
+}
+
+func TestSettingsUpdate(t *testing.T) {
+	settingsRequest := func(query string) (*http.Request, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/settings?"+query, nil)
+		res := httptest.NewRecorder()
+		return req, res
+	}
+
+	t.Run("saves preferences and an anonymous user's initials and theme", func(t *testing.T) {
+		setupTests()
+		req, res := settingsRequest("appearance=dark&timezone=Europe/Paris&date_format=iso&density=compact&initials=ab&theme=5")
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		api.SettingsUpdate(res, req)
+		assertRedirect("/settings", t, res)
+
+		want := models.Preferences{Appearance: "dark", Timezone: "Europe/Paris", DateFormat: "iso", Density: "compact"}
+
+		if p := api.session.GetPreferences(req); p != want {
+			t.Errorf("got preferences %+v but wanted %+v", p, want)
+		}
+
+		if user, _ := api.session.GetUser(req); user.Initials != "AB" || user.Theme != 5 || user.TripSecret != "secret" {
+			t.Errorf("unexpected user %+v", user)
+		}
+	})
+
+	t.Run("rejects unknown timezones", func(t *testing.T) {
+		setupTests()
+		req, res := settingsRequest("appearance=auto&timezone=Mars/Olympus&date_format=date&density=comfortable")
+
+		api.SettingsUpdate(res, req)
+		assertRedirect("/settings", t, res)
+
+		if p := api.session.GetPreferences(req); p != (models.Preferences{}) {
+			t.Errorf("expected preferences not to be saved, got %+v", p)
+		}
+	})
+
+	t.Run("rejects invalid initials", func(t *testing.T) {
+		setupTests()
+		req, res := settingsRequest("appearance=auto&date_format=date&density=comfortable&initials=a1&theme=5")
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3}, req, res)
+
+		api.SettingsUpdate(res, req)
+
+		if user, _ := api.session.GetUser(req); user.Initials != "JK" {
+			t.Error("expected initials not to change")
+		}
+	})
+
+	t.Run("rejects the anonymized identity", func(t *testing.T) {
+		for _, query := range []string{"initials=XX&theme=5", "initials=AB&theme=0"} {
+			setupTests()
+			req, res := settingsRequest("appearance=auto&date_format=date&density=comfortable&" + query)
+			api.session.SaveUser(&models.User{Initials: "JK", Theme: 3}, req, res)
+
+			api.SettingsUpdate(res, req)
+
+			if user, _ := api.session.GetUser(req); user.Initials != "JK" || user.Theme != 3 {
+				t.Errorf("expected identity not to change for %s", query)
+			}
+		}
+	})
+}
+
+func TestPreferencesRendering(t *testing.T) {
+	t.Run("shows timestamps in the preferred timezone and format", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/1", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		api.session.SavePreferences(models.Preferences{Timezone: "Asia/Tokyo", DateFormat: "iso"}, req, res)
+
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+			messages := []models.Message{{ID: &id, Content: "Hi", Posted: time.Date(2021, 3, 1, 20, 30, 0, 0, time.UTC)}}
+			return &models.Topic{ID: &id, Title: "Time", Messages: &messages}, nil
+		}
+
+		api.TopicShow(res, req)
+
+		if !strings.Contains(res.Body.String(), "posted 2021-03-02 05:30") {
+			t.Error("expected timestamp in Tokyo time")
+		}
+	})
+
+	t.Run("forces the dark stylesheet when dark appearance is chosen", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		api.session.SavePreferences(models.Preferences{Appearance: "dark", Density: "compact"}, req, res)
+
+		api.TopicList(res, req)
+		body := res.Body.String()
+
+		if !strings.Contains(body, `<link rel="stylesheet" href="/static/dark.css">`) || !strings.Contains(body, "topics-compact") {
+			t.Error("expected dark stylesheet and compact list")
+		}
+	})
+
+	t.Run("leaves dark mode to the browser by default", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+
+		api.TopicList(res, req)
+
+		if !strings.Contains(res.Body.String(), `media="(prefers-color-scheme: dark)"`) {
+			t.Error("expected dark stylesheet to follow the browser")
+		}
+	})
+}
+
+func TestUnread(t *testing.T) {
+	threeMessages := func(id int, v storage.Viewer) (*models.Topic, error) {
+		ids := []int{1, 2, 3}
+		messages := []models.Message{{ID: &ids[0], Content: "one"}, {ID: &ids[1], Content: "two"}, {ID: &ids[2], Content: "three"}}
+		return &models.Topic{ID: &id, Title: "Busy", Messages: &messages}, nil
+	}
+
+	joinedRequest := func(path string) (*http.Request, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		return req, res
+	}
+
+	t.Run("highlights messages posted since the last visit and marks the topic read", func(t *testing.T) {
+		setupTests()
+		req, res := joinedRequest("/topics/5")
+		var marked int
+
+		testStorage.GetTopicFunc = threeMessages
+		testStorage.GetLastReadFunc = func(readerKey string, topicID int) (int, error) {
+			return 1, nil
+		}
+		testStorage.MarkReadFunc = func(readerKey string, topicID int, messageID int) error {
+			marked = messageID
+			return nil
+		}
+
+		api.TopicShow(res, req)
+		body := res.Body.String()
+
+		if strings.Count(body, "message-unread") != 2 || !strings.Contains(body, `href="#message-2">Jump to first unread`) {
+			t.Error("expected the two newer messages to be highlighted")
+		}
+
+		if marked != 3 {
+			t.Errorf("got topic marked read to %d but wanted 3", marked)
+		}
+	})
+
+	t.Run("doesn't track visitors who haven't joined", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/5", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+
+		testStorage.GetTopicFunc = threeMessages
+		testStorage.MarkReadFunc = func(readerKey string, topicID int, messageID int) error {
+			t.Error("expected topic not to be marked read")
+			return nil
+		}
+
+		api.TopicShow(res, req)
+	})
+
+	t.Run("redirects to the first unread message", func(t *testing.T) {
+		setupTests()
+		req, res := joinedRequest("/topics/5/unread")
+
+		testStorage.GetTopicFunc = threeMessages
+		testStorage.GetLastReadFunc = func(readerKey string, topicID int) (int, error) {
+			return 1, nil
+		}
+
+		api.TopicUnread(res, req)
+		assertRedirect("/topics/5#message-2", t, res)
+	})
+
+	t.Run("redirects to the latest message when caught up", func(t *testing.T) {
+		setupTests()
+		req, res := joinedRequest("/topics/5/unread")
+
+		testStorage.GetTopicFunc = threeMessages
+		testStorage.GetLastReadFunc = func(readerKey string, topicID int) (int, error) {
+			return 3, nil
+		}
+
+		api.TopicUnread(res, req)
+		assertRedirect("/topics/5#message-3", t, res)
+	})
+
+	t.Run("shows unread counts in the topic list", func(t *testing.T) {
+		setupTests()
+		req, res := joinedRequest("/topics")
+		id, count, initials, theme := 5, 3, "JK", "3"
+
+		testStorage.GetRecentTopicsFunc = func(v storage.Viewer) ([]models.Topic, error) {
+			if v.ReaderKey == "" {
+				t.Error("expected a reader key")
+			}
+
+			return []models.Topic{{ID: &id, Title: "Busy", MessageCount: &count, AuthorInitials: &initials, AuthorTheme: &theme, UnreadCount: 2}}, nil
+		}
+
+		api.TopicList(res, req)
+
+		if !strings.Contains(res.Body.String(), `<a class="topic-unread" href="/topics/5/unread">2 new</a>`) {
+			t.Error("expected unread count linking to the first unread message")
+		}
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Run("subscribes authors to topics they post in", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/5/messages?content=Hello", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		var subscribedTo int
+		var subscriber, author string
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			author = m.AuthorKey
+			return m, nil
+		}
+		testStorage.SubscribeFunc = func(subscriberKey string, topicID int) error {
+			subscriber, subscribedTo = subscriberKey, topicID
+			return nil
+		}
+
+		api.MessageCreate(res, req)
+
+		if subscribedTo != 5 || subscriber == "" || subscriber != author {
+			t.Error("expected author to be subscribed to the topic")
+		}
+	})
+
+	t.Run("watches and unwatches topics", func(t *testing.T) {
+		setupTests()
+		var actions []string
+
+		testStorage.SubscribeFunc = func(subscriberKey string, topicID int) error {
+			actions = append(actions, "watch")
+			return nil
+		}
+		testStorage.UnsubscribeFunc = func(subscriberKey string, topicID int) error {
+			actions = append(actions, "unwatch")
+			return nil
+		}
+
+		for _, action := range []string{"watch", "unwatch"} {
+			req := httptest.NewRequest(http.MethodPost, "/topics/5/subscription?action="+action, nil)
+			res := httptest.NewRecorder()
+			req = mux.SetURLVars(req, map[string]string{"id": "5"})
+			api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+			api.SubscriptionUpdate(res, req)
+			assertRedirect("/topics/5", t, res)
+		}
+
+		if strings.Join(actions, ",") != "watch,unwatch" {
+			t.Errorf("got actions %v", actions)
+		}
+	})
+
+	t.Run("requires a user to watch topics", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/5/subscription?action=watch", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+
+		testStorage.SubscribeFunc = func(subscriberKey string, topicID int) error {
+			t.Error("expected no subscription")
+			return nil
+		}
+
+		api.SubscriptionUpdate(res, req)
+		assertRedirect("/topics/5", t, res)
+	})
+
+	t.Run("shows the unwatch button to subscribers", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/5", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "5"})
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.IsSubscribedFunc = func(subscriberKey string, topicID int) (bool, error) {
+			return true, nil
+		}
+
+		api.TopicShow(res, req)
+
+		if !strings.Contains(res.Body.String(), `value="unwatch"`) {
+			t.Error("expected unwatch button")
+		}
+	})
+}
+
+func TestNotificationList(t *testing.T) {
+	t.Run("lists notifications and marks them read", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		id, topicID, messageID := 1, 4, 12
+		marked := false
+
+		testStorage.GetNotificationsFunc = func(recipientKey string, limit int) ([]models.Notification, error) {
+			return []models.Notification{
+				{ID: &id, Kind: "reply", Message: &models.Message{ID: &messageID, TopicID: &topicID, TopicTitle: "Gardening", AuthorInitials: "AB", AuthorTheme: 2}},
+				{ID: &id, Kind: "mention", Read: true, Message: &models.Message{ID: &messageID, TopicID: &topicID, TopicTitle: "Gardening", AuthorInitials: "AB", AuthorTheme: 2}},
+			}, nil
+		}
+		testStorage.MarkAllReadFunc = func(recipientKey string) error {
+			marked = true
+			return nil
+		}
+
+		api.NotificationList(res, req)
+		body := res.Body.String()
+
+		if !strings.Contains(body, `href="/topics/4#message-12">replied in Gardening`) || strings.Count(body, "notification-unread") != 1 {
+			t.Error("expected unread notification linking to the reply")
+		}
+
+		if !strings.Contains(body, "mentioned you in Gardening") {
+			t.Error("expected mention notification")
+		}
+
+		if !marked {
+			t.Error("expected notifications to be marked read")
+		}
+	})
+
+	t.Run("shows the unread count in the header", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.CountUnreadFunc = func(recipientKey string) (int, error) {
+			return 3, nil
+		}
+
+		api.TopicList(res, req)
+
+		if !strings.Contains(res.Body.String(), `<span class="notifications-badge">3</span>`) {
+			t.Error("expected unread notification badge")
+		}
+	})
+}
+
+// enableDigests gives the test API a digester sending to a stand-in relay
+func enableDigests(t *testing.T) *mailertest.Server {
+	emails, err := templates.GenerateEmailTemplates("../../web/emails/*.tmpl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay := mailertest.New()
+	m := mailer.New(mailer.Config{Addr: relay.Addr, From: "topical@example.com"})
+	api.digests = digest.New(&storage.Storage{}, m, emails, digest.Config{BaseURL: "https://topical.example.com", Key: []byte("key"), ReplyDomain: "reply.example.com"})
+
+	return relay
+}
+
+func TestDigests(t *testing.T) {
+	t.Run("hides digest settings when digests are disabled", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		api.SettingsShow(res, req)
+
+		if strings.Contains(res.Body.String(), "Email digests") {
+			t.Error("expected no digest settings")
+		}
+	})
+
+	t.Run("shows the user's digest", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.GetDigestFunc = func(recipientKey string) (*models.Digest, error) {
+			return &models.Digest{Email: "jk@example.com", Frequency: "weekly"}, nil
+		}
+
+		api.SettingsShow(res, req)
+		body := res.Body.String()
+
+		if !strings.Contains(body, `value="jk@example.com"`) || !strings.Contains(body, `<option value="weekly" selected>`) {
+			t.Error("expected digest email and frequency to be shown")
+		}
+
+		if !strings.Contains(body, "Follow the link emailed to jk@example.com") {
+			t.Error("expected unconfirmed digest to be pointed out")
+		}
+	})
+
+	t.Run("emails a confirmation link for new addresses", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		req := httptest.NewRequest(http.MethodPost, "/settings/digest?email=jk@example.com&frequency=daily", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		var saved models.Digest
+
+		testStorage.SaveDigestFunc = func(d *models.Digest) (*models.Digest, error) {
+			saved = *d
+			return d, nil
+		}
+
+		api.DigestUpdate(res, req)
+		assertRedirect("/settings", t, res)
+
+		if saved.RecipientKey == "" || saved.Email != "jk@example.com" || saved.Frequency != "daily" {
+			t.Errorf("got saved digest %+v", saved)
+		}
+
+		messages := relay.Messages()
+
+		if len(messages) != 1 || !strings.Contains(messages[0].Body, api.digests.ConfirmURL(saved.RecipientKey, "jk@example.com")) {
+			t.Error("expected a confirmation email")
+		}
+	})
+
+	t.Run("doesn't resend confirmations too often", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		req := httptest.NewRequest(http.MethodPost, "/settings/digest?email=jk@example.com&frequency=daily", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.ClaimConfirmationFunc = func(recipientKey string, interval time.Duration) (bool, error) {
+			return false, nil
+		}
+
+		api.DigestUpdate(res, req)
+		assertRedirect("/settings", t, res)
+
+		if len(relay.Messages()) != 0 {
+			t.Error("expected no confirmation email")
+		}
+	})
+
+	t.Run("doesn't confirm addresses again", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		req := httptest.NewRequest(http.MethodPost, "/settings/digest?email=jk@example.com&frequency=weekly", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+		testStorage.SaveDigestFunc = func(d *models.Digest) (*models.Digest, error) {
+			d.Confirmed = true
+			return d, nil
+		}
+
+		api.DigestUpdate(res, req)
+
+		if len(relay.Messages()) != 0 {
+			t.Error("expected no confirmation email")
+		}
+	})
+
+	t.Run("rejects invalid addresses and frequencies", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+
+		testStorage.SaveDigestFunc = func(d *models.Digest) (*models.Digest, error) {
+			t.Error("expected no digest to be saved")
+			return d, nil
+		}
+
+		for _, query := range []string{"email=not-an-email&frequency=daily", "email=jk@example.com&frequency=hourly"} {
+			req := httptest.NewRequest(http.MethodPost, "/settings/digest?"+query, nil)
+			res := httptest.NewRecorder()
+			api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+
+			api.DigestUpdate(res, req)
+			assertRedirect("/settings", t, res)
+		}
+	})
+
+	t.Run("turns digests off", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		req := httptest.NewRequest(http.MethodPost, "/settings/digest?frequency=off", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "JK", Theme: 3, TripSecret: "secret"}, req, res)
+		deleted := ""
+
+		testStorage.DeleteDigestFunc = func(recipientKey string) error {
+			deleted = recipientKey
+			return nil
+		}
+
+		api.DigestUpdate(res, req)
+		assertRedirect("/settings", t, res)
+
+		if deleted == "" {
+			t.Error("expected digest to be deleted")
+		}
+	})
+
+	t.Run("confirms digests from signed links", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		link := api.digests.ConfirmURL("recipient", "jk@example.com")
+		confirmed := ""
+
+		testStorage.ConfirmDigestFunc = func(recipientKey string, email string) (bool, error) {
+			confirmed = recipientKey + " " + email
+			return true, nil
+		}
+
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		res := httptest.NewRecorder()
+		api.DigestConfirm(res, req)
+		assertRedirect("/", t, res)
+
+		if confirmed != "recipient jk@example.com" {
+			t.Errorf("got confirmed %q", confirmed)
+		}
+
+		confirmed = ""
+		req = httptest.NewRequest(http.MethodGet, strings.Replace(link, "jk%40example.com", "other%40example.com", 1), nil)
+		res = httptest.NewRecorder()
+		api.DigestConfirm(res, req)
+
+		if confirmed != "" {
+			t.Error("expected tampered link not to confirm")
+		}
+	})
+
+	t.Run("unsubscribes from signed links", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+		link := api.digests.UnsubscribeURL("recipient")
+		deleted := ""
+
+		testStorage.DeleteDigestFunc = func(recipientKey string) error {
+			deleted = recipientKey
+			return nil
+		}
+
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		res := httptest.NewRecorder()
+		api.DigestUnsubscribeShow(res, req)
+
+		if deleted != "" || !strings.Contains(res.Body.String(), `name="sig"`) {
+			t.Error("expected an unsubscribe form without unsubscribing")
+		}
+
+		req = httptest.NewRequest(http.MethodPost, link, strings.NewReader("List-Unsubscribe=One-Click"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res = httptest.NewRecorder()
+		api.DigestUnsubscribeCreate(res, req)
+		assertRedirect("/", t, res)
+
+		if deleted != "recipient" {
+			t.Errorf("got deleted %q", deleted)
+		}
+	})
+
+	t.Run("rejects forged unsubscribe links", func(t *testing.T) {
+		setupTests()
+		relay := enableDigests(t)
+		defer relay.Close()
+
+		testStorage.DeleteDigestFunc = func(recipientKey string) error {
+			t.Error("expected no digest to be deleted")
+			return nil
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/digest/unsubscribe?key=recipient&sig=forged", nil)
+		res := httptest.NewRecorder()
+		api.DigestUnsubscribeCreate(res, req)
+
+		if res.Code != http.StatusForbidden {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("is not found when digests are disabled", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/digest/unsubscribe", nil)
+		res := httptest.NewRecorder()
+		api.DigestUnsubscribeShow(res, req)
+
+		if res.Code != http.StatusNotFound {
+			t.Errorf("got status %d but wanted %d", res.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestReceiveReply(t *testing.T) {
+	reply := func(from string, to string, body string) io.Reader {
+		return strings.NewReader("From: " + from + "\r\nTo: " + to + "\r\nSubject: Re: digest\r\n\r\n" + body)
+	}
+
+	setupReplies := func(t *testing.T) *mailertest.Server {
+		setupTests()
+		api.config.ReplyDomain = "reply.example.com"
+		// topical-reply has no templates, so replies must never render one
+		api.templates = nil
+		relay := enableDigests(t)
+
+		testStorage.GetDigestsByEmailFunc = func(email string) ([]models.Digest, error) {
+			if email != "jk@example.com" {
+				return []models.Digest{}, nil
+			}
+
+			return []models.Digest{{RecipientKey: "other"}, {RecipientKey: "recipient", Email: email}}, nil
+		}
+		testStorage.GetLatestAuthorFunc = func(authorKey string) (*models.Message, error) {
+			return &models.Message{AuthorInitials: "JK", AuthorTheme: 3, AuthorTripcode: "TRIP", AuthorKey: authorKey}, nil
+		}
+
+		return relay
+	}
+
+	t.Run("posts replies as the digest recipient", func(t *testing.T) {
+		relay := setupReplies(t)
+		defer relay.Close()
+		var posted *models.Message
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			posted = m
+			return m, nil
+		}
+
+		err := api.ReceiveReply(reply("JK <jk@example.com>", api.digests.ReplyAddress("recipient", 7), "Agreed!\r\n\r\nOn Mon, Topical wrote:\r\n> Earlier\r\n"))
+
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if posted == nil || *posted.TopicID != 7 || posted.Content != "Agreed!" || posted.AuthorKey != "recipient" {
+			t.Fatalf("got posted message %+v", posted)
+		}
+
+		if posted.AuthorInitials != "JK" || posted.AuthorTheme != 3 || posted.AuthorTripcode != "TRIP" || posted.Status != "approved" {
+			t.Errorf("expected reply to be posted under the recipient's identity, got %+v", posted)
+		}
+	})
+
+	t.Run("rejects replies from other senders", func(t *testing.T) {
+		relay := setupReplies(t)
+		defer relay.Close()
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			t.Error("expected no message to be posted")
+			return m, nil
+		}
+
+		err := api.ReceiveReply(reply("someone@example.com", api.digests.ReplyAddress("recipient", 7), "Hi"))
+
+		if _, ok := err.(*ReplyError); !ok {
+			t.Errorf("got error %v but wanted a ReplyError", err)
+		}
+
+		err = api.ReceiveReply(reply("jk@example.com", "reply+8-"+strings.Repeat("0", 20)+"@reply.example.com", "Hi"))
+
+		if _, ok := err.(*ReplyError); !ok {
+			t.Errorf("got error %v but wanted a ReplyError for a forged address", err)
+		}
+	})
+
+	t.Run("rejects replies the content filter rejects", func(t *testing.T) {
+		relay := setupReplies(t)
+		defer relay.Close()
+
+		err := api.ReceiveReply(reply("jk@example.com", api.digests.ReplyAddress("recipient", 7), strings.Repeat("a", 101)))
+
+		if _, ok := err.(*ReplyError); !ok {
+			t.Errorf("got error %v but wanted a ReplyError", err)
+		}
+	})
+
+	t.Run("drops automatic replies", func(t *testing.T) {
+		relay := setupReplies(t)
+		defer relay.Close()
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			t.Error("expected no message to be posted")
+			return m, nil
+		}
+
+		raw := "From: jk@example.com\r\nTo: " + api.digests.ReplyAddress("recipient", 7) + "\r\nAuto-Submitted: auto-replied\r\n\r\nOut of office"
+
+		if err := api.ReceiveReply(strings.NewReader(raw)); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("fails without rendering templates when posting fails or is held", func(t *testing.T) {
+		relay := setupReplies(t)
+		defer relay.Close()
+		api.config.PreModeration = true
+
+		testStorage.HasApprovedFunc = func(authorKey string) (bool, error) {
+			return false, nil
+		}
+
+		if err := api.ReceiveReply(reply("jk@example.com", api.digests.ReplyAddress("recipient", 7), "casino")); err != nil {
+			t.Errorf("unexpected error %v holding a reply", err)
+		}
+
+		testStorage.CreateMessageFunc = func(m *models.Message) (*models.Message, error) {
+			return nil, errors.New("something went wrong creating message")
+		}
+
+		if err := api.ReceiveReply(reply("jk@example.com", api.digests.ReplyAddress("recipient", 7), "Hi")); err == nil {
+			t.Error("expected an error when the message can't be created")
+		}
+	})
+
+	t.Run("is disabled without a reply domain", func(t *testing.T) {
+		setupTests()
+		api.templates = nil
+
+		if _, ok := api.ReceiveReply(reply("jk@example.com", "reply+7-abc@reply.example.com", "Hi")).(*ReplyError); !ok {
+			t.Error("expected a ReplyError")
+		}
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Run("redirects to moderator login if not a moderator", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/webhooks", nil)
+		res := httptest.NewRecorder()
+
+		api.WebhookList(res, req)
+
+		assertRedirect("/moderation/login", t, res)
+	})
+
+	t.Run("renders webhooks and the delivery log", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/moderation/webhooks", nil)
+		res := httptest.NewRecorder()
+		api.session.SetModerator(true, req, res)
+		webhookID, deliveryID, messageID, topicID := 2, 9, 7, 3
+		hook := models.Webhook{ID: &webhookID, URL: "https://example.com/hook", Secret: "s3cret"}
+
+		testStorage.GetWebhooksFunc = func() ([]models.Webhook, error) {
+			return []models.Webhook{hook}, nil
+		}
+		testStorage.GetDeliveriesFunc = func(limit int) ([]models.WebhookDelivery, error) {
+			return []models.WebhookDelivery{{
+				ID:           &deliveryID,
+				Webhook:      &hook,
+				Message:      &models.Message{ID: &messageID, TopicID: &topicID},
+				Event:        "message.created",
+				Status:       "failed",
+				Attempts:     6,
+				ResponseCode: 500,
+				Error:        "responded 500 Internal Server Error",
+			}}, nil
+		}
+
+		api.WebhookList(res, req)
+		body := res.Body.String()
+
+		for _, want := range []string{"https://example.com/hook", "s3cret", "responded 500", "action=\"/moderation/webhooks/deliveries/9\""} {
+			if strings.Contains(body, want) == false {
+				t.Errorf("response body should include %q", want)
+			}
+		}
+	})
+
+	t.Run("adds webhooks with a secret", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/webhooks?url=https://example.com/hook", nil)
+		res := httptest.NewRecorder()
+		api.session.SetModerator(true, req, res)
+		var got *models.Webhook
+
+		testStorage.CreateWebhookFunc = func(w *models.Webhook) (*models.Webhook, error) {
+			got = w
+			return w, nil
+		}
+
+		api.WebhookCreate(res, req)
+
+		if got == nil || got.URL != "https://example.com/hook" || len(got.Secret) != 64 {
+			t.Errorf("unexpected webhook %+v", got)
+		}
+
+		assertRedirect("/moderation/webhooks", t, res)
+	})
+
+	t.Run("rejects URLs which aren't http or https", func(t *testing.T) {
+		for _, endpoint := range []string{"", "ftp://example.com", "example.com/hook", "https://"} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/moderation/webhooks?url="+url.QueryEscape(endpoint), nil)
+			res := httptest.NewRecorder()
+			api.session.SetModerator(true, req, res)
+			called := false
+
+			testStorage.CreateWebhookFunc = func(w *models.Webhook) (*models.Webhook, error) {
+				called = true
+				return w, nil
+			}
+
+			api.WebhookCreate(res, req)
+
+			if called {
+				t.Errorf("webhook %q should not be created", endpoint)
+			}
+
+			assertRedirect("/moderation/webhooks", t, res)
+		}
+	})
+
+	t.Run("removes webhooks", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/webhooks/2?action=delete", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "2"})
+		api.session.SetModerator(true, req, res)
+		got := 0
+
+		testStorage.DeleteWebhookFunc = func(id int) error {
+			got = id
+			return nil
+		}
+
+		api.WebhookUpdate(res, req)
+
+		if got != 2 {
+			t.Errorf("got webhook %d but wanted 2", got)
+		}
+
+		assertRedirect("/moderation/webhooks", t, res)
+	})
+
+	t.Run("retries deliveries", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/moderation/webhooks/deliveries/9?action=retry", nil)
+		res := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{"id": "9"})
+		api.session.SetModerator(true, req, res)
+		got := 0
+
+		testStorage.RetryDeliveryFunc = func(id int) error {
+			got = id
+			return nil
+		}
+
+		api.WebhookDeliveryUpdate(res, req)
+
+		if got != 9 {
+			t.Errorf("got delivery %d but wanted 9", got)
+		}
+
+		assertRedirect("/moderation/webhooks#deliveries", t, res)
+	})
+
+	t.Run("only moderators change webhooks", func(t *testing.T) {
+		setupTests()
+		called := false
+
+		testStorage.DeleteWebhookFunc = func(id int) error {
+			called = true
+			return nil
+		}
+		testStorage.RetryDeliveryFunc = func(id int) error {
+			called = true
+			return nil
+		}
+
+		for _, handler := range []http.HandlerFunc{api.WebhookCreate, api.WebhookUpdate, api.WebhookDeliveryUpdate} {
+			req := httptest.NewRequest(http.MethodPost, "/moderation/webhooks/2?action=delete&url=https://example.com", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "2"})
+			res := httptest.NewRecorder()
+
+			handler(res, req)
+
+			assertRedirect("/moderation/login", t, res)
+		}
+
+		if called {
+			t.Error("webhooks should not be changed")
+		}
+	})
+}
+
+func TestReactions(t *testing.T) {
+	// message is a message visible in topic 3
+	message := func(id int, v storage.Viewer) (*models.Message, error) {
+		topicID := 3
+		return &models.Message{ID: &id, TopicID: &topicID}, nil
+	}
+
+	t.Run("toggles reactions and returns to the message", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reactions?emoji="+url.QueryEscape("👍"), nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+		testStorage.GetMessageFunc = message
+		var got string
+
+		testStorage.ToggleReactionFunc = func(messageID int, reactorKey string, emoji string) error {
+			if messageID == 7 && reactorKey != "" {
+				got = emoji
+			}
+
+			return nil
+		}
+
+		api.ReactionUpdate(res, req)
+
+		if got != "👍" {
+			t.Errorf("got reaction %q but wanted 👍", got)
+		}
+
+		assertRedirect("/topics/3#message-7", t, res)
+	})
+
+	t.Run("responds with the message's reactions when asked for JSON", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reactions?emoji="+url.QueryEscape("🎉"), nil)
+		req.Header.Set("Accept", "application/json")
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+		testStorage.GetMessageFunc = message
+
+		testStorage.GetReactionsFunc = func(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error) {
+			return map[int][]models.Reaction{7: {{Emoji: "🎉", Count: 2, Reacted: true}}}, nil
+		}
+
+		api.ReactionUpdate(res, req)
+
+		want := `{"message_id":7,"reactions":[{"emoji":"🎉","count":2,"reacted":true}]}`
+
+		if got := strings.TrimSpace(res.Body.String()); got != want {
+			t.Errorf("got %s but wanted %s", got, want)
+		}
+	})
+
+	t.Run("rejects reactions which aren't configured, to unknown messages, or without joining", func(t *testing.T) {
+		for name, c := range map[string]struct {
+			emoji   string
+			join    bool
+			message func(id int, v storage.Viewer) (*models.Message, error)
+			status  int
+		}{
+			"unknown emoji":   {"💩", true, message, http.StatusBadRequest},
+			"unknown message": {"👍", true, func(id int, v storage.Viewer) (*models.Message, error) { return nil, storage.ErrMessageNotFound }, http.StatusNotFound},
+			"not joined":      {"👍", false, message, http.StatusUnauthorized},
+		} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/topics/3/messages/7/reactions?emoji="+url.QueryEscape(c.emoji), nil)
+			req.Header.Set("Accept", "application/json")
+			res := httptest.NewRecorder()
+
+			if c.join {
+				api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+			}
+
+			req = mux.SetURLVars(req, map[string]string{"id": "3", "messageID": "7"})
+			testStorage.GetMessageFunc = c.message
+			called := false
+
+			testStorage.ToggleReactionFunc = func(messageID int, reactorKey string, emoji string) error {
+				called = true
+				return nil
+			}
+
+			api.ReactionUpdate(res, req)
+
+			if called {
+				t.Errorf("%s: reaction should not be saved", name)
+			}
+
+			if res.Code != c.status {
+				t.Errorf("%s: got status %d but wanted %d", name, res.Code, c.status)
+			}
+		}
+	})
+
+	t.Run("renders reaction counts and choices in message footers", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/3", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+		messageID := 7
+
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+			return &models.Topic{ID: &id, Title: "Reactions", Messages: &[]models.Message{
+				{ID: &messageID, AuthorInitials: "JK", Content: "first", Reactions: []models.Reaction{{Emoji: "👍", Count: 3, Reacted: true}}},
+			}}, nil
+		}
+
+		api.TopicShow(res, req)
+		body := res.Body.String()
+
+		for _, want := range []string{
+			`class="reaction reaction-reacted">👍 3</button>`,
+			`value="🎉" class="reaction">🎉</button>`,
+			`action="/topics/3/messages/7/reactions"`,
+			`src="/static/reactions.js"`,
+		} {
+			if strings.Contains(body, want) == false {
+				t.Errorf("response body should include %q", want)
+			}
+		}
+	})
+}
+
+func TestPolls(t *testing.T) {
+	// poll returns an open single choice poll in topic 3 asked by authorKey
+	poll := func(authorKey string) *models.Poll {
+		id, first, second := 5, 11, 12
+		return &models.Poll{ID: &id, Question: "Best bird?", AuthorKey: authorKey, Options: []models.PollOption{
+			{ID: &first, Label: "Heron", Votes: 3, Percent: 75, Chosen: true},
+			{ID: &second, Label: "Wren", Votes: 1, Percent: 25},
+		}, Voters: 4, Voted: true}
+	}
+
+	t.Run("creates a poll with a new topic", func(t *testing.T) {
+		setupTests()
+		form := url.Values{"title": {"Birds"}, "content": {"Vote!"}, "poll_question": {"Best bird?"}, "poll_options": {"Heron\r\nWren\r\nHeron\r\n"}, "poll_multiple": {"1"}}
+		req := httptest.NewRequest(http.MethodPost, "/topics?"+form.Encode(), nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		topicID := 321
+		var got *models.Poll
+
+		testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+			return &models.Topic{ID: &topicID, Title: title, Messages: &[]models.Message{}}, nil
+		}
+
+		testStorage.CreatePollFunc = func(p *models.Poll) (*models.Poll, error) {
+			got = p
+			return p, nil
+		}
+
+		api.TopicCreate(res, req)
+
+		if got == nil || *got.TopicID != topicID || got.AuthorKey == "" || got.Multiple == false || len(got.Options) != 2 {
+			t.Errorf("unexpected poll %+v", got)
+		}
+	})
+
+	t.Run("rejects polls without enough options or closing in the past", func(t *testing.T) {
+		for name, form := range map[string]url.Values{
+			"one option":  {"poll_question": {"Best bird?"}, "poll_options": {"Heron\nHeron"}},
+			"no question": {"poll_options": {"Heron\nWren"}},
+			"past close":  {"poll_question": {"Best bird?"}, "poll_options": {"Heron\nWren"}, "poll_closes": {"2001-01-01T09:00"}},
+		} {
+			setupTests()
+			form.Set("title", "Birds")
+			form.Set("content", "Vote!")
+			req := httptest.NewRequest(http.MethodPost, "/topics?"+form.Encode(), nil)
+			res := httptest.NewRecorder()
+			api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+			called := false
+
+			testStorage.CreateTopicFunc = func(title string) (*models.Topic, error) {
+				called = true
+				return nil, errors.New("should not be called")
+			}
+
+			api.TopicCreate(res, req)
+
+			if called {
+				t.Errorf("%s: topic should not have been created", name)
+			}
+
+			assertRedirect("/topics/new", t, res)
+		}
+	})
+
+	t.Run("renders the poll's results and voting form", func(t *testing.T) {
+		setupTests()
+		req := httptest.NewRequest(http.MethodGet, "/topics/3", nil)
+		res := httptest.NewRecorder()
+		api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+		req = mux.SetURLVars(req, map[string]string{"id": "3"})
+
+		testStorage.GetTopicFunc = func(id int, v storage.Viewer) (*models.Topic, error) {
+			return &models.Topic{ID: &id, Title: "Birds", Messages: &[]models.Message{}}, nil
+		}
+
+		testStorage.GetPollFunc = func(topicID int, v storage.Viewer) (*models.Poll, error) {
+			return poll(v.ReaderKey), nil
+		}
+
+		api.TopicShow(res, req)
+		body := res.Body.String()
+
+		for _, want := range []string{"Best bird?", `<rect class="poll-bar-fill" width="75"`, `type="radio" name="option" value="11" checked`, "Change vote", `value="close"`} {
+			if strings.Contains(body, want) == false {
+				t.Errorf("response body should include %q", want)
+			}
+		}
+	})
+
+	t.Run("records votes for the poll's options", func(t *testing.T) {
+		for name, c := range map[string]struct {
+			options []string
+			want    []int
+		}{
+			"one option":      {[]string{"12"}, []int{12}},
+			"unknown option":  {[]string{"99"}, nil},
+			"several options": {[]string{"11", "12"}, nil},
+		} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/topics/3/poll/votes?"+url.Values{"option": c.options}.Encode(), nil)
+			res := httptest.NewRecorder()
+			api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+			req = mux.SetURLVars(req, map[string]string{"id": "3"})
+			var got []int
+
+			testStorage.GetPollFunc = func(topicID int, v storage.Viewer) (*models.Poll, error) {
+				return poll(""), nil
+			}
+
+			testStorage.VoteFunc = func(pollID int, voterKey string, optionIDs []int) error {
+				if pollID == 5 && voterKey != "" {
+					got = optionIDs
+				}
+
+				return nil
+			}
+
+			api.VoteCreate(res, req)
+
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("%s: got vote %v but wanted %v", name, got, c.want)
+			}
+
+			assertRedirect("/topics/3#poll", t, res)
+		}
+	})
+
+	t.Run("lets only the poll's author close it", func(t *testing.T) {
+		for name, author := range map[string]bool{"author": true, "someone else": false} {
+			setupTests()
+			req := httptest.NewRequest(http.MethodPost, "/topics/3/poll?action=close", nil)
+			res := httptest.NewRecorder()
+			api.session.SaveUser(&models.User{Initials: "AK", Theme: 3}, req, res)
+			req = mux.SetURLVars(req, map[string]string{"id": "3"})
+			closed := false
+
+			testStorage.GetPollFunc = func(topicID int, v storage.Viewer) (*models.Poll, error) {
+				if author {
+					return poll(v.ReaderKey), nil
+				}
+
+				return poll("someone-else"), nil
+			}
+
+			testStorage.SetPollClosedFunc = func(pollID int, c bool) error {
+				closed = c
+				return nil
+			}
+
+			api.PollUpdate(res, req)
+
+			if closed != author {
+				t.Errorf("%s: got closed %v but wanted %v", name, closed, author)
+			}
+
+			assertRedirect("/topics/3#poll", t, res)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// authorIdentity returns a string identifying the user across sessions:
+// their account, or the secret they were given when joining anonymously
+func (api *TopicalAPI) authorIdentity(w http.ResponseWriter, r *http.Request, user *models.User) (string, error) {
+	switch {
+	case user.ID != nil:
+		return fmt.Sprintf("account:%d", *user.ID), nil
+	case user.TripSecret != "":
+		return "anonymous:" + user.TripSecret, nil
+	}
+
+	// Users who joined before trip secrets existed fall back to their session
+	id, err := api.session.GetID(r, w)
+
+	if err != nil {
+		return "", err
+	}
+
+	return "session:" + id, nil
+}
+
+// authorKey returns the identifier stored with the user's messages, so they
+// can later export or erase them. Unlike tripcodes it isn't keyed with the
+// session key, so it stays the same when keys are rotated.
+func (api *TopicalAPI) authorKey(w http.ResponseWriter, r *http.Request, user *models.User) (string, error) {
+	identity, err := api.authorIdentity(w, r, user)
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte("author:" + identity))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// currentAuthorKey returns the author key of the user posting from the
+// current session
+func (api *TopicalAPI) currentAuthorKey(w http.ResponseWriter, r *http.Request) (string, error) {
+	user, err := api.currentUser(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	return api.authorKey(w, r, user)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/jkulton/topical/internal/filter"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// filterSessionID identifies reports filed by the content filter rather than a reader
+const filterSessionID = "content-filter"
+
+// checkContent runs each posted text through the content filter, returning
+// the most severe verdict
+func (api *TopicalAPI) checkContent(texts ...string) filter.Verdict {
+	verdict := filter.Verdict{Action: filter.Allow}
+
+	for _, text := range texts {
+		if v := api.filter.Check(text); v.Action > verdict.Action {
+			verdict = v
+		}
+	}
+
+	return verdict
+}
+
+// holdForReview files a report for a message held by the content filter,
+// placing it in the moderator queue
+func (api *TopicalAPI) holdForReview(m *models.Message, reason string) error {
+	report := models.Report{
+		MessageID: m.ID,
+		Reason:    "spam",
+		Details:   "Held by content filter: " + reason,
+		SessionID: filterSessionID,
+	}
+
+	_, err := api.storage.CreateReport(&report)
+	return err
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// maxCSPReportSize caps how much of a violation report is read and logged
+const maxCSPReportSize = 16 * 1024
+
+// CSPReportCreate collects Content-Security-Policy violation reports sent by browsers
+func (api *TopicalAPI) CSPReportCreate(w http.ResponseWriter, r *http.Request) {
+	report, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+
+	if err != nil {
+		log.Print("Error reading CSP report", err.Error())
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	log.Printf("CSP violation: %s", report)
+	w.WriteHeader(http.StatusNoContent)
+}
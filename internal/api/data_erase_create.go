@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// DataEraseCreate deletes or anonymizes every message the current user has posted
+func (api *TopicalAPI) DataEraseCreate(w http.ResponseWriter, r *http.Request) {
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to manage your settings", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	mode := r.FormValue("mode")
+
+	if _, ok := eraseModes[mode]; !ok {
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	count, err := api.storage.EraseMessagesByAuthorKey(authorKey, mode == "anonymize")
+
+	if err != nil {
+		log.Print("Error erasing author messages", err.Error())
+		api.session.SaveFlash("Error erasing your messages", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if mode == "anonymize" {
+		api.session.SaveFlash(fmt.Sprintf("Anonymized %d messages", count), r, w)
+	} else {
+		api.session.SaveFlash(fmt.Sprintf("Deleted %d messages", count), r, w)
+	}
+
+	http.Redirect(w, r, "/settings", 302)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// eraseModes are the ways a user may erase their messages, with the
+// confirmation shown for each
+var eraseModes = map[string]string{
+	"delete":    "Delete my messages",
+	"anonymize": "Anonymize my messages",
+}
+
+// DataEraseShow asks the current user to confirm erasing their messages
+func (api *TopicalAPI) DataEraseShow(w http.ResponseWriter, r *http.Request) {
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to manage your settings", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	action, ok := eraseModes[mode]
+
+	if !ok {
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	messages, err := api.storage.GetMessagesByAuthorKey(authorKey)
+
+	if err != nil {
+		log.Print("Error getting author messages", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Mode         string
+		Action       string
+		MessageCount int
+	}{api.newPage(w, r), mode, action, len(messages)}
+
+	api.templates.ExecuteTemplate(w, "data-erase", payload)
+}
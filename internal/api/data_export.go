@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// exportedMessage is a message as written to a JSON data export
+type exportedMessage struct {
+	ID             int            `json:"id"`
+	TopicID        int            `json:"topic_id"`
+	TopicTitle     string         `json:"topic_title"`
+	Content        string         `json:"content"`
+	AuthorInitials string         `json:"author_initials"`
+	AuthorTheme    int            `json:"author_theme"`
+	AuthorTripcode string         `json:"author_tripcode,omitempty"`
+	Posted         time.Time      `json:"posted"`
+	Status         string         `json:"status"`
+	Hidden         bool           `json:"hidden"`
+	Reactions      []reactionJSON `json:"reactions"`
+}
+
+// DataExport sends the current user every message they've posted, as a
+// JSON or Markdown download chosen by the format param
+func (api *TopicalAPI) DataExport(w http.ResponseWriter, r *http.Request) {
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to manage your settings", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	format := r.FormValue("format")
+
+	if format != "json" && format != "markdown" {
+		api.session.SaveFlash("Unknown export format", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	messages, err := api.storage.GetMessagesByAuthorKey(authorKey)
+
+	if err != nil {
+		log.Print("Error getting author messages", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if format == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="topical-messages.md"`)
+		writeMarkdownExport(w, messages)
+		return
+	}
+
+	exported := make([]exportedMessage, 0, len(messages))
+
+	for _, m := range messages {
+		exported = append(exported, exportedMessage{
+			ID:             *m.ID,
+			TopicID:        *m.TopicID,
+			TopicTitle:     m.TopicTitle,
+			Content:        m.Content,
+			AuthorInitials: m.AuthorInitials,
+			AuthorTheme:    m.AuthorTheme,
+			AuthorTripcode: m.AuthorTripcode,
+			Posted:         m.Posted,
+			Status:         m.Status,
+			Hidden:         m.Hidden,
+			Reactions:      reactionsJSON(m.Reactions),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="topical-messages.json"`)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(exported); err != nil {
+		log.Print("Error writing export", err.Error())
+	}
+}
+
+// writeMarkdownExport writes messages as a Markdown document, one section per message
+func writeMarkdownExport(w io.Writer, messages []models.Message) {
+	fmt.Fprintf(w, "# Topical messages\n\nExported %s, %d messages.\n", time.Now().UTC().Format("Jan 02, 2006 15:04 MST"), len(messages))
+
+	for _, m := range messages {
+		fmt.Fprintf(w, "\n---\n\n## %s\n\n", m.TopicTitle)
+		fmt.Fprintf(w, "Posted %s as %s, /topics/%d#message-%d", m.Posted.Format("Jan 02, 2006 15:04 MST"), m.AuthorInitials, *m.TopicID, *m.ID)
+
+		if m.Hidden {
+			fmt.Fprint(w, " (hidden)")
+		} else if m.Status != "approved" {
+			fmt.Fprintf(w, " (%s)", m.Status)
+		}
+
+		fmt.Fprintf(w, "\n\n%s\n", m.Content)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// DigestConfirm confirms the email a digest is sent to, from the signed
+// link emailed to it
+func (api *TopicalAPI) DigestConfirm(w http.ResponseWriter, r *http.Request) {
+	if api.digests == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.FormValue("key")
+	email := r.FormValue("email")
+
+	if !api.digests.VerifyConfirm(key, email, r.FormValue("sig")) {
+		api.session.SaveFlash("This confirmation link is invalid", r, w)
+		http.Redirect(w, r, "/", 302)
+		return
+	}
+
+	confirmed, err := api.storage.ConfirmDigest(key, email)
+
+	if err != nil {
+		log.Print("Error confirming digest", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if !confirmed {
+		api.session.SaveFlash("This confirmation link has expired", r, w)
+		http.Redirect(w, r, "/", 302)
+		return
+	}
+
+	api.session.SaveFlash("Email digests confirmed", r, w)
+	http.Redirect(w, r, "/", 302)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// DigestUnsubscribeCreate turns off a digest given a signed unsubscribe
+// link. Mail clients offering one-click unsubscribe post to the link
+// directly, so the link's signature stands in for a CSRF token.
+func (api *TopicalAPI) DigestUnsubscribeCreate(w http.ResponseWriter, r *http.Request) {
+	if api.digests == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.FormValue("key")
+
+	if !api.digests.VerifyUnsubscribe(key, r.FormValue("sig")) {
+		http.Error(w, "Forbidden - invalid unsubscribe link", http.StatusForbidden)
+		return
+	}
+
+	if err := api.storage.DeleteDigest(key); err != nil {
+		log.Print("Error deleting digest", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("You've been unsubscribed from email digests", r, w)
+	http.Redirect(w, r, "/", 302)
+}
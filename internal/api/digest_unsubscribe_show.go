@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+)
+
+// DigestUnsubscribeShow asks to confirm turning off a digest, from the
+// signed link in every digest. Unsubscribing takes a POST so link scanners
+// opening the page don't unsubscribe anyone.
+func (api *TopicalAPI) DigestUnsubscribeShow(w http.ResponseWriter, r *http.Request) {
+	if api.digests == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.FormValue("key")
+	sig := r.FormValue("sig")
+
+	if !api.digests.VerifyUnsubscribe(key, sig) {
+		api.session.SaveFlash("This unsubscribe link is invalid", r, w)
+		http.Redirect(w, r, "/", 302)
+		return
+	}
+
+	payload := struct {
+		page
+		Key string
+		Sig string
+	}{api.newPage(w, r), key, sig}
+
+	api.templates.ExecuteTemplate(w, "digest-unsubscribe", payload)
+}
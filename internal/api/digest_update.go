@@ -0,0 +1,103 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// digestFrequencies are how often a user may be sent email digests
+var digestFrequencies = []string{"daily", "weekly"}
+
+// confirmationInterval is how long to wait before emailing another digest
+// confirmation to the same user or address
+const confirmationInterval = 10 * time.Minute
+
+// DigestUpdate sets, changes, or turns off the current user's email digest,
+// emailing a confirmation link whenever the address needs confirming
+func (api *TopicalAPI) DigestUpdate(w http.ResponseWriter, r *http.Request) {
+	if api.digests == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to get email digests", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	frequency := r.FormValue("frequency")
+
+	if frequency == "off" {
+		if err := api.storage.DeleteDigest(authorKey); err != nil {
+			log.Print("Error deleting digest", err.Error())
+			api.session.SaveFlash("Error turning off email digests", r, w)
+		} else {
+			api.session.SaveFlash("Email digests turned off", r, w)
+		}
+
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if !oneOf(frequency, digestFrequencies) {
+		api.session.SaveFlash("Please choose from the options given", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	address, err := mail.ParseAddress(strings.TrimSpace(r.FormValue("email")))
+
+	if err != nil || address.Name != "" {
+		api.session.SaveFlash("Please enter a valid email address", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	digest, err := api.storage.SaveDigest(&models.Digest{RecipientKey: authorKey, Email: address.Address, Frequency: frequency})
+
+	if err != nil {
+		log.Print("Error saving digest", err.Error())
+		api.session.SaveFlash("Error saving email digest", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if digest.Confirmed {
+		api.session.SaveFlash("Email digest saved", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	claimed, err := api.storage.ClaimDigestConfirmation(authorKey, confirmationInterval)
+
+	if err != nil {
+		log.Print("Error claiming digest confirmation", err.Error())
+		api.session.SaveFlash("Error saving email digest", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if !claimed {
+		api.session.SaveFlash("A confirmation email was sent recently, please check your inbox or try again later", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if err := api.digests.SendConfirmation(*digest); err != nil {
+		log.Print("Error sending digest confirmation", err.Error())
+		api.session.SaveFlash("Error sending confirmation email, please try again later", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	api.session.SaveFlash("Check your email for a link to confirm digests", r, w)
+	http.Redirect(w, r, "/settings", 302)
+}
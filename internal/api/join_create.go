@@ -4,35 +4,47 @@ import (
 	"github.com/jkulton/topical/internal/models"
 	"log"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
 // JoinCreate accepts a payload of user info and saves the user in a session
 func (t *TopicalAPI) JoinCreate(w http.ResponseWriter, r *http.Request) {
-	initials := strings.ToUpper(r.FormValue("initials"))
-	matched, err := regexp.Match("^[A-Z]{2}$", []byte(initials))
+	if t.config.Anonymous == false {
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
 
-	if err != nil {
-		log.Print("Error creating user", err.Error())
+	if err := t.checkChallenge(r); err != nil {
+		log.Print("Join failed anti-bot check: ", err.Error())
+		t.session.SaveFlash(challengeFailedFlash, r, w)
 		http.Redirect(w, r, "/join", 302)
+		return
 	}
 
-	if matched == false {
+	initials := strings.ToUpper(r.FormValue("initials"))
+
+	if !models.ValidInitials(initials) {
 		http.Redirect(w, r, "/join", 302)
 		return
 	}
 
 	theme, err := strconv.Atoi(r.FormValue("theme"))
 
+	if err != nil || !models.ValidTheme(theme) {
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	secret, err := newTripSecret()
+
 	if err != nil {
 		log.Print("Error creating user", err.Error())
 		http.Redirect(w, r, "/join", 302)
 		return
 	}
 
-	u := &models.User{Initials: initials, Theme: theme}
+	u := &models.User{Initials: initials, Theme: theme, TripSecret: secret}
 
 	if err := t.session.SaveUser(u, r, w); err != nil {
 		log.Print("Error creating user", err.Error())
@@ -1,12 +1,13 @@
 package api
 
 import (
+	"log"
 	"net/http"
 )
 
-// JoinShow renders the page allowing a user to log in
+// JoinShow renders the page allowing a user to join anonymously, log in, or register
 func (t *TopicalAPI) JoinShow(w http.ResponseWriter, r *http.Request) {
-	user, _ := t.session.GetUser(r)
+	user, _ := t.currentUser(r)
 
 	// Redirect to homepage if user exists
 	if user != nil {
@@ -14,5 +15,20 @@ func (t *TopicalAPI) JoinShow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	t.templates.ExecuteTemplate(w, "join", nil)
+	challenge, err := t.newChallenge()
+
+	if err != nil {
+		log.Print("Error issuing challenge", err.Error())
+		t.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Challenge *challengeForm
+		Anonymous bool
+		SSO       bool
+	}{t.newPage(w, r), challenge, t.config.Anonymous, t.oidc != nil}
+
+	t.templates.ExecuteTemplate(w, "join", payload)
 }
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jkulton/topical/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when no account matches a handle, so
+// failed logins take as long whether or not the handle exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("topical-dummy-password"), bcrypt.DefaultCost)
+
+// LoginCreate checks a submitted handle and password, logging the session
+// in to the matching account
+func (api *TopicalAPI) LoginCreate(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimSpace(r.FormValue("handle"))
+	password := r.FormValue("password")
+
+	user, hash, err := api.storage.GetUserCredentials(handle)
+
+	if err != nil && err != storage.ErrUserNotFound {
+		log.Print("Error getting user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if err == storage.ErrUserNotFound {
+		hash = string(dummyHash)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil || user == nil {
+		api.session.SaveFlash("Incorrect handle or password", r, w)
+		http.Redirect(w, r, "/login", 302)
+		return
+	}
+
+	if err := api.session.SaveUserID(*user.ID, r, w); err != nil {
+		log.Print("Error saving user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/topics", 302)
+}
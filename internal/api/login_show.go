@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+)
+
+// LoginShow renders the form for logging in to an account
+func (api *TopicalAPI) LoginShow(w http.ResponseWriter, r *http.Request) {
+	if _, err := api.session.GetUserID(r); err == nil {
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	payload := struct {
+		page
+		SSO bool
+	}{api.newPage(w, r), api.oidc != nil}
+
+	api.templates.ExecuteTemplate(w, "login", payload)
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// LogoutCreate removes the account or anonymous user from the session
+func (api *TopicalAPI) LogoutCreate(w http.ResponseWriter, r *http.Request) {
+	if err := api.session.ClearUser(r, w); err != nil {
+		log.Print("Error clearing user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/topics", 302)
+}
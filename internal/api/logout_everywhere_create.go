@@ -0,0 +1,33 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/session"
+)
+
+// LogoutEverywhereCreate ends every session logged in to the current account
+func (api *TopicalAPI) LogoutEverywhereCreate(w http.ResponseWriter, r *http.Request) {
+	if _, err := api.session.GetUserID(r); err != nil {
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	err := api.session.LogoutEverywhere(r, w)
+
+	if err == session.ErrRevokeUnsupported {
+		api.session.SaveFlash("Logging out everywhere isn't available on this server", r, w)
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	if err != nil {
+		log.Print("Error logging out everywhere", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("You have been logged out on every device", r, w)
+	http.Redirect(w, r, "/topics", 302)
+}
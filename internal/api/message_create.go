@@ -7,12 +7,11 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 // MessageCreate accepts a form POST, creating a message within a given Topic
 func (api *TopicalAPI) MessageCreate(w http.ResponseWriter, r *http.Request) {
-	user, err := api.session.GetUser(r)
+	user, err := api.currentUser(r)
 
 	if err != nil {
 		api.session.SaveFlash("Please join to create a message", r, w)
@@ -29,28 +28,66 @@ func (api *TopicalAPI) MessageCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content := strings.TrimSpace(r.FormValue("content"))
-	authorTheme := user.Theme
-	authorInitials := user.Initials
+	topicPath := fmt.Sprintf("/topics/%d", id)
 
-	if content == "" {
-		api.session.SaveFlash("Content cannot be blank", r, w)
-		http.Redirect(w, r, fmt.Sprintf("/topics/%d", id), 302)
+	// Replying from the threaded view returns to it
+	if r.FormValue("view") == "threaded" {
+		topicPath += "?view=threaded"
+	}
+
+	tripcode, err := api.tripcode(w, r, user)
+
+	if err != nil {
+		log.Print("Error getting tripcode", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	authorKey, err := api.authorKey(w, r, user)
+
+	if err != nil {
+		log.Print("Error getting author key", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
 		return
 	}
 
 	message := models.Message{
 		TopicID:        &id,
-		Content:        content,
-		AuthorTheme:    authorTheme,
-		AuthorInitials: authorInitials,
+		Content:        r.FormValue("content"),
+		AuthorTheme:    user.Theme,
+		AuthorInitials: user.Initials,
+		UserID:         user.ID,
+		AuthorTripcode: tripcode,
+		AuthorKey:      authorKey,
 	}
 
-	if _, err := api.storage.CreateMessage(&message); err != nil {
+	// Replies may only refer to messages their author can see in the topic
+	if replyTo := api.topicMessage(r.FormValue("reply_to"), id, api.viewer(w, r)); replyTo != nil {
+		message.ReplyToID = replyTo.ID
+	}
+
+	verdict, err := api.postMessage(&message)
+
+	switch {
+	case err == errBlankContent:
+		api.session.SaveFlash("Content cannot be blank", r, w)
+		http.Redirect(w, r, topicPath, 302)
+		return
+	case err == errRejected:
+		api.session.SaveFlash(verdict.Reason, r, w)
+		http.Redirect(w, r, topicPath, 302)
+		return
+	case err != nil:
 		api.session.SaveFlash("Error creating message", r, w)
 		http.Redirect(w, r, "/topics", 302)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/topics/%d", id), 302)
+	if message.Hidden {
+		api.session.SaveFlash("Your message will appear once a moderator has reviewed it", r, w)
+	} else if message.Status == "pending" {
+		api.session.SaveFlash("Your message is only visible to you until a moderator approves it", r, w)
+	}
+
+	http.Redirect(w, r, topicPath, 302)
 }
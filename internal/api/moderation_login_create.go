@@ -0,0 +1,33 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+)
+
+// ModerationLoginCreate checks a submitted moderator key, marking the session
+// as a moderator's if it matches the configured key
+func (api *TopicalAPI) ModerationLoginCreate(w http.ResponseWriter, r *http.Request) {
+	key := r.FormValue("key")
+
+	if api.config.ModeratorKey == "" {
+		api.session.SaveFlash("Moderation is not enabled", r, w)
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key), []byte(api.config.ModeratorKey)) != 1 {
+		api.session.SaveFlash("Invalid moderator key", r, w)
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	if err := api.session.SetModerator(true, r, w); err != nil {
+		log.Print("Error saving moderator", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/moderation/reports", 302)
+}
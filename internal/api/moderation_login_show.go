@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ModerationLoginShow renders the page allowing a moderator to log in
+func (api *TopicalAPI) ModerationLoginShow(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) {
+		http.Redirect(w, r, "/moderation/reports", 302)
+		return
+	}
+
+	api.templates.ExecuteTemplate(w, "moderation-login", api.newPage(w, r))
+}
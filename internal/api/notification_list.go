@@ -0,0 +1,42 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// notificationLimit is how many notifications the inbox shows
+const notificationLimit = 50
+
+// NotificationList renders the current user's notification inbox, marking
+// its notifications as read. Unread ones stay highlighted on this visit.
+func (api *TopicalAPI) NotificationList(w http.ResponseWriter, r *http.Request) {
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to get notifications", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	notifications, err := api.storage.GetNotifications(authorKey, notificationLimit)
+
+	if err != nil {
+		log.Print("Error getting notifications", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if err := api.storage.MarkNotificationsRead(authorKey); err != nil {
+		log.Print("Error marking notifications read", err.Error())
+	}
+
+	payload := struct {
+		page
+		Notifications []models.Notification
+	}{api.newPage(w, r), notifications}
+
+	api.templates.ExecuteTemplate(w, "notifications", payload)
+}
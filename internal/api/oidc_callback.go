@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/oidc"
+)
+
+var handleInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// OIDCCallback completes signing in with the identity provider, logging the
+// session in to the account linked to the provider's user
+func (api *TopicalAPI) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if api.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var saved loginState
+	j, err := api.session.PopLoginState(r, w)
+
+	if err == nil {
+		err = json.Unmarshal([]byte(j), &saved)
+	}
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(saved.State)) != 1 {
+		api.session.SaveFlash("Sign in failed, please try again", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	if r.FormValue("error") != "" {
+		api.session.SaveFlash("Sign in was cancelled", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	claims, err := api.oidc.Exchange(r.Context(), r.FormValue("code"), saved.Verifier, saved.Nonce)
+
+	if err != nil {
+		log.Print("Error completing sign in", err.Error())
+		api.session.SaveFlash("Sign in failed, please try again", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	user, err := api.storage.GetOrCreateExternalUser(claims.Issuer+"|"+claims.Subject, userFromClaims(claims))
+
+	if err != nil {
+		log.Print("Error getting user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if err := api.session.SaveUserID(*user.ID, r, w); err != nil {
+		log.Print("Error saving user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/topics", 302)
+}
+
+// userFromClaims maps identity provider claims to a new account. The handle
+// comes from the preferred username or email, initials from the first and
+// last names (or the handle), and the theme is picked from the subject so it
+// stays the same across sign ins.
+func userFromClaims(claims *oidc.Claims) *models.User {
+	handle := claims.PreferredUsername
+
+	if handle == "" {
+		handle = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	if handle == "" {
+		handle = claims.Name
+	}
+
+	handle = strings.Trim(handleInvalidChars.ReplaceAllString(handle, "_"), "_")
+
+	if len(handle) > 20 {
+		handle = handle[:20]
+	}
+
+	if handle == "" {
+		handle = "user"
+	}
+
+	for len(handle) < 3 {
+		handle += "_"
+	}
+
+	var letters []string
+
+	for _, word := range strings.Fields(strings.ToUpper(claims.Name)) {
+		if word[0] >= 'A' && word[0] <= 'Z' {
+			letters = append(letters, word[:1])
+		}
+	}
+
+	if len(letters) >= 2 {
+		letters = []string{letters[0], letters[len(letters)-1]}
+	} else {
+		letters = nil
+
+		for _, c := range strings.ToUpper(handle) {
+			if c >= 'A' && c <= 'Z' {
+				letters = append(letters, string(c))
+			}
+		}
+	}
+
+	initials := strings.Join(append(letters, "U", "S"), "")[:2]
+
+	if !models.ValidInitials(initials) {
+		initials = "US"
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(claims.Subject))
+
+	return &models.User{
+		Handle:   handle,
+		Initials: initials,
+		Theme:    int(h.Sum32()%models.Themes) + 1,
+	}
+}
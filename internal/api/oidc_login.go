@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/oidc"
+)
+
+// loginState is kept in the session while a user signs in with the
+// identity provider, tying the provider's response to this session
+type loginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// OIDCLogin starts signing in with the identity provider, redirecting to it
+func (api *TopicalAPI) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if api.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		log.Print("Error starting sign in", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		log.Print("Error starting sign in", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		log.Print("Error starting sign in", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	authURL, err := api.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Print("Error starting sign in", err.Error())
+		api.session.SaveFlash("Single sign-on is unavailable, please try again later", r, w)
+		http.Redirect(w, r, "/join", 302)
+		return
+	}
+
+	j, _ := json.Marshal(loginState{state, nonce, verifier})
+
+	if err := api.session.SaveLoginState(string(j), r, w); err != nil {
+		log.Print("Error saving sign in state", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, authURL, 302)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jkulton/topical/internal/middleware"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// page holds the data shared by every rendered page, page payloads embed it
+type page struct {
+	User              *models.User
+	Flashes           []string
+	CSRFToken         string
+	Nonce             string
+	Preferences       models.Preferences
+	NotificationCount int
+	location          *time.Location
+}
+
+// newPage gathers the shared page data for a request. Flashes are consumed
+// when read, so call it only once a handler has decided to render.
+func (api *TopicalAPI) newPage(w http.ResponseWriter, r *http.Request) page {
+	user, _ := api.currentUser(r)
+	notificationCount := 0
+
+	if user != nil {
+		if authorKey, err := api.authorKey(w, r, user); err == nil {
+			notificationCount, _ = api.storage.CountUnreadNotifications(authorKey)
+		}
+	}
+
+	flashes, _ := api.session.GetFlashes(r, w)
+	csrfToken, _ := api.session.GetCSRFToken(r, w)
+	preferences := api.session.GetPreferences(r)
+
+	return page{
+		User:              user,
+		Flashes:           flashes,
+		CSRFToken:         csrfToken,
+		Nonce:             middleware.CSPNonce(r),
+		Preferences:       preferences,
+		NotificationCount: notificationCount,
+		location:          location(preferences),
+	}
+}
+
+// FormatTime formats a timestamp in the visitor's preferred timezone and format
+func (p page) FormatTime(t time.Time) string {
+	layout, ok := dateFormats[p.Preferences.DateFormat]
+
+	if !ok {
+		layout = dateFormats[defaultDateFormat]
+	}
+
+	loc := p.location
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return t.In(loc).Format(layout)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/jkulton/topical/internal/models"
+	"log"
+	"net/http"
+)
+
+// PendingList renders the moderator queue of messages awaiting approval
+func (api *TopicalAPI) PendingList(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	messages, err := api.storage.GetPendingMessages()
+
+	if err != nil {
+		log.Print("Error getting pending messages", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Messages []models.Message
+	}{api.newPage(w, r), messages}
+
+	api.templates.ExecuteTemplate(w, "pending", payload)
+}
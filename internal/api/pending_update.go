@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// PendingUpdate accepts a moderator's approval or rejection of a pending message
+func (api *TopicalAPI) PendingUpdate(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	var status string
+
+	switch r.FormValue("action") {
+	case "approve":
+		status = "approved"
+	case "reject":
+		status = "rejected"
+	default:
+		api.session.SaveFlash("Unknown moderation action", r, w)
+		http.Redirect(w, r, "/moderation/pending", 302)
+		return
+	}
+
+	if err := api.storage.SetMessageStatus(id, status); err != nil {
+		log.Print("Error updating message status", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/moderation/pending", 302)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+const (
+	// maxPollOptions is how many options a poll may have
+	maxPollOptions = 10
+	// maxPollTextLength is how long, in characters, a poll's question and options may be
+	maxPollTextLength = 200
+	// pollClosesLayout is the format of datetime-local inputs
+	pollClosesLayout = "2006-01-02T15:04"
+)
+
+// parsePoll reads the poll a new topic's form asks for, one option per line,
+// with its close time in the reader's timezone. It returns nil if the form
+// doesn't ask for a poll, or the problem with the poll if it's invalid.
+func parsePoll(r *http.Request, loc *time.Location) (*models.Poll, string) {
+	question := strings.TrimSpace(r.FormValue("poll_question"))
+	poll := &models.Poll{Question: question, Multiple: r.FormValue("poll_multiple") != ""}
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(r.FormValue("poll_options"), "\n") {
+		label := strings.TrimSpace(line)
+
+		if label == "" || seen[label] {
+			continue
+		}
+
+		seen[label] = true
+		poll.Options = append(poll.Options, models.PollOption{Label: label})
+	}
+
+	if question == "" && len(poll.Options) == 0 {
+		return nil, ""
+	}
+
+	if question == "" || len(poll.Options) < 2 {
+		return nil, "Polls need a question and at least two options"
+	}
+
+	if len(poll.Options) > maxPollOptions {
+		return nil, "Polls may have at most 10 options"
+	}
+
+	for _, text := range pollTexts(poll) {
+		if len([]rune(text)) > maxPollTextLength {
+			return nil, "Poll questions and options may be at most 200 characters"
+		}
+	}
+
+	if closes := r.FormValue("poll_closes"); closes != "" {
+		t, err := time.ParseInLocation(pollClosesLayout, closes, loc)
+
+		if err != nil || t.Before(time.Now()) {
+			return nil, "Poll close times must be in the future"
+		}
+
+		t = t.UTC()
+		poll.Closes = &t
+	}
+
+	return poll, ""
+}
+
+// pollTexts returns a poll's question and options, for checking against
+// the content filter
+func pollTexts(p *models.Poll) []string {
+	texts := []string{p.Question}
+
+	for _, o := range p.Options {
+		texts = append(texts, o.Label)
+	}
+
+	return texts
+}
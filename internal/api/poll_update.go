@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// PollUpdate closes or reopens a topic's poll, only for the author who asked it
+func (api *TopicalAPI) PollUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	pollPath := fmt.Sprintf("/topics/%d#poll", id)
+	v := api.viewer(w, r)
+	poll, err := api.storage.GetPoll(id, v)
+
+	if err != nil || poll == nil {
+		if err != nil {
+			log.Print("Error getting poll", err.Error())
+		}
+
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if v.ReaderKey == "" || poll.AuthorKey != v.ReaderKey {
+		api.session.SaveFlash("Only the poll's author can close it", r, w)
+		http.Redirect(w, r, pollPath, 302)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "close":
+		err = api.storage.SetPollClosed(*poll.ID, true)
+	case "reopen":
+		err = api.storage.SetPollClosed(*poll.ID, false)
+	default:
+		api.session.SaveFlash("Unknown poll action", r, w)
+		http.Redirect(w, r, pollPath, 302)
+		return
+	}
+
+	if err != nil {
+		log.Print("Error updating poll", err.Error())
+		api.session.SaveFlash("Error updating poll", r, w)
+	}
+
+	http.Redirect(w, r, pollPath, 302)
+}
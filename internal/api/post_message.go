@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/jkulton/topical/internal/filter"
+	"github.com/jkulton/topical/internal/models"
+)
+
+var (
+	// errBlankContent is returned when posting a message without content
+	errBlankContent = errors.New("content cannot be blank")
+	// errRejected is returned when the content filter rejects a message,
+	// the verdict returned with it gives the reason
+	errRejected = errors.New("message rejected by content filter")
+)
+
+// postMessage saves a reply to a topic once the content filter allows it,
+// holding it for review or approval as the filter and pre-moderation
+// require, and subscribes its author to the topic. The message's topic and
+// author must be set, its content is trimmed and its status set here. Any
+// other text posted with the message, like a new topic's title, is
+// filtered along with it.
+func (api *TopicalAPI) postMessage(m *models.Message, texts ...string) (filter.Verdict, error) {
+	m.Content = strings.TrimSpace(m.Content)
+
+	if m.Content == "" {
+		return filter.Verdict{}, errBlankContent
+	}
+
+	verdict := api.checkContent(append([]string{m.Content}, texts...)...)
+
+	if verdict.Action == filter.Reject {
+		return verdict, errRejected
+	}
+
+	status, err := api.initialStatus(m.AuthorKey)
+
+	if err != nil {
+		log.Print("Error getting message status", err.Error())
+		return verdict, err
+	}
+
+	m.Hidden = verdict.Action == filter.Hold
+	m.Status = status
+
+	if _, err := api.storage.CreateMessage(m); err != nil {
+		return verdict, err
+	}
+
+	if err := api.storage.Subscribe(m.AuthorKey, *m.TopicID); err != nil {
+		log.Print("Error subscribing to topic", err.Error())
+	}
+
+	if m.Hidden {
+		if err := api.holdForReview(m, verdict.Reason); err != nil {
+			log.Print("Error holding message for review", err.Error())
+		}
+	}
+
+	return verdict, nil
+}
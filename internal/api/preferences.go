@@ -0,0 +1,50 @@
+package api
+
+import (
+	"time"
+	_ "time/tzdata" // Timezones for Posted timestamps, on hosts without zoneinfo
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// Choices offered on the settings page for each display preference. The
+// first choice is the default, used when a preference is empty.
+var (
+	appearances = []string{"auto", "light", "dark"}
+	densities   = []string{"comfortable", "compact"}
+	dateFormats = map[string]string{
+		"date":     "Jan 02, 2006",
+		"datetime": "Jan 02, 2006 3:04 PM",
+		"iso":      "2006-01-02 15:04",
+	}
+)
+
+// defaultDateFormat is used for Posted timestamps when no format is chosen
+const defaultDateFormat = "date"
+
+// oneOf reports whether value is one of choices
+func oneOf(value string, choices []string) bool {
+	for _, c := range choices {
+		if value == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// location returns the timezone timestamps are shown in, UTC unless the
+// preferences name a known timezone
+func location(p models.Preferences) *time.Location {
+	if p.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(p.Timezone)
+
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// profilePageSize is how many messages a profile page lists
+const profilePageSize = 20
+
+// ProfileShow renders the messages posted under an identity's initials and
+// theme across all topics, newest first, a page at a time. Mentions which
+// only give initials link to the profile without a theme.
+func (api *TopicalAPI) ProfileShow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	initials := strings.ToUpper(vars["initials"])
+	path := "/u/" + initials
+	theme := 0
+
+	// Without a theme, messages under the initials in every theme are listed
+	if vars["theme"] != "" {
+		var err error
+		theme, err = strconv.Atoi(vars["theme"])
+
+		if err != nil {
+			log.Print("Error parsing route theme", err.Error())
+			api.templates.ExecuteTemplate(w, "error", nil)
+			return
+		}
+
+		path = fmt.Sprintf("/u/%s-%d", initials, theme)
+	}
+
+	pageNumber, err := strconv.Atoi(r.FormValue("page"))
+
+	if err != nil || pageNumber < 1 {
+		pageNumber = 1
+	}
+
+	// One extra message is fetched to tell whether there is an older page
+	messages, err := api.storage.GetAuthorMessages(initials, theme, profilePageSize+1, (pageNumber-1)*profilePageSize, api.viewer(w, r))
+
+	if err != nil {
+		log.Print("Error getting author messages", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	older := len(messages) > profilePageSize
+
+	if older {
+		messages = messages[:profilePageSize]
+	}
+
+	payload := struct {
+		page
+		Initials  string
+		Theme     int
+		Messages  []models.Message
+		NewerPage string
+		OlderPage string
+	}{api.newPage(w, r), initials, theme, messages, "", ""}
+
+	if pageNumber > 1 {
+		payload.NewerPage = fmt.Sprintf("%s?page=%d", path, pageNumber-1)
+	}
+
+	if older {
+		payload.OlderPage = fmt.Sprintf("%s?page=%d", path, pageNumber+1)
+	}
+
+	api.templates.ExecuteTemplate(w, "profile", payload)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/storage"
+)
+
+// topicMessage returns the message with the ID given in a form value, if
+// it's one the viewer can see in the topic
+func (api *TopicalAPI) topicMessage(value string, topicID int, v storage.Viewer) *models.Message {
+	id, err := strconv.Atoi(value)
+
+	if err != nil {
+		return nil
+	}
+
+	m, err := api.storage.GetMessage(id, v)
+
+	if err != nil {
+		if err != storage.ErrMessageNotFound {
+			log.Print("Error getting message", err.Error())
+		}
+
+		return nil
+	}
+
+	if *m.TopicID != topicID {
+		return nil
+	}
+
+	return m
+}
+
+// quoteMarkdown returns a reply quoting a message, a link back to the
+// message followed by its content as a blockquote
+func quoteMarkdown(m *models.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s wrote](/topics/%d#message-%d):\n\n", m.AuthorInitials, *m.TopicID, *m.ID)
+
+	for _, line := range strings.Split(strings.ReplaceAll(strings.TrimSpace(m.Content), "\r\n", "\n"), "\n") {
+		b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+	}
+
+	b.WriteString("\n")
+
+	return b.String()
+}
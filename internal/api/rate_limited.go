@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RateLimited responds to clients that have posted too quickly, rendering
+// a friendly notice with a link back to the form for browsers
+func (api *TopicalAPI) RateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") == false {
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	back := "/topics"
+
+	// Only link back to pages on this site
+	if referer, err := url.Parse(r.Referer()); err == nil && referer.Host == r.Host && referer.Path != "" {
+		back = referer.RequestURI()
+	}
+
+	payload := struct {
+		page
+		Back string
+	}{api.newPage(w, r), back}
+	payload.Flashes = append(payload.Flashes, fmt.Sprintf("You're posting too quickly, please wait %d seconds and try again", int(math.Ceil(retryAfter.Seconds()))))
+
+	w.WriteHeader(http.StatusTooManyRequests)
+	api.templates.ExecuteTemplate(w, "rate-limited", payload)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// reactionJSON is a reaction as written to JSON
+type reactionJSON struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// reactionsJSON converts reactions for writing to JSON, as an empty list if there are none
+func reactionsJSON(reactions []models.Reaction) []reactionJSON {
+	converted := make([]reactionJSON, 0, len(reactions))
+
+	for _, r := range reactions {
+		converted = append(converted, reactionJSON{r.Emoji, r.Count, r.Reacted})
+	}
+
+	return converted
+}
+
+// ReactionUpdate toggles the current user's reaction to a message with one
+// of the configured emoji. Requests asking for JSON, made by script, get the
+// message's reactions back instead of a redirect to the message.
+func (api *TopicalAPI) ReactionUpdate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topicID, err := strconv.Atoi(vars["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	messagePath := fmt.Sprintf("/topics/%d#message-%s", topicID, vars["messageID"])
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.reactionFailed(w, r, wantsJSON, http.StatusUnauthorized, "Join to react to messages", messagePath)
+		return
+	}
+
+	emoji := r.FormValue("emoji")
+
+	if api.validReaction(emoji) == false {
+		api.reactionFailed(w, r, wantsJSON, http.StatusBadRequest, "Unknown reaction", messagePath)
+		return
+	}
+
+	message := api.topicMessage(vars["messageID"], topicID, api.viewer(w, r))
+
+	if message == nil {
+		api.reactionFailed(w, r, wantsJSON, http.StatusNotFound, "Message not found", fmt.Sprintf("/topics/%d", topicID))
+		return
+	}
+
+	if err := api.storage.ToggleReaction(*message.ID, authorKey, emoji); err != nil {
+		log.Print("Error toggling reaction", err.Error())
+		api.reactionFailed(w, r, wantsJSON, http.StatusInternalServerError, "Error reacting to message", messagePath)
+		return
+	}
+
+	if wantsJSON == false {
+		http.Redirect(w, r, messagePath, 302)
+		return
+	}
+
+	reactions, err := api.storage.GetReactions([]int{*message.ID}, authorKey)
+
+	if err != nil {
+		log.Print("Error getting reactions", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	payload := struct {
+		MessageID int            `json:"message_id"`
+		Reactions []reactionJSON `json:"reactions"`
+	}{*message.ID, reactionsJSON(reactions[*message.ID])}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Print("Error writing reactions", err.Error())
+	}
+}
+
+// validReaction reports whether emoji is one readers may react with
+func (api *TopicalAPI) validReaction(emoji string) bool {
+	for _, e := range api.config.Reactions {
+		if e == emoji {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reactionFailed tells the reader why reacting failed, as a JSON error with
+// the given status or as a flash on the page at path
+func (api *TopicalAPI) reactionFailed(w http.ResponseWriter, r *http.Request, wantsJSON bool, status int, reason string, path string) {
+	if wantsJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": reason})
+		return
+	}
+
+	api.session.SaveFlash(reason, r, w)
+	http.Redirect(w, r, path, 302)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores bytes past the 72nd, so longer passwords are refused
+	maxPasswordLength = 72
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,20}$`)
+
+// RegisterCreate creates an account from a submitted handle, password,
+// initials, and theme, logging the session in to it
+func (api *TopicalAPI) RegisterCreate(w http.ResponseWriter, r *http.Request) {
+	if err := api.checkChallenge(r); err != nil {
+		log.Print("Registration failed anti-bot check: ", err.Error())
+		api.session.SaveFlash(challengeFailedFlash, r, w)
+		http.Redirect(w, r, "/register", 302)
+		return
+	}
+
+	handle := strings.TrimSpace(r.FormValue("handle"))
+	password := r.FormValue("password")
+	initials := strings.ToUpper(r.FormValue("initials"))
+	theme, err := strconv.Atoi(r.FormValue("theme"))
+
+	var problem string
+
+	switch {
+	case !handlePattern.MatchString(handle):
+		problem = "Handles must be 3 to 20 letters, numbers, or underscores"
+	case len(password) < minPasswordLength || len(password) > maxPasswordLength:
+		problem = "Passwords must be 8 to 72 characters"
+	case !models.ValidInitials(initials):
+		problem = "Initials must be two letters, other than XX"
+	case err != nil || !models.ValidTheme(theme):
+		problem = "Please pick a favorite color"
+	}
+
+	if problem != "" {
+		api.session.SaveFlash(problem, r, w)
+		http.Redirect(w, r, "/register", 302)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		log.Print("Error hashing password", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	user, err := api.storage.CreateUser(&models.User{Handle: handle, Initials: initials, Theme: theme}, string(hash))
+
+	if err == storage.ErrHandleTaken {
+		api.session.SaveFlash("That handle is already taken", r, w)
+		http.Redirect(w, r, "/register", 302)
+		return
+	}
+
+	if err != nil {
+		log.Print("Error creating user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if err := api.session.SaveUserID(*user.ID, r, w); err != nil {
+		log.Print("Error saving user", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/topics", 302)
+}
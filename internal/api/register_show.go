@@ -0,0 +1,29 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// RegisterShow renders the form for registering an account
+func (api *TopicalAPI) RegisterShow(w http.ResponseWriter, r *http.Request) {
+	if _, err := api.session.GetUserID(r); err == nil {
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	challenge, err := api.newChallenge()
+
+	if err != nil {
+		log.Print("Error issuing challenge", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Challenge *challengeForm
+	}{api.newPage(w, r), challenge}
+
+	api.templates.ExecuteTemplate(w, "register", payload)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"io"
+	"log"
+
+	"github.com/jkulton/topical/internal/inbound"
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/storage"
+)
+
+// ReplyError is returned by ReceiveReply for replies which can't be posted
+// as sent, as opposed to failures worth retrying
+type ReplyError struct {
+	Reason string
+}
+
+func (e *ReplyError) Error() string {
+	return e.Reason
+}
+
+// ReceiveReply posts an emailed reply to the topic its reply address is
+// for, as the digest recipient the address was given to, through the same
+// checks as MessageCreate. The reply must come from the recipient's
+// confirmed digest email. Automatic replies are dropped.
+func (api *TopicalAPI) ReceiveReply(raw io.Reader) error {
+	if api.digests == nil || api.config.ReplyDomain == "" {
+		return &ReplyError{"replying by email is disabled"}
+	}
+
+	reply, err := inbound.Parse(raw)
+
+	if err == inbound.ErrNoText {
+		return &ReplyError{"replies must include plain text"}
+	}
+
+	if err != nil {
+		return &ReplyError{"unreadable email: " + err.Error()}
+	}
+
+	if reply.Automatic {
+		log.Printf("Dropped automatic reply from %s", reply.From)
+		return nil
+	}
+
+	recipientKey, topicID, err := api.replyRecipient(reply)
+
+	if err != nil {
+		return err
+	}
+
+	author, err := api.storage.GetLatestAuthorMessage(recipientKey)
+
+	if err == storage.ErrAuthorNotFound {
+		return &ReplyError{"post on the board before replying by email"}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	message := models.Message{
+		TopicID:        &topicID,
+		Content:        reply.Text,
+		AuthorInitials: author.AuthorInitials,
+		AuthorTheme:    author.AuthorTheme,
+		UserID:         author.UserID,
+		AuthorTripcode: author.AuthorTripcode,
+		AuthorKey:      recipientKey,
+	}
+
+	verdict, err := api.postMessage(&message)
+
+	switch {
+	case err == errBlankContent:
+		return &ReplyError{"replies cannot be blank"}
+	case err == errRejected:
+		return &ReplyError{verdict.Reason}
+	case err != nil:
+		return err
+	}
+
+	log.Printf("Posted emailed reply from %s to topic %d", reply.From, topicID)
+
+	return nil
+}
+
+// replyRecipient returns the digest recipient and topic of the reply
+// address a reply was sent to, checking the address was given to the
+// digest recipient whose email sent the reply
+func (api *TopicalAPI) replyRecipient(reply *inbound.Reply) (string, int, error) {
+	digests, err := api.storage.GetConfirmedDigestsByEmail(reply.From)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, address := range reply.Recipients {
+		topicID, sig, ok := api.digests.ParseReplyAddress(address)
+
+		if !ok {
+			continue
+		}
+
+		for _, d := range digests {
+			if api.digests.VerifyReply(d.RecipientKey, topicID, sig) {
+				return d.RecipientKey, topicID, nil
+			}
+		}
+	}
+
+	return "", 0, &ReplyError{"not sent to a reply address from " + reply.From}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/storage"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReportCreate accepts a form POST, flagging a message for moderator review.
+// The message must be visible in the topic it's reported from, and each
+// session may only report a given message once.
+func (api *TopicalAPI) ReportCreate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topicID, err := strconv.Atoi(vars["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	messageID, err := strconv.Atoi(vars["messageID"])
+
+	if err != nil {
+		log.Print("Error parsing route message id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if api.topicMessage(vars["messageID"], topicID, api.viewer(w, r)) == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	details := strings.TrimSpace(r.FormValue("details"))
+
+	if validReportReason(reason) == false {
+		api.session.SaveFlash("Please choose a reason for your report", r, w)
+		http.Redirect(w, r, fmt.Sprintf("/topics/%d/messages/%d/report", topicID, messageID), 302)
+		return
+	}
+
+	sessionID, err := api.session.GetID(r, w)
+
+	if err != nil {
+		log.Print("Error getting session id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	report := models.Report{
+		MessageID: &messageID,
+		Reason:    reason,
+		Details:   details,
+		SessionID: sessionID,
+	}
+
+	_, err = api.storage.CreateReport(&report)
+
+	if err == storage.ErrDuplicateReport {
+		api.session.SaveFlash("You've already reported this message", r, w)
+		http.Redirect(w, r, fmt.Sprintf("/topics/%d", topicID), 302)
+		return
+	}
+
+	if err != nil {
+		log.Print("Error creating report", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("Thanks, a moderator will review your report", r, w)
+	http.Redirect(w, r, fmt.Sprintf("/topics/%d", topicID), 302)
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range models.ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/jkulton/topical/internal/models"
+	"log"
+	"net/http"
+)
+
+// ReportList renders the moderator queue of open reports
+func (api *TopicalAPI) ReportList(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	reports, err := api.storage.GetOpenReports()
+
+	if err != nil {
+		log.Print("Error getting open reports", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Reports []models.Report
+	}{api.newPage(w, r), reports}
+
+	api.templates.ExecuteTemplate(w, "reports", payload)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ReportNew renders a form for reporting a message to moderators
+func (api *TopicalAPI) ReportNew(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topicID, err := strconv.Atoi(vars["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	messageID, err := strconv.Atoi(vars["messageID"])
+
+	if err != nil {
+		log.Print("Error parsing route message id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		TopicID   int
+		MessageID int
+		Reasons   []string
+	}{api.newPage(w, r), topicID, messageID, models.ReportReasons}
+
+	api.templates.ExecuteTemplate(w, "report-new", payload)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ReportUpdate accepts a moderator's decision on a report. The "hide" action
+// resolves the report and hides the reported message in one step, while
+// "approve" publishes a hidden message such as one held by the content filter.
+func (api *TopicalAPI) ReportUpdate(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if r.FormValue("action") == "approve" {
+		if err := api.storage.ApproveReport(id); err != nil {
+			log.Print("Error approving report", err.Error())
+			api.templates.ExecuteTemplate(w, "error", nil)
+			return
+		}
+
+		http.Redirect(w, r, "/moderation/reports", 302)
+		return
+	}
+
+	var status string
+	hideMessage := false
+
+	switch r.FormValue("action") {
+	case "hide":
+		status = "resolved"
+		hideMessage = true
+	case "resolve":
+		status = "resolved"
+	case "dismiss":
+		status = "dismissed"
+	default:
+		api.session.SaveFlash("Unknown report action", r, w)
+		http.Redirect(w, r, "/moderation/reports", 302)
+		return
+	}
+
+	if err := api.storage.ResolveReport(id, status, hideMessage); err != nil {
+		log.Print("Error resolving report", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	http.Redirect(w, r, "/moderation/reports", 302)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// SettingsShow renders the settings page, with display preferences for
+// every visitor, and the messages they've posted and their email digest for
+// those who have joined
+func (api *TopicalAPI) SettingsShow(w http.ResponseWriter, r *http.Request) {
+	messageCount := 0
+	var digest *models.Digest
+
+	if authorKey, err := api.currentAuthorKey(w, r); err == nil {
+		if messageCount, err = api.storage.CountMessagesByAuthorKey(authorKey); err != nil {
+			log.Print("Error counting author messages", err.Error())
+			api.templates.ExecuteTemplate(w, "error", nil)
+			return
+		}
+
+		if api.digests != nil {
+			if digest, err = api.storage.GetDigest(authorKey); err != nil {
+				log.Print("Error getting digest", err.Error())
+				api.templates.ExecuteTemplate(w, "error", nil)
+				return
+			}
+		}
+	}
+
+	p := api.newPage(w, r)
+	examples := map[string]string{}
+
+	for name, layout := range dateFormats {
+		examples[name] = time.Now().In(p.location).Format(layout)
+	}
+
+	payload := struct {
+		page
+		MessageCount      int
+		Appearances       []string
+		Densities         []string
+		DateFormats       map[string]string
+		DigestsEnabled    bool
+		Digest            *models.Digest
+		DigestFrequencies []string
+	}{p, messageCount, appearances, densities, examples, api.digests != nil, digest, digestFrequencies}
+
+	api.templates.ExecuteTemplate(w, "settings", payload)
+}
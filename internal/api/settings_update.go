@@ -0,0 +1,67 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// SettingsUpdate saves display preferences to the session, and the initials
+// and theme of an anonymous user
+func (api *TopicalAPI) SettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	preferences := models.Preferences{
+		Appearance: r.FormValue("appearance"),
+		Timezone:   strings.TrimSpace(r.FormValue("timezone")),
+		DateFormat: r.FormValue("date_format"),
+		Density:    r.FormValue("density"),
+	}
+
+	if _, ok := dateFormats[preferences.DateFormat]; !ok || !oneOf(preferences.Appearance, appearances) || !oneOf(preferences.Density, densities) {
+		api.session.SaveFlash("Please choose from the options given", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	if _, err := time.LoadLocation(preferences.Timezone); err != nil {
+		api.session.SaveFlash("Unknown timezone, use a name like Europe/Paris", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	// Accounts keep their initials and theme in storage, only anonymous
+	// users can change theirs here
+	if user, err := api.currentUser(r); err == nil && user.ID == nil && r.FormValue("initials") != "" {
+		initials := strings.ToUpper(r.FormValue("initials"))
+		theme, err := strconv.Atoi(r.FormValue("theme"))
+
+		if err != nil || !models.ValidInitials(initials) || !models.ValidTheme(theme) {
+			api.session.SaveFlash("Initials must be two letters, other than XX", r, w)
+			http.Redirect(w, r, "/settings", 302)
+			return
+		}
+
+		user.Initials = initials
+		user.Theme = theme
+
+		if err := api.session.SaveUser(user, r, w); err != nil {
+			log.Print("Error saving user", err.Error())
+			api.session.SaveFlash("Error saving settings", r, w)
+			http.Redirect(w, r, "/settings", 302)
+			return
+		}
+	}
+
+	if err := api.session.SavePreferences(preferences, r, w); err != nil {
+		log.Print("Error saving preferences", err.Error())
+		api.session.SaveFlash("Error saving settings", r, w)
+		http.Redirect(w, r, "/settings", 302)
+		return
+	}
+
+	api.session.SaveFlash("Settings saved", r, w)
+	http.Redirect(w, r, "/settings", 302)
+}
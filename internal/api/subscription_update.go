@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// SubscriptionUpdate starts or stops the current user watching a topic for replies
+func (api *TopicalAPI) SubscriptionUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	topicPath := fmt.Sprintf("/topics/%d", id)
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to watch topics", r, w)
+		http.Redirect(w, r, topicPath, 302)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "watch":
+		err = api.storage.Subscribe(authorKey, id)
+	case "unwatch":
+		err = api.storage.Unsubscribe(authorKey, id)
+	default:
+		api.session.SaveFlash("Unknown subscription action", r, w)
+		http.Redirect(w, r, topicPath, 302)
+		return
+	}
+
+	if err != nil {
+		log.Print("Error updating subscription", err.Error())
+		api.session.SaveFlash("Error updating subscription", r, w)
+	}
+
+	http.Redirect(w, r, topicPath, 302)
+}
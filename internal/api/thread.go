@@ -0,0 +1,93 @@
+package api
+
+import (
+	"github.com/jkulton/topical/internal/models"
+)
+
+// maxThreadDepth is how deeply replies nest in the threaded view, replies
+// to messages at this depth are shown alongside them instead
+const maxThreadDepth = 4
+
+// topicView is the payload of a topic's page
+type topicView struct {
+	page
+	Topic       *models.Topic
+	FirstUnread *int
+	Watching    bool
+	// Threaded is true when messages are shown as a reply tree
+	Threaded bool
+	Threads  []thread
+	// ReplyTo is the message the reply form replies to, if any, and Draft
+	// the form's starting content
+	ReplyTo *models.Message
+	Draft   string
+	// ReactionChoices are the emoji readers may react with
+	ReactionChoices []string
+	// Poll is the topic's poll, if it has one, and PollAuthor true if the
+	// reader asked it, letting them close and reopen it
+	Poll       *models.Poll
+	PollAuthor bool
+}
+
+// thread is a message in a topic with the replies to it. It carries the
+// topic's view so templates rendering it recursively can reach the page.
+type thread struct {
+	*topicView
+	models.Message
+	Replies []thread
+}
+
+// threads arranges messages, in the order they were posted, as reply trees
+// when nested is true, or as a flat list of messages without replies
+func threads(view *topicView, messages []models.Message, nested bool) []thread {
+	index := map[int]int{}
+	parents := make([]int, len(messages))
+	depths := make([]int, len(messages))
+	replies := make([][]int, len(messages))
+	roots := []int{}
+
+	for i, m := range messages {
+		index[*m.ID] = i
+		parents[i] = -1
+
+		if !nested || m.ReplyToID == nil {
+			roots = append(roots, i)
+			continue
+		}
+
+		parent, ok := index[*m.ReplyToID]
+
+		if !ok {
+			roots = append(roots, i)
+			continue
+		}
+
+		// Past the deepest level, replies join their parent's replies
+		if depths[parent] == maxThreadDepth {
+			parent = parents[parent]
+		}
+
+		parents[i] = parent
+		depths[i] = depths[parent] + 1
+		replies[parent] = append(replies[parent], i)
+	}
+
+	var build func(i int) thread
+	build = func(i int) thread {
+		t := thread{topicView: view, Message: messages[i]}
+
+		for _, reply := range replies[i] {
+			t.Replies = append(t.Replies, build(reply))
+		}
+
+		return t
+	}
+
+	result := make([]thread, 0, len(roots))
+
+	for _, root := range roots {
+		result = append(result, build(root))
+	}
+
+	return result
+}
@@ -2,15 +2,17 @@ package api
 
 import (
 	"fmt"
+	"github.com/jkulton/topical/internal/filter"
 	"github.com/jkulton/topical/internal/models"
 	"log"
 	"net/http"
 	"strings"
 )
 
-// TopicCreate creates a new topic based on inputs from client
+// TopicCreate creates a new topic based on inputs from client, with a poll
+// if the form asks for one
 func (api *TopicalAPI) TopicCreate(w http.ResponseWriter, r *http.Request) {
-	user, err := api.session.GetUser(r)
+	user, err := api.currentUser(r)
 
 	if err != nil {
 		api.session.SaveFlash("Log in to post a topic", r, w)
@@ -18,6 +20,13 @@ func (api *TopicalAPI) TopicCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := api.checkChallenge(r); err != nil {
+		log.Print("Topic failed anti-bot check: ", err.Error())
+		api.session.SaveFlash(challengeFailedFlash, r, w)
+		http.Redirect(w, r, "/topics/new", 302)
+		return
+	}
+
 	title := strings.TrimSpace(r.FormValue("title"))
 	content := strings.TrimSpace(r.FormValue("content"))
 
@@ -27,6 +36,44 @@ func (api *TopicalAPI) TopicCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	poll, problem := parsePoll(r, location(api.session.GetPreferences(r)))
+
+	if problem != "" {
+		api.session.SaveFlash(problem, r, w)
+		http.Redirect(w, r, "/topics/new", 302)
+		return
+	}
+
+	texts := []string{title}
+
+	if poll != nil {
+		texts = append(texts, pollTexts(poll)...)
+	}
+
+	// Check the filter before creating the topic, so a rejected post
+	// doesn't leave an empty topic behind
+	if verdict := api.checkContent(append([]string{content}, texts...)...); verdict.Action == filter.Reject {
+		api.session.SaveFlash(verdict.Reason, r, w)
+		http.Redirect(w, r, "/topics/new", 302)
+		return
+	}
+
+	tripcode, err := api.tripcode(w, r, user)
+
+	if err != nil {
+		log.Print("Error getting tripcode", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	authorKey, err := api.authorKey(w, r, user)
+
+	if err != nil {
+		log.Print("Error getting author key", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
 	topic, err := api.storage.CreateTopic(title)
 
 	if err != nil {
@@ -40,15 +87,35 @@ func (api *TopicalAPI) TopicCreate(w http.ResponseWriter, r *http.Request) {
 		Content:        content,
 		AuthorTheme:    user.Theme,
 		AuthorInitials: user.Initials,
+		UserID:         user.ID,
+		AuthorTripcode: tripcode,
+		AuthorKey:      authorKey,
 	}
 
-	_, err = api.storage.CreateMessage(&message)
-
-	if err != nil {
+	if _, err := api.postMessage(&message, texts...); err != nil {
 		log.Print("Error creating message", err.Error())
 		api.templates.ExecuteTemplate(w, "error", nil)
 		return
 	}
 
+	if poll != nil {
+		poll.TopicID, poll.AuthorKey = topic.ID, authorKey
+
+		if _, err := api.storage.CreatePoll(poll); err != nil {
+			log.Print("Error creating poll", err.Error())
+			api.session.SaveFlash("Your topic was posted, but its poll couldn't be saved", r, w)
+		}
+	}
+
+	if message.Hidden {
+		api.session.SaveFlash("Your topic will appear once a moderator has reviewed it", r, w)
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	if message.Status == "pending" {
+		api.session.SaveFlash("Your topic is only visible to you until a moderator approves it", r, w)
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/topics/%d", *topic.ID), 302)
 }
@@ -8,9 +8,7 @@ import (
 
 // TopicList renders a list of recent topics with message counts in order of most recent post
 func (api *TopicalAPI) TopicList(w http.ResponseWriter, r *http.Request) {
-	flashes, err := api.session.GetFlashes(r, w)
-	user, _ := api.session.GetUser(r)
-	topics, err := api.storage.GetRecentTopics()
+	topics, err := api.storage.GetRecentTopics(api.viewer(w, r))
 
 	if err != nil {
 		log.Print("Error getting recent topics", err.Error())
@@ -19,10 +17,10 @@ func (api *TopicalAPI) TopicList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	payload := struct {
-		Topics  []models.Topic
-		User    *models.User
-		Flashes []string
-	}{Topics: topics, User: user, Flashes: flashes}
+		page
+		Topics              []models.Topic
+		CanLogoutEverywhere bool
+	}{api.newPage(w, r), topics, api.config.SessionStore != "cookie"}
 
 	api.templates.ExecuteTemplate(w, "list", payload)
 }
@@ -1,25 +1,30 @@
 package api
 
 import (
-	"github.com/jkulton/topical/internal/models"
+	"log"
 	"net/http"
 )
 
 // TopicNew renders a form for creating a new topic
 func (api *TopicalAPI) TopicNew(w http.ResponseWriter, r *http.Request) {
-	flashes, _ := api.session.GetFlashes(r, w)
-	user, err := api.session.GetUser(r)
-
-	if err != nil {
+	if _, err := api.currentUser(r); err != nil {
 		api.session.SaveFlash("Log in to post a message", r, w)
 		http.Redirect(w, r, "/topics", 302)
 		return
 	}
 
+	challenge, err := api.newChallenge()
+
+	if err != nil {
+		log.Print("Error issuing challenge", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
 	payload := struct {
-		User    *models.User
-		Flashes []string
-	}{user, flashes}
+		page
+		Challenge *challengeForm
+	}{api.newPage(w, r), challenge}
 
 	api.templates.ExecuteTemplate(w, "new-topic", payload)
 }
@@ -8,10 +8,11 @@ import (
 	"strconv"
 )
 
-// TopicShow renders a topic with it's associated threaded messages
+// TopicShow renders a topic's messages, flat in the order they were posted
+// or, with view=threaded, as reply trees, highlighting those posted since
+// the reader last opened it. The reply and quote params start the reply form
+// replying to, or quoting, one of the messages.
 func (api *TopicalAPI) TopicShow(w http.ResponseWriter, r *http.Request) {
-	flashes, _ := api.session.GetFlashes(r, w)
-	user, _ := api.session.GetUser(r)
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 
 	if err != nil {
@@ -20,7 +21,8 @@ func (api *TopicalAPI) TopicShow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	topic, err := api.storage.GetTopic(id)
+	v := api.viewer(w, r)
+	topic, err := api.storage.GetTopic(id, v)
 
 	if err != nil {
 		log.Print("Error getting topic", err.Error())
@@ -34,11 +36,81 @@ func (api *TopicalAPI) TopicShow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payload := struct {
-		Topic   *models.Topic
-		User    *models.User
-		Flashes []string
-	}{topic, user, flashes}
+	firstUnread := api.markUnread(v.ReaderKey, topic)
+	watching := false
 
-	api.templates.ExecuteTemplate(w, "show", payload)
+	if v.ReaderKey != "" {
+		if watching, err = api.storage.IsSubscribed(v.ReaderKey, id); err != nil {
+			log.Print("Error getting subscription", err.Error())
+		}
+	}
+
+	view := &topicView{
+		Topic:           topic,
+		FirstUnread:     firstUnread,
+		Watching:        watching,
+		Threaded:        r.URL.Query().Get("view") == "threaded",
+		ReactionChoices: api.config.Reactions,
+	}
+
+	// Quoting a message starts the reply with it
+	if quoting := api.topicMessage(r.URL.Query().Get("quote"), id, v); quoting != nil {
+		view.ReplyTo, view.Draft = quoting, quoteMarkdown(quoting)
+	} else {
+		view.ReplyTo = api.topicMessage(r.URL.Query().Get("reply"), id, v)
+	}
+
+	if view.Poll, err = api.storage.GetPoll(id, v); err != nil {
+		log.Print("Error getting poll", err.Error())
+	}
+
+	view.PollAuthor = view.Poll != nil && v.ReaderKey != "" && view.Poll.AuthorKey == v.ReaderKey
+	view.Threads = threads(view, *topic.Messages, view.Threaded)
+	view.page = api.newPage(w, r)
+
+	api.templates.ExecuteTemplate(w, "show", view)
+}
+
+// markUnread flags the topic's messages posted since the reader last opened
+// it, returning the ID of the first, then records the topic as read. Nothing
+// is flagged the first time a reader opens a topic.
+func (api *TopicalAPI) markUnread(readerKey string, topic *models.Topic) *int {
+	if readerKey == "" || len(*topic.Messages) == 0 {
+		return nil
+	}
+
+	lastRead, err := api.storage.GetLastRead(readerKey, *topic.ID)
+
+	if err != nil {
+		log.Print("Error getting last read message", err.Error())
+		return nil
+	}
+
+	var firstUnread *int
+	newest := 0
+	messages := *topic.Messages
+
+	for i := range messages {
+		id := *messages[i].ID
+
+		if lastRead > 0 && id > lastRead {
+			messages[i].Unread = true
+
+			if firstUnread == nil {
+				firstUnread = messages[i].ID
+			}
+		}
+
+		if id > newest {
+			newest = id
+		}
+	}
+
+	if newest > lastRead {
+		if err := api.storage.MarkRead(readerKey, *topic.ID, newest); err != nil {
+			log.Print("Error marking topic read", err.Error())
+		}
+	}
+
+	return firstUnread
 }
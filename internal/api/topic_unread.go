@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// TopicUnread redirects to the first message in a topic posted since the
+// reader last opened it, or to the latest message if they're caught up
+func (api *TopicalAPI) TopicUnread(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	v := api.viewer(w, r)
+	topic, err := api.storage.GetTopic(id, v)
+
+	if err != nil {
+		log.Print("Error getting topic", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if topic.ID == nil || len(*topic.Messages) == 0 {
+		api.session.SaveFlash("Topic not found", r, w)
+		http.Redirect(w, r, "/topics", 302)
+		return
+	}
+
+	lastRead := 0
+
+	if v.ReaderKey != "" {
+		if lastRead, err = api.storage.GetLastRead(v.ReaderKey, id); err != nil {
+			log.Print("Error getting last read message", err.Error())
+		}
+	}
+
+	messages := *topic.Messages
+	target := *messages[len(messages)-1].ID
+
+	for _, m := range messages {
+		if *m.ID > lastRead {
+			target = *m.ID
+			break
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/topics/%d#message-%d", id, target), 302)
+}
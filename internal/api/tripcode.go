@@ -0,0 +1,45 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// tripcodeLength is how many characters of a tripcode are kept, 40 bits
+// is plenty to tell apart authors sharing initials and a theme
+const tripcodeLength = 8
+
+// newTripSecret returns a random secret for an anonymous user, from which their tripcode is derived
+func newTripSecret() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// tripcode returns a short identifier for the user, stored with their
+// messages so readers can tell apart authors with the same initials and
+// theme. It is a keyed hash of the account ID, or of the anonymous user's
+// secret, so it can't be chosen or forged by others. It is keyed with the
+// signing key rather than session keys, which rotate.
+func (api *TopicalAPI) tripcode(w http.ResponseWriter, r *http.Request, user *models.User) (string, error) {
+	source, err := api.authorIdentity(w, r, user)
+
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, []byte(api.config.SigningKey))
+	mac.Write([]byte("tripcode:" + source))
+
+	return base32.StdEncoding.EncodeToString(mac.Sum(nil))[:tripcodeLength], nil
+}
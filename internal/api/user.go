@@ -0,0 +1,25 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+var errAnonymousDisabled = errors.New("anonymous users are disabled")
+
+// currentUser returns the user posting from the current session: the
+// logged in account if there is one, otherwise the anonymous user if
+// anonymous posting is enabled
+func (api *TopicalAPI) currentUser(r *http.Request) (*models.User, error) {
+	if id, err := api.session.GetUserID(r); err == nil {
+		return api.storage.GetUser(id)
+	}
+
+	if api.config.Anonymous == false {
+		return nil, errAnonymousDisabled
+	}
+
+	return api.session.GetUser(r)
+}
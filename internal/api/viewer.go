@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jkulton/topical/internal/storage"
+)
+
+// viewer describes the current session to storage, so pending messages are
+// only shown to their author and moderators, and unread messages are
+// counted for users who have joined
+func (api *TopicalAPI) viewer(w http.ResponseWriter, r *http.Request) storage.Viewer {
+	readerKey, _ := api.currentAuthorKey(w, r)
+
+	return storage.Viewer{
+		Moderator: api.session.IsModerator(r),
+		ReaderKey: readerKey,
+	}
+}
+
+// initialStatus returns the status a new message from an author should
+// have. With pre-moderation enabled, messages stay pending until the author
+// has had a message approved, from whichever browser they posted it.
+func (api *TopicalAPI) initialStatus(authorKey string) (string, error) {
+	if api.config.PreModeration == false {
+		return "approved", nil
+	}
+
+	approved, err := api.storage.HasApprovedMessage(authorKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	if approved {
+		return "approved", nil
+	}
+
+	return "pending", nil
+}
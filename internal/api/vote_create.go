@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/storage"
+)
+
+// VoteCreate records the current user's vote in a topic's poll, replacing
+// any vote they cast before
+func (api *TopicalAPI) VoteCreate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	pollPath := fmt.Sprintf("/topics/%d#poll", id)
+	authorKey, err := api.currentAuthorKey(w, r)
+
+	if err != nil {
+		api.session.SaveFlash("Join to vote in polls", r, w)
+		http.Redirect(w, r, pollPath, 302)
+		return
+	}
+
+	poll, err := api.storage.GetPoll(id, api.viewer(w, r))
+
+	if err != nil || poll == nil {
+		if err != nil {
+			log.Print("Error getting poll", err.Error())
+		}
+
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	r.ParseForm()
+	optionIDs := []int{}
+
+	for _, value := range r.Form["option"] {
+		optionID, err := strconv.Atoi(value)
+
+		if err != nil {
+			continue
+		}
+
+		for _, o := range poll.Options {
+			if *o.ID == optionID {
+				optionIDs = append(optionIDs, optionID)
+				break
+			}
+		}
+	}
+
+	if len(optionIDs) == 0 || (len(optionIDs) > 1 && poll.Multiple == false) {
+		api.session.SaveFlash("Choose an option to vote for", r, w)
+		http.Redirect(w, r, pollPath, 302)
+		return
+	}
+
+	if err := api.storage.Vote(*poll.ID, authorKey, optionIDs); err != nil {
+		if err == storage.ErrPollClosed {
+			api.session.SaveFlash("This poll has closed", r, w)
+		} else {
+			log.Print("Error voting in poll", err.Error())
+			api.session.SaveFlash("Error voting in poll", r, w)
+		}
+	}
+
+	http.Redirect(w, r, pollPath, 302)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/webhook"
+)
+
+// WebhookCreate adds a webhook new topics and messages are sent to, with a
+// new secret to sign them with
+func (api *TopicalAPI) WebhookCreate(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	endpoint := strings.TrimSpace(r.FormValue("url"))
+	parsed, err := url.Parse(endpoint)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		api.session.SaveFlash("Webhook URLs must start with http:// or https://", r, w)
+		http.Redirect(w, r, "/moderation/webhooks", 302)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+
+	if err != nil {
+		log.Print("Error generating webhook secret", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if _, err := api.storage.CreateWebhook(&models.Webhook{URL: endpoint, Secret: secret}); err != nil {
+		log.Print("Error creating webhook", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("Webhook added", r, w)
+	http.Redirect(w, r, "/moderation/webhooks", 302)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookDeliveryUpdate accepts a moderator's request to retry a delivery,
+// queueing it to be attempted once more
+func (api *TopicalAPI) WebhookDeliveryUpdate(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if r.FormValue("action") != "retry" {
+		api.session.SaveFlash("Unknown delivery action", r, w)
+		http.Redirect(w, r, "/moderation/webhooks", 302)
+		return
+	}
+
+	if err := api.storage.RetryWebhookDelivery(id); err != nil {
+		log.Print("Error retrying webhook delivery", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("Delivery queued for retry", r, w)
+	http.Redirect(w, r, "/moderation/webhooks#deliveries", 302)
+}
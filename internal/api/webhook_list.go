@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// deliveryLogLimit is how many recent deliveries the delivery log shows
+const deliveryLogLimit = 50
+
+// WebhookList renders the webhooks new posts are sent to, and a log of
+// recent deliveries to them
+func (api *TopicalAPI) WebhookList(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	webhooks, err := api.storage.GetWebhooks()
+
+	if err != nil {
+		log.Print("Error getting webhooks", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	deliveries, err := api.storage.GetWebhookDeliveries(deliveryLogLimit)
+
+	if err != nil {
+		log.Print("Error getting webhook deliveries", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	payload := struct {
+		page
+		Webhooks   []models.Webhook
+		Deliveries []models.WebhookDelivery
+	}{api.newPage(w, r), webhooks, deliveries}
+
+	api.templates.ExecuteTemplate(w, "webhooks", payload)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookUpdate accepts a moderator's removal of a webhook
+func (api *TopicalAPI) WebhookUpdate(w http.ResponseWriter, r *http.Request) {
+	if api.session.IsModerator(r) == false {
+		http.Redirect(w, r, "/moderation/login", 302)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err != nil {
+		log.Print("Error parsing route id", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	if r.FormValue("action") != "delete" {
+		api.session.SaveFlash("Unknown webhook action", r, w)
+		http.Redirect(w, r, "/moderation/webhooks", 302)
+		return
+	}
+
+	if err := api.storage.DeleteWebhook(id); err != nil {
+		log.Print("Error deleting webhook", err.Error())
+		api.templates.ExecuteTemplate(w, "error", nil)
+		return
+	}
+
+	api.session.SaveFlash("Webhook removed", r, w)
+	http.Redirect(w, r, "/moderation/webhooks", 302)
+}
@@ -0,0 +1,149 @@
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalid is returned for challenges which weren't issued by this Challenger
+	ErrInvalid = errors.New("invalid challenge")
+	// ErrExpired is returned for challenges older than the Challenger's TTL
+	ErrExpired = errors.New("challenge expired")
+	// ErrUnsolved is returned when a solution doesn't meet the difficulty
+	ErrUnsolved = errors.New("challenge not solved")
+	// ErrReused is returned when a solved challenge is submitted again
+	ErrReused = errors.New("challenge already used")
+)
+
+// Challenger issues and verifies proof-of-work challenges. A challenge is a
+// signed, timestamped token; solving it means finding a string such that
+// sha256(token + ":" + solution) starts with Difficulty zero bits.
+type Challenger struct {
+	Difficulty int
+	secret     []byte
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// New returns a Challenger signing challenges with secret, requiring
+// difficulty leading zero bits, and accepting solutions for ttl after issue
+func New(secret []byte, difficulty int, ttl time.Duration) *Challenger {
+	return &Challenger{
+		Difficulty: difficulty,
+		secret:     secret,
+		ttl:        ttl,
+		now:        time.Now,
+		used:       map[string]time.Time{},
+	}
+}
+
+// Issue returns a new challenge token
+func (c *Challenger) Issue() (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%d.%d.%s", c.now().Unix(), c.Difficulty, hex.EncodeToString(b))
+	return payload + "." + c.sign(payload), nil
+}
+
+// Verify checks that token was issued by this Challenger, hasn't expired or
+// been used before, and that solution solves it
+func (c *Challenger) Verify(token string, solution string) error {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 4 {
+		return ErrInvalid
+	}
+
+	payload := strings.Join(parts[:3], ".")
+
+	if !hmac.Equal([]byte(parts[3]), []byte(c.sign(payload))) {
+		return ErrInvalid
+	}
+
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if c.now().Sub(time.Unix(issued, 0)) > c.ttl {
+		return ErrExpired
+	}
+
+	if leadingZeroBits(token, solution) < difficulty {
+		return ErrUnsolved
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for t, expires := range c.used {
+		if now.After(expires) {
+			delete(c.used, t)
+		}
+	}
+
+	if _, ok := c.used[token]; ok {
+		return ErrReused
+	}
+
+	c.used[token] = time.Unix(issued, 0).Add(c.ttl)
+
+	return nil
+}
+
+// Solve finds a solution to a challenge by brute force, as the browser script
+// does. It's useful for tests and non-browser clients.
+func Solve(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+
+		if leadingZeroBits(token, solution) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func (c *Challenger) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte("challenge:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(token string, solution string) int {
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	zeros := 0
+
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+
+		if b != 0 {
+			break
+		}
+	}
+
+	return zeros
+}
@@ -0,0 +1,76 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	t.Run("accepts a solved challenge", func(t *testing.T) {
+		c := New([]byte("secret"), 8, time.Minute)
+		token, _ := c.Issue()
+
+		if err := c.Verify(token, Solve(token, 8)); err != nil {
+			t.Errorf("expected challenge to verify, got %v", err)
+		}
+	})
+
+	t.Run("rejects an unsolved challenge", func(t *testing.T) {
+		c := New([]byte("secret"), 8, time.Minute)
+		token, _ := c.Issue()
+		solution := "0"
+
+		for leadingZeroBits(token, solution) >= 8 {
+			solution += "0"
+		}
+
+		if err := c.Verify(token, solution); err != ErrUnsolved {
+			t.Errorf("got %v but wanted %v", err, ErrUnsolved)
+		}
+	})
+
+	t.Run("rejects a challenge signed with another secret", func(t *testing.T) {
+		token, _ := New([]byte("other"), 8, time.Minute).Issue()
+
+		if err := New([]byte("secret"), 8, time.Minute).Verify(token, Solve(token, 8)); err != ErrInvalid {
+			t.Errorf("got %v but wanted %v", err, ErrInvalid)
+		}
+	})
+
+	t.Run("rejects a challenge with a lowered difficulty", func(t *testing.T) {
+		c := New([]byte("secret"), 8, time.Minute)
+		token, _ := New([]byte("secret"), 0, time.Minute).Issue()
+
+		if err := c.Verify(token, "0"); err != nil {
+			t.Errorf("challenges keep the difficulty they were issued with, got %v", err)
+		}
+
+		tampered := token[:len(token)-1] + "0"
+
+		if err := c.Verify(tampered, "0"); err != ErrInvalid {
+			t.Errorf("got %v but wanted %v", err, ErrInvalid)
+		}
+	})
+
+	t.Run("rejects an expired challenge", func(t *testing.T) {
+		c := New([]byte("secret"), 8, time.Minute)
+		token, _ := c.Issue()
+		c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+		if err := c.Verify(token, Solve(token, 8)); err != ErrExpired {
+			t.Errorf("got %v but wanted %v", err, ErrExpired)
+		}
+	})
+
+	t.Run("rejects a reused challenge", func(t *testing.T) {
+		c := New([]byte("secret"), 8, time.Minute)
+		token, _ := c.Issue()
+		solution := Solve(token, 8)
+
+		c.Verify(token, solution)
+
+		if err := c.Verify(token, solution); err != ErrReused {
+			t.Errorf("got %v but wanted %v", err, ErrReused)
+		}
+	})
+}
@@ -1,17 +1,81 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // AppConfig specifies high level configuration settings for the app
 type AppConfig struct {
-	Port            int
-	DBConnectionURI string
-	SessionKey      string
+	Port                int
+	DBConnectionURI     string
+	SessionKey          string
+	SigningKey          string
+	ModeratorKey        string
+	TopicRateLimit      RateLimit
+	MessageRateLimit    RateLimit
+	JoinRateLimit       RateLimit
+	TrustedProxies      []*net.IPNet
+	CSPReportOnly       bool
+	FrameAncestors      string
+	HSTSMaxAge          time.Duration
+	BannedTerms         []string
+	DisallowedDomains   []string
+	MaxLinks            int
+	MaxMessageLength    int
+	FilterAction        string
+	PreModeration       bool
+	Challenge           bool
+	ChallengeDifficulty int
+	Anonymous           bool
+	OIDCIssuer          string
+	OIDCClientID        string
+	OIDCClientSecret    string
+	OIDCRedirectURL     string
+	SessionStore        string
+	SessionMaxAge       time.Duration
+	SessionIdleTimeout  time.Duration
+	Production          bool
+	SessionKeys         []SessionKeyPair
+	CookieSecure        bool
+	CookieHTTPOnly      bool
+	CookieSameSite      string
+	CookieDomain        string
+	SMTPAddr            string
+	SMTPUsername        string
+	SMTPPassword        string
+	SMTPFrom            string
+	BaseURL             string
+	DigestInterval      time.Duration
+	ReplyDomain         string
+	WebhookInterval     time.Duration
+	Reactions           []string
+}
+
+// SessionKeyPair signs, and if Encryption is set encrypts, session cookies
+type SessionKeyPair struct {
+	Authentication string
+	Encryption     string
+}
+
+// defaultReactions are the emoji readers may react with unless configured
+const defaultReactions = "👍,❤️,😂,🎉,😮,😢"
+
+// minSessionKeyLength is the shortest authentication key accepted in production
+const minSessionKeyLength = 32
+
+// RateLimit allows a burst of Requests, refilling at Requests per Per.
+// A zero RateLimit disables limiting.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
 }
 
 // ParseAppConfig parses flags and/or env vars returning an AppConfig instance
@@ -28,10 +92,285 @@ func ParseAppConfig() AppConfig {
 	port := flag.Int("p", envOrInt("PORT", 8000), "port for app on run on")
 	dbConnectionURI := flag.String("database-url", envOrString("DATABASE_URL", "not-set"), "URI-formatted Postgres connection information (e.g. postgresql://localhost:5433...)")
 	sessionKey := flag.String("session-key", envOrString("SESSION_KEY", "not-set"), "session key for cookie store")
+	moderatorKey := flag.String("moderator-key", envOrString("MODERATOR_KEY", ""), "key granting access to moderation pages, moderation is disabled if empty")
+	topicRateLimit := flag.String("topic-rate-limit", envOrString("TOPIC_RATE_LIMIT", "3/10m"), "topics allowed per client per interval (e.g. 3/10m), empty to disable")
+	messageRateLimit := flag.String("message-rate-limit", envOrString("MESSAGE_RATE_LIMIT", "10/1m"), "messages allowed per client per interval (e.g. 10/1m), empty to disable")
+	joinRateLimit := flag.String("join-rate-limit", envOrString("JOIN_RATE_LIMIT", "5/10m"), "joins allowed per client per interval (e.g. 5/10m), empty to disable")
+	trustedProxies := flag.String("trusted-proxies", envOrString("TRUSTED_PROXIES", ""), "comma-separated IPs or CIDRs of proxies whose X-Forwarded-For header is trusted")
+	cspReportOnly := flag.Bool("csp-report-only", envOrBool("CSP_REPORT_ONLY", false), "report Content-Security-Policy violations to /csp-report without enforcing the policy")
+	frameAncestors := flag.String("frame-ancestors", envOrString("FRAME_ANCESTORS", "'none'"), "CSP frame-ancestors sources allowed to embed Topical")
+	hstsMaxAge := flag.Duration("hsts-max-age", envOrDuration("HSTS_MAX_AGE", 0), "max-age for the Strict-Transport-Security header, HSTS is disabled if 0")
+	bannedTerms := flag.String("banned-terms", envOrString("BANNED_TERMS", ""), "comma-separated words or phrases posts may not contain")
+	disallowedDomains := flag.String("disallowed-domains", envOrString("DISALLOWED_DOMAINS", ""), "comma-separated domains posts may not link to, including their subdomains")
+	maxLinks := flag.Int("max-links", envOrInt("MAX_LINKS", 10), "maximum number of links per post, 0 for no limit")
+	maxMessageLength := flag.Int("max-message-length", envOrInt("MAX_MESSAGE_LENGTH", 20000), "maximum characters per message, 0 for no limit")
+	preModeration := flag.Bool("pre-moderation", envOrBool("PRE_MODERATION", false), "hold messages from authors without an approved message for moderator approval")
+	challenge := flag.Bool("challenge", envOrBool("CHALLENGE", false), "require a proof-of-work challenge and honeypot check when joining and posting topics")
+	challengeDifficulty := flag.Int("challenge-difficulty", envOrInt("CHALLENGE_DIFFICULTY", 18), "leading zero bits the proof-of-work challenge requires, from 1 to 32")
+	anonymous := flag.Bool("anonymous", envOrBool("ANONYMOUS", true), "allow joining with initials alone, without registering an account")
+	oidcIssuer := flag.String("oidc-issuer", envOrString("OIDC_ISSUER", ""), "OpenID Connect issuer URL for single sign-on, single sign-on is disabled if empty")
+	oidcClientID := flag.String("oidc-client-id", envOrString("OIDC_CLIENT_ID", ""), "client ID Topical is registered with at the OpenID Connect provider")
+	oidcClientSecret := flag.String("oidc-client-secret", envOrString("OIDC_CLIENT_SECRET", ""), "client secret for the OpenID Connect provider, empty for public clients")
+	oidcRedirectURL := flag.String("oidc-redirect-url", envOrString("OIDC_REDIRECT_URL", ""), "external URL of Topical's /auth/oidc/callback route registered with the provider")
+	sessionStore := flag.String("session-store", envOrString("SESSION_STORE", "cookie"), "where sessions are kept: cookie, memory, or postgres")
+	sessionMaxAge := flag.Duration("session-max-age", envOrDuration("SESSION_MAX_AGE", 30*24*time.Hour), "how long sessions last after they are created")
+	sessionIdleTimeout := flag.Duration("session-idle-timeout", envOrDuration("SESSION_IDLE_TIMEOUT", 7*24*time.Hour), "how long memory and postgres sessions last unused, 0 to disable")
+	production := flag.Bool("production", envOrBool("PRODUCTION", false), "refuse to start with missing or weak session keys")
+	signingKey := flag.String("signing-key", envOrString("SIGNING_KEY", ""), "key signing challenges, tripcodes, and email links and reply addresses, defaults to session-key")
+	sessionKeys := flag.String("session-keys", envOrString("SESSION_KEYS", ""), "comma-separated authentication[:encryption] session key pairs, newest first, overriding session-key")
+	cookieSecure := flag.Bool("cookie-secure", envOrBool("COOKIE_SECURE", false), "only send the session cookie over HTTPS")
+	cookieHTTPOnly := flag.Bool("cookie-http-only", envOrBool("COOKIE_HTTP_ONLY", true), "hide the session cookie from JavaScript")
+	cookieSameSite := flag.String("cookie-same-site", envOrString("COOKIE_SAME_SITE", "lax"), "SameSite attribute of the session cookie: lax, strict, or none")
+	cookieDomain := flag.String("cookie-domain", envOrString("COOKIE_DOMAIN", ""), "domain attribute of the session cookie, empty for the current host only")
+	filterAction := flag.String("filter-action", envOrString("FILTER_ACTION", "reject"), "what to do with posts breaking the banned term, domain, or link rules: reject or hold")
+	smtpAddr := flag.String("smtp-addr", envOrString("SMTP_ADDR", ""), "host:port of the SMTP relay email digests are sent through, digests are disabled if empty")
+	smtpUsername := flag.String("smtp-username", envOrString("SMTP_USERNAME", ""), "username for the SMTP relay, empty to send without authenticating")
+	smtpPassword := flag.String("smtp-password", envOrString("SMTP_PASSWORD", ""), "password for the SMTP relay")
+	smtpFrom := flag.String("smtp-from", envOrString("SMTP_FROM", ""), "address email digests are sent from")
+	baseURL := flag.String("base-url", envOrString("BASE_URL", ""), "external URL of Topical used for links in emails (e.g. https://topical.example.com)")
+	digestInterval := flag.Duration("digest-interval", envOrDuration("DIGEST_INTERVAL", time.Hour), "how often to check for email digests due to be sent")
+	replyDomain := flag.String("reply-domain", envOrString("REPLY_DOMAIN", ""), "domain of the addresses digest readers reply to by email, replying by email is disabled if empty")
+	webhookInterval := flag.Duration("webhook-interval", envOrDuration("WEBHOOK_INTERVAL", 10*time.Second), "how often to deliver queued webhooks, webhooks are not delivered if 0")
+	reactions := flag.String("reactions", envOrString("REACTIONS", defaultReactions), "comma-separated emoji readers may react to messages with, reactions are disabled if empty")
 
 	flag.Parse()
 
-	return AppConfig{*port, *dbConnectionURI, *sessionKey}
+	if *filterAction != "reject" && *filterAction != "hold" {
+		log.Fatalf("filter-action: expected reject or hold, got %q", *filterAction)
+	}
+
+	if *challengeDifficulty < 1 || *challengeDifficulty > 32 {
+		log.Fatalf("challenge-difficulty: expected 1 to 32, got %d", *challengeDifficulty)
+	}
+
+	if *sessionStore != "cookie" && *sessionStore != "memory" && *sessionStore != "postgres" {
+		log.Fatalf("session-store: expected cookie, memory, or postgres, got %q", *sessionStore)
+	}
+
+	if *cookieSameSite != "lax" && *cookieSameSite != "strict" && *cookieSameSite != "none" {
+		log.Fatalf("cookie-same-site: expected lax, strict, or none, got %q", *cookieSameSite)
+	}
+
+	if *cookieSameSite == "none" && !*cookieSecure {
+		log.Fatal("cookie-same-site: none requires cookie-secure")
+	}
+
+	keyPairs := parseSessionKeys(*sessionKeys)
+
+	if len(keyPairs) == 0 {
+		keyPairs = []SessionKeyPair{{Authentication: *sessionKey}}
+	}
+
+	if err := validateSessionKeys(keyPairs, *production); err != nil {
+		log.Fatalf("session-key: %v", err)
+	}
+
+	if *signingKey == "" {
+		*signingKey = *sessionKey
+	}
+
+	if err := validateSigningKey(*signingKey, *production); err != nil {
+		log.Fatalf("signing-key: %v", err)
+	}
+
+	if *production && !*cookieSecure {
+		log.Print("Warning: running in production without cookie-secure, session cookies will be sent over plain HTTP")
+	}
+
+	if *oidcIssuer != "" && (*oidcClientID == "" || *oidcRedirectURL == "") {
+		log.Fatal("oidc-issuer: oidc-client-id and oidc-redirect-url are required for single sign-on")
+	}
+
+	if *smtpAddr != "" && (*smtpFrom == "" || *baseURL == "") {
+		log.Fatal("smtp-addr: smtp-from and base-url are required for email digests")
+	}
+
+	if *replyDomain != "" && *smtpAddr == "" {
+		log.Fatal("reply-domain: smtp-addr is required for replying by email")
+	}
+
+	if *replyDomain != "" && (*signingKey == "" || *signingKey == "not-set") {
+		log.Fatal("reply-domain: signing-key is required for replying by email, reply addresses could be forged without it")
+	}
+
+	if *digestInterval <= 0 {
+		log.Fatalf("digest-interval: expected a positive duration, got %s", *digestInterval)
+	}
+
+	if *webhookInterval < 0 {
+		log.Fatalf("webhook-interval: expected a positive duration or 0, got %s", *webhookInterval)
+	}
+
+	return AppConfig{
+		Port:                *port,
+		DBConnectionURI:     *dbConnectionURI,
+		SessionKey:          *sessionKey,
+		SigningKey:          *signingKey,
+		ModeratorKey:        *moderatorKey,
+		TopicRateLimit:      parseRateLimit("topic-rate-limit", *topicRateLimit),
+		MessageRateLimit:    parseRateLimit("message-rate-limit", *messageRateLimit),
+		JoinRateLimit:       parseRateLimit("join-rate-limit", *joinRateLimit),
+		TrustedProxies:      parseNetworks("trusted-proxies", *trustedProxies),
+		CSPReportOnly:       *cspReportOnly,
+		FrameAncestors:      *frameAncestors,
+		HSTSMaxAge:          *hstsMaxAge,
+		BannedTerms:         parseList(*bannedTerms),
+		DisallowedDomains:   parseList(*disallowedDomains),
+		MaxLinks:            *maxLinks,
+		MaxMessageLength:    *maxMessageLength,
+		FilterAction:        *filterAction,
+		PreModeration:       *preModeration,
+		Challenge:           *challenge,
+		ChallengeDifficulty: *challengeDifficulty,
+		Anonymous:           *anonymous,
+		OIDCIssuer:          *oidcIssuer,
+		OIDCClientID:        *oidcClientID,
+		OIDCClientSecret:    *oidcClientSecret,
+		OIDCRedirectURL:     *oidcRedirectURL,
+		SessionStore:        *sessionStore,
+		SessionMaxAge:       *sessionMaxAge,
+		SessionIdleTimeout:  *sessionIdleTimeout,
+		Production:          *production,
+		SessionKeys:         keyPairs,
+		CookieSecure:        *cookieSecure,
+		CookieHTTPOnly:      *cookieHTTPOnly,
+		CookieSameSite:      *cookieSameSite,
+		CookieDomain:        *cookieDomain,
+		SMTPAddr:            *smtpAddr,
+		SMTPUsername:        *smtpUsername,
+		SMTPPassword:        *smtpPassword,
+		SMTPFrom:            *smtpFrom,
+		BaseURL:             *baseURL,
+		DigestInterval:      *digestInterval,
+		ReplyDomain:         *replyDomain,
+		WebhookInterval:     *webhookInterval,
+		Reactions:           parseList(*reactions),
+	}
+}
+
+// parseRateLimit parses a limit formatted as `requests/duration`, e.g. `10/1m`
+func parseRateLimit(name string, val string) RateLimit {
+	if val == "" {
+		return RateLimit{}
+	}
+
+	parts := strings.SplitN(val, "/", 2)
+
+	if len(parts) != 2 {
+		log.Fatalf("parseRateLimit[%s]: expected requests/duration, got %q", name, val)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		log.Fatalf("parseRateLimit[%s]: invalid request count %q", name, parts[0])
+	}
+
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		log.Fatalf("parseRateLimit[%s]: invalid duration %q", name, parts[1])
+	}
+
+	return RateLimit{requests, per}
+}
+
+// parseSessionKeys parses comma-separated `authentication[:encryption]` key pairs
+func parseSessionKeys(val string) []SessionKeyPair {
+	var pairs []SessionKeyPair
+
+	for _, s := range parseList(val) {
+		parts := strings.SplitN(s, ":", 2)
+		pair := SessionKeyPair{Authentication: parts[0]}
+
+		if len(parts) == 2 {
+			pair.Encryption = parts[1]
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	return pairs
+}
+
+// validateSessionKeys checks encryption keys have a valid AES key length
+// and, in production, that authentication keys are set and long enough
+func validateSessionKeys(pairs []SessionKeyPair, production bool) error {
+	for i, pair := range pairs {
+		switch len(pair.Encryption) {
+		case 0, 16, 24, 32:
+		default:
+			return fmt.Errorf("encryption key %d must be 16, 24, or 32 bytes", i+1)
+		}
+
+		if !production {
+			continue
+		}
+
+		if pair.Authentication == "" || pair.Authentication == "not-set" {
+			return errors.New("a session key is required in production")
+		}
+
+		if len(pair.Authentication) < minSessionKeyLength {
+			return fmt.Errorf("authentication key %d must be at least %d bytes in production", i+1, minSessionKeyLength)
+		}
+	}
+
+	return nil
+}
+
+// validateSigningKey checks, in production, that the signing key is set and
+// long enough. Unlike session keys it is never rotated, so it can't be
+// taken from session-keys.
+func validateSigningKey(key string, production bool) error {
+	if !production {
+		return nil
+	}
+
+	if key == "" || key == "not-set" {
+		return errors.New("a signing key, or session-key, is required in production")
+	}
+
+	if len(key) < minSessionKeyLength {
+		return fmt.Errorf("signing key must be at least %d bytes in production", minSessionKeyLength)
+	}
+
+	return nil
+}
+
+// parseList parses a comma-separated list, dropping empty entries
+func parseList(val string) []string {
+	var list []string
+
+	for _, s := range strings.Split(val, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+// parseNetworks parses a comma-separated list of IPs and CIDRs
+func parseNetworks(name string, val string) []*net.IPNet {
+	var networks []*net.IPNet
+
+	for _, s := range parseList(val) {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			log.Fatalf("parseNetworks[%s]: %v", name, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
 }
 
 func envOrString(key string, defaultVal string) string {
@@ -51,3 +390,25 @@ func envOrInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func envOrBool(key string, defaultVal bool) bool {
+	if val, ok := os.LookupEnv(key); ok {
+		value, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Fatalf("envOrBool[%s]: %v", key, err)
+		}
+		return value
+	}
+	return defaultVal
+}
+
+func envOrDuration(key string, defaultVal time.Duration) time.Duration {
+	if val, ok := os.LookupEnv(key); ok {
+		value, err := time.ParseDuration(val)
+		if err != nil {
+			log.Fatalf("envOrDuration[%s]: %v", key, err)
+		}
+		return value
+	}
+	return defaultVal
+}
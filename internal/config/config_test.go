@@ -1,8 +1,11 @@
 package config
 
 import (
+	"net"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var initialArgs []string
@@ -17,17 +20,139 @@ func testTeardown() {
 
 func TestParseAppConfig(t *testing.T) {
 	t.Run("parses known flags and returns config object", func(t *testing.T) {
-		want := AppConfig{Port: 1234, DBConnectionURI: "example.com/topical", SessionKey: "big_session_key"}
+		_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+		_, proxy, _ := net.ParseCIDR("192.168.1.1/32")
+		want := AppConfig{
+			Port:                1234,
+			DBConnectionURI:     "example.com/topical",
+			SessionKey:          "big_session_key",
+			SigningKey:          "big_session_key",
+			ModeratorKey:        "mod_key",
+			TopicRateLimit:      RateLimit{Requests: 2, Per: time.Hour},
+			MessageRateLimit:    RateLimit{Requests: 10, Per: time.Minute},
+			JoinRateLimit:       RateLimit{},
+			TrustedProxies:      []*net.IPNet{proxies, proxy},
+			CSPReportOnly:       true,
+			FrameAncestors:      "'none'",
+			HSTSMaxAge:          24 * time.Hour,
+			BannedTerms:         []string{"casino", "free money"},
+			DisallowedDomains:   nil,
+			MaxLinks:            3,
+			MaxMessageLength:    20000,
+			FilterAction:        "hold",
+			PreModeration:       true,
+			Challenge:           true,
+			ChallengeDifficulty: 12,
+			Anonymous:           false,
+			OIDCIssuer:          "https://id.example.com",
+			OIDCClientID:        "topical",
+			OIDCClientSecret:    "",
+			OIDCRedirectURL:     "https://topical.example.com/auth/oidc/callback",
+			SessionStore:        "postgres",
+			SessionMaxAge:       30 * 24 * time.Hour,
+			SessionIdleTimeout:  2 * time.Hour,
+			Production:          false,
+			SessionKeys:         []SessionKeyPair{{Authentication: "big_session_key"}},
+			CookieSecure:        true,
+			CookieHTTPOnly:      true,
+			CookieSameSite:      "strict",
+			CookieDomain:        "example.com",
+			SMTPAddr:            "localhost:25",
+			SMTPUsername:        "",
+			SMTPPassword:        "",
+			SMTPFrom:            "topical@example.com",
+			BaseURL:             "https://topical.example.com",
+			DigestInterval:      15 * time.Minute,
+			ReplyDomain:         "reply.example.com",
+			WebhookInterval:     10 * time.Second,
+			Reactions:           []string{"👍", "🎉"},
+		}
 		testSetup()
 
-		mockArgs := []string{"_", "-p=1234", "-database-url=example.com/topical", "-session-key=big_session_key"}
+		mockArgs := []string{
+			"_", "-p=1234", "-database-url=example.com/topical", "-session-key=big_session_key", "-moderator-key=mod_key",
+			"-topic-rate-limit=2/1h", "-join-rate-limit=", "-trusted-proxies=10.0.0.0/8, 192.168.1.1",
+			"-csp-report-only", "-hsts-max-age=24h",
+			"-banned-terms=casino, free money", "-max-links=3", "-filter-action=hold", "-pre-moderation",
+			"-challenge", "-challenge-difficulty=12", "-anonymous=false",
+			"-oidc-issuer=https://id.example.com", "-oidc-client-id=topical", "-oidc-redirect-url=https://topical.example.com/auth/oidc/callback",
+			"-session-store=postgres", "-session-idle-timeout=2h",
+			"-cookie-secure", "-cookie-same-site=strict", "-cookie-domain=example.com",
+			"-smtp-addr=localhost:25", "-smtp-from=topical@example.com", "-base-url=https://topical.example.com", "-digest-interval=15m",
+			"-reply-domain=reply.example.com", "-reactions=👍, 🎉",
+		}
 		os.Args = mockArgs
 		got := ParseAppConfig()
 
-		if got != want {
+		if !reflect.DeepEqual(got, want) {
 			t.Error("parsed config does not match expected config")
 		}
 
 		testTeardown()
 	})
 }
+
+func TestParseSessionKeys(t *testing.T) {
+	got := parseSessionKeys("new_key:0123456789abcdef, old_key")
+	want := []SessionKeyPair{
+		{Authentication: "new_key", Encryption: "0123456789abcdef"},
+		{Authentication: "old_key"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v but wanted %+v", got, want)
+	}
+}
+
+func TestValidateSigningKey(t *testing.T) {
+	strong := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		key        string
+		production bool
+		valid      bool
+	}{
+		{"default key in development", "not-set", false, true},
+		{"default key in production", "not-set", true, false},
+		{"missing key in production", "", true, false},
+		{"short key in production", "short", true, false},
+		{"strong key in production", strong, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSigningKey(tt.key, tt.production)
+
+			if (err == nil) != tt.valid {
+				t.Errorf("got error %v, wanted valid to be %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateSessionKeys(t *testing.T) {
+	strong := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		pairs      []SessionKeyPair
+		production bool
+		valid      bool
+	}{
+		{"weak key in development", []SessionKeyPair{{Authentication: "not-set"}}, false, true},
+		{"missing key in production", []SessionKeyPair{{Authentication: "not-set"}}, true, false},
+		{"short key in production", []SessionKeyPair{{Authentication: "short"}}, true, false},
+		{"short rotated out key in production", []SessionKeyPair{{Authentication: strong}, {Authentication: "short"}}, true, false},
+		{"strong keys in production", []SessionKeyPair{{Authentication: strong, Encryption: strong}}, true, true},
+		{"invalid encryption key length", []SessionKeyPair{{Authentication: strong, Encryption: "short"}}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSessionKeys(tt.pairs, tt.production)
+
+			if (err == nil) != tt.valid {
+				t.Errorf("got error %v, wanted valid to be %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+// Package digest emails recipients a summary of activity in the topics they
+// watch, and signs the links in those emails
+package digest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jkulton/topical/internal/mailer"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// Store is the storage the Digester reads digests and activity from
+type Store interface {
+	GetDueDigests() ([]models.Digest, error)
+	GetDigestActivity(recipientKey string, since time.Time) ([]models.Message, time.Time, error)
+	MarkDigestSent(recipientKey string, until time.Time) error
+}
+
+// Sender delivers email, satisfied by *mailer.Mailer
+type Sender interface {
+	Send(msg mailer.Message) error
+}
+
+// Config specifies where links in digests point and how they're signed.
+// Digests offer reply addresses at ReplyDomain when it's set.
+type Config struct {
+	BaseURL     string
+	Key         []byte
+	ReplyDomain string
+}
+
+// Digester sends digests and confirmation emails, rendered from the
+// "digest" and "digest-confirm" templates, with signed links
+type Digester struct {
+	store     Store
+	sender    Sender
+	templates *template.Template
+	config    Config
+}
+
+// topicActivity is the new messages in one topic of a digest
+type topicActivity struct {
+	Title        string
+	URL          string
+	ReplyAddress string
+	Messages     []models.Message
+}
+
+// replySignatureLength is how many hex characters of a reply address
+// signature are kept, short enough to fit the address's local part
+const replySignatureLength = 20
+
+// New returns a Digester
+func New(store Store, sender Sender, templates *template.Template, config Config) *Digester {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &Digester{store, sender, templates, config}
+}
+
+// Start sends due digests every interval until the returned stop function is called
+func (d *Digester) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.SendDue()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// SendDue sends every digest which is due, returning how many were sent.
+// Digests without new activity are skipped until the next period.
+func (d *Digester) SendDue() int {
+	digests, err := d.store.GetDueDigests()
+
+	if err != nil {
+		log.Print("Error getting due digests: ", err.Error())
+		return 0
+	}
+
+	sent := 0
+
+	for _, digest := range digests {
+		ok, until, err := d.send(digest)
+
+		if err != nil {
+			log.Print("Error sending digest: ", err.Error())
+			continue
+		}
+
+		if err := d.store.MarkDigestSent(digest.RecipientKey, until); err != nil {
+			log.Print("Error marking digest sent: ", err.Error())
+			continue
+		}
+
+		if ok {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d digests", sent)
+	}
+
+	return sent
+}
+
+// send emails a digest of the activity since it was last sent, returning
+// false if there was nothing to send, and the time the activity was read up
+// to, which the next digest starts from
+func (d *Digester) send(digest models.Digest) (bool, time.Time, error) {
+	messages, until, err := d.store.GetDigestActivity(digest.RecipientKey, digest.LastSent)
+
+	if err != nil || len(messages) == 0 {
+		return false, until, err
+	}
+
+	topics := []topicActivity{}
+	index := map[int]int{}
+
+	for _, m := range messages {
+		i, ok := index[*m.TopicID]
+
+		if !ok {
+			i = len(topics)
+			index[*m.TopicID] = i
+			topics = append(topics, topicActivity{
+				Title:        m.TopicTitle,
+				URL:          d.link(fmt.Sprintf("/topics/%d", *m.TopicID), nil),
+				ReplyAddress: d.ReplyAddress(digest.RecipientKey, *m.TopicID),
+			})
+		}
+
+		topics[i].Messages = append(topics[i].Messages, m)
+	}
+
+	unsubscribeURL := d.UnsubscribeURL(digest.RecipientKey)
+	data := struct {
+		Frequency      string
+		Topics         []topicActivity
+		SettingsURL    string
+		UnsubscribeURL string
+	}{digest.Frequency, topics, d.link("/settings", nil), unsubscribeURL}
+
+	body, err := d.render("digest", data)
+
+	if err != nil {
+		return false, until, err
+	}
+
+	headers := map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	// Replying to a digest of a single topic replies in that topic
+	if len(topics) == 1 && topics[0].ReplyAddress != "" {
+		headers["Reply-To"] = topics[0].ReplyAddress
+	}
+
+	err = d.sender.Send(mailer.Message{
+		To:      digest.Email,
+		Subject: fmt.Sprintf("Your %s Topical digest: %d new messages", digest.Frequency, len(messages)),
+		Body:    body,
+		Headers: headers,
+	})
+
+	return err == nil, until, err
+}
+
+// SendConfirmation emails a link the recipient follows to confirm they own
+// the digest's email
+func (d *Digester) SendConfirmation(digest models.Digest) error {
+	data := struct {
+		Frequency  string
+		ConfirmURL string
+	}{digest.Frequency, d.ConfirmURL(digest.RecipientKey, digest.Email)}
+
+	body, err := d.render("digest-confirm", data)
+
+	if err != nil {
+		return err
+	}
+
+	return d.sender.Send(mailer.Message{To: digest.Email, Subject: "Confirm your Topical digest", Body: body})
+}
+
+func (d *Digester) render(name string, data interface{}) (string, error) {
+	var b bytes.Buffer
+
+	if err := d.templates.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// UnsubscribeURL returns a link turning off the recipient's digest
+func (d *Digester) UnsubscribeURL(recipientKey string) string {
+	return d.link("/digest/unsubscribe", url.Values{
+		"key": {recipientKey},
+		"sig": {d.sign("unsubscribe", recipientKey)},
+	})
+}
+
+// ConfirmURL returns a link confirming the recipient owns email
+func (d *Digester) ConfirmURL(recipientKey string, email string) string {
+	return d.link("/digest/confirm", url.Values{
+		"key":   {recipientKey},
+		"email": {email},
+		"sig":   {d.sign("confirm", recipientKey, email)},
+	})
+}
+
+// VerifyUnsubscribe reports whether sig came from an UnsubscribeURL for the recipient
+func (d *Digester) VerifyUnsubscribe(recipientKey string, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(d.sign("unsubscribe", recipientKey)))
+}
+
+// VerifyConfirm reports whether sig came from a ConfirmURL for the recipient and email
+func (d *Digester) VerifyConfirm(recipientKey string, email string, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(d.sign("confirm", recipientKey, email)))
+}
+
+// ReplyAddress returns the address the recipient emails to reply in a
+// topic, or "" if replying by email is disabled
+func (d *Digester) ReplyAddress(recipientKey string, topicID int) string {
+	if d.config.ReplyDomain == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("reply+%d-%s@%s", topicID, d.replySignature(recipientKey, topicID), d.config.ReplyDomain)
+}
+
+// ParseReplyAddress returns the topic and signature in a reply address,
+// ok is false if the address isn't one
+func (d *Digester) ParseReplyAddress(address string) (topicID int, sig string, ok bool) {
+	at := strings.LastIndex(address, "@")
+
+	if d.config.ReplyDomain == "" || at == -1 || !strings.EqualFold(address[at+1:], d.config.ReplyDomain) {
+		return 0, "", false
+	}
+
+	local := strings.ToLower(address[:at])
+
+	if !strings.HasPrefix(local, "reply+") {
+		return 0, "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(local, "reply+"), "-", 2)
+
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+
+	topicID, err := strconv.Atoi(parts[0])
+
+	if err != nil {
+		return 0, "", false
+	}
+
+	return topicID, parts[1], true
+}
+
+// VerifyReply reports whether sig came from a ReplyAddress for the recipient and topic
+func (d *Digester) VerifyReply(recipientKey string, topicID int, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(d.replySignature(recipientKey, topicID)))
+}
+
+func (d *Digester) replySignature(recipientKey string, topicID int) string {
+	return d.sign("reply", recipientKey, strconv.Itoa(topicID))[:replySignatureLength]
+}
+
+// sign returns a keyed hash of a link's purpose and values, so links can't
+// be forged to act on someone else's digest
+func (d *Digester) sign(purpose string, values ...string) string {
+	mac := hmac.New(sha256.New, d.config.Key)
+	mac.Write([]byte("digest-" + purpose))
+
+	for _, v := range values {
+		mac.Write([]byte{0})
+		mac.Write([]byte(v))
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Digester) link(path string, query url.Values) string {
+	link := d.config.BaseURL + path
+
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+
+	return link
+}
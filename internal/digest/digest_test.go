@@ -0,0 +1,220 @@
+package digest
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jkulton/topical/internal/mailer"
+	"github.com/jkulton/topical/internal/mailer/mailertest"
+	"github.com/jkulton/topical/internal/models"
+	"github.com/jkulton/topical/internal/templates"
+)
+
+type fakeStore struct {
+	due      []models.Digest
+	activity map[string][]models.Message
+	sent     []string
+	until    []time.Time
+}
+
+func (s *fakeStore) GetDueDigests() ([]models.Digest, error) {
+	return s.due, nil
+}
+
+// activityRead is when the fake store's activity is read up to
+var activityRead = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func (s *fakeStore) GetDigestActivity(recipientKey string, since time.Time) ([]models.Message, time.Time, error) {
+	if recipientKey == "broken" {
+		return nil, activityRead, errors.New("activity error")
+	}
+
+	return s.activity[recipientKey], activityRead, nil
+}
+
+func (s *fakeStore) MarkDigestSent(recipientKey string, until time.Time) error {
+	s.sent = append(s.sent, recipientKey)
+	s.until = append(s.until, until)
+	return nil
+}
+
+func newTestDigester(t *testing.T, store Store) (*Digester, *mailertest.Server) {
+	emails, err := templates.GenerateEmailTemplates("../../web/emails/*.tmpl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay := mailertest.New()
+	m := mailer.New(mailer.Config{Addr: relay.Addr, From: "topical@example.com"})
+
+	return New(store, m, emails, Config{BaseURL: "https://topical.example.com/", Key: []byte("key"), ReplyDomain: "reply.example.com"}), relay
+}
+
+func TestSendDue(t *testing.T) {
+	one, two := 1, 2
+	store := &fakeStore{
+		due: []models.Digest{
+			{RecipientKey: "active", Email: "active@example.com", Frequency: "daily"},
+			{RecipientKey: "quiet", Email: "quiet@example.com", Frequency: "weekly"},
+			{RecipientKey: "broken", Email: "broken@example.com", Frequency: "daily"},
+		},
+		activity: map[string][]models.Message{
+			"active": {
+				{TopicID: &one, TopicTitle: "First Topic", AuthorInitials: "AK", Content: "Hello\nthere"},
+				{TopicID: &two, TopicTitle: "Second Topic", AuthorInitials: "JK", Content: "Reply"},
+				{TopicID: &one, TopicTitle: "First Topic", AuthorInitials: "JK", Content: "Again"},
+			},
+		},
+	}
+	d, relay := newTestDigester(t, store)
+	defer relay.Close()
+
+	if sent := d.SendDue(); sent != 1 {
+		t.Errorf("got %d digests sent but wanted 1", sent)
+	}
+
+	if strings.Join(store.sent, ",") != "active,quiet" {
+		t.Errorf("got digests marked sent %v but wanted active and quiet", store.sent)
+	}
+
+	for _, until := range store.until {
+		if !until.Equal(activityRead) {
+			t.Errorf("got digest marked sent up to %s but wanted the time activity was read up to", until)
+		}
+	}
+
+	messages := relay.Messages()
+
+	if len(messages) != 1 {
+		t.Fatalf("got %d emails but wanted 1", len(messages))
+	}
+
+	email := messages[0]
+
+	if email.To[0] != "active@example.com" {
+		t.Errorf("got email to %v", email.To)
+	}
+
+	if subject := email.Header.Get("Subject"); subject != "Your daily Topical digest: 3 new messages" {
+		t.Errorf("got subject %q", subject)
+	}
+
+	unsubscribe := d.UnsubscribeURL("active")
+
+	if got := email.Header.Get("List-Unsubscribe"); got != "<"+unsubscribe+">" {
+		t.Errorf("got List-Unsubscribe %q", got)
+	}
+
+	if got := email.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("got List-Unsubscribe-Post %q", got)
+	}
+
+	for _, want := range []string{"First Topic\nhttps://topical.example.com/topics/1", "> Hello\n> there", "Second Topic", unsubscribe} {
+		if !strings.Contains(email.Body, want) {
+			t.Errorf("expected body to contain %q, got %q", want, email.Body)
+		}
+	}
+
+	if email.Header.Get("Reply-To") != "" {
+		t.Error("expected no Reply-To for a digest of several topics")
+	}
+
+	if !strings.Contains(email.Body, "Reply by email: "+d.ReplyAddress("active", 2)) {
+		t.Error("expected reply addresses for each topic")
+	}
+
+	if strings.Index(email.Body, "Again") > strings.Index(email.Body, "Second Topic") {
+		t.Error("expected messages to be grouped by topic")
+	}
+}
+
+func TestSendConfirmation(t *testing.T) {
+	d, relay := newTestDigester(t, &fakeStore{})
+	defer relay.Close()
+
+	err := d.SendConfirmation(models.Digest{RecipientKey: "key", Email: "jk@example.com", Frequency: "weekly"})
+
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	messages := relay.Messages()
+
+	if len(messages) != 1 || !strings.Contains(messages[0].Body, d.ConfirmURL("key", "jk@example.com")) {
+		t.Errorf("expected a confirmation email with a confirm link, got %+v", messages)
+	}
+}
+
+func TestSignedLinks(t *testing.T) {
+	d := New(&fakeStore{}, nil, nil, Config{BaseURL: "https://topical.example.com", Key: []byte("key"), ReplyDomain: "reply.example.com"})
+
+	t.Run("verifies unsubscribe links", func(t *testing.T) {
+		link, _ := url.Parse(d.UnsubscribeURL("recipient"))
+		sig := link.Query().Get("sig")
+
+		if link.Path != "/digest/unsubscribe" || link.Query().Get("key") != "recipient" {
+			t.Errorf("got unsubscribe link %s", link)
+		}
+
+		if !d.VerifyUnsubscribe("recipient", sig) {
+			t.Error("expected signature to verify")
+		}
+
+		if d.VerifyUnsubscribe("someone-else", sig) {
+			t.Error("expected signature not to verify for another recipient")
+		}
+
+		if d.VerifyConfirm("recipient", "", sig) {
+			t.Error("expected unsubscribe signature not to confirm")
+		}
+	})
+
+	t.Run("verifies confirm links", func(t *testing.T) {
+		link, _ := url.Parse(d.ConfirmURL("recipient", "jk@example.com"))
+		sig := link.Query().Get("sig")
+
+		if !d.VerifyConfirm("recipient", "jk@example.com", sig) {
+			t.Error("expected signature to verify")
+		}
+
+		if d.VerifyConfirm("recipient", "other@example.com", sig) {
+			t.Error("expected signature not to verify for another email")
+		}
+	})
+
+	t.Run("verifies reply addresses", func(t *testing.T) {
+		address := d.ReplyAddress("recipient", 42)
+		topicID, sig, ok := d.ParseReplyAddress(strings.ToUpper(address))
+
+		if !ok || topicID != 42 || !strings.HasPrefix(address, "reply+42-") || !strings.HasSuffix(address, "@reply.example.com") {
+			t.Fatalf("got reply address %s parsed as %d %s %v", address, topicID, sig, ok)
+		}
+
+		if !d.VerifyReply("recipient", 42, sig) {
+			t.Error("expected signature to verify")
+		}
+
+		if d.VerifyReply("recipient", 43, sig) || d.VerifyReply("someone-else", 42, sig) {
+			t.Error("expected signature not to verify for another topic or recipient")
+		}
+
+		for _, other := range []string{"reply+42-abc@elsewhere.com", "hello@reply.example.com", "reply+x-abc@reply.example.com"} {
+			if _, _, ok := d.ParseReplyAddress(other); ok {
+				t.Errorf("expected %s not to parse", other)
+			}
+		}
+	})
+
+	t.Run("rejects signatures from another key", func(t *testing.T) {
+		other := New(&fakeStore{}, nil, nil, Config{BaseURL: "https://topical.example.com", Key: []byte("other")})
+		link, _ := url.Parse(other.UnsubscribeURL("recipient"))
+
+		if d.VerifyUnsubscribe("recipient", link.Query().Get("sig")) {
+			t.Error("expected signature from another key not to verify")
+		}
+	})
+}
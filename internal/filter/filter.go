@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jkulton/topical/internal/markdown"
+)
+
+// Action is what a Policy decides should happen to a post
+type Action int
+
+const (
+	// Allow publishes the post as usual
+	Allow Action = iota
+	// Hold saves the post hidden until a moderator reviews it
+	Hold
+	// Reject refuses to save the post
+	Reject
+)
+
+// Verdict is the outcome of checking a post against a Policy
+type Verdict struct {
+	Action Action
+	Reason string
+}
+
+// Policy holds the rules posts are checked against before they are saved
+type Policy struct {
+	maxLength         int
+	maxLinks          int
+	disallowedDomains []string
+	bannedTerms       *regexp.Regexp
+	ruleAction        Action
+}
+
+// New returns a Policy. Posts longer than maxLength characters are always
+// rejected, while posts using banned terms, linking to disallowed domains
+// (or their subdomains), or including more than maxLinks links receive
+// ruleAction. A zero maxLength or maxLinks means no limit.
+func New(bannedTerms []string, disallowedDomains []string, maxLinks int, maxLength int, ruleAction Action) *Policy {
+	p := &Policy{
+		maxLength:  maxLength,
+		maxLinks:   maxLinks,
+		ruleAction: ruleAction,
+	}
+
+	for _, d := range disallowedDomains {
+		p.disallowedDomains = append(p.disallowedDomains, strings.ToLower(strings.TrimPrefix(d, ".")))
+	}
+
+	var quoted []string
+	for _, term := range bannedTerms {
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+
+	if len(quoted) > 0 {
+		// Terms must stand alone, not be part of a longer word. \b can't
+		// be used since it never matches next to terms starting or ending
+		// with punctuation, like c++ or $scam.
+		p.bannedTerms = regexp.MustCompile(`(?i)(?:^|[^\pL\pN_])(?:` + strings.Join(quoted, "|") + `)(?:$|[^\pL\pN_])`)
+	}
+
+	return p
+}
+
+// Check returns the verdict for a post's text
+func (p *Policy) Check(text string) Verdict {
+	if p.maxLength > 0 && utf8.RuneCountInString(text) > p.maxLength {
+		return Verdict{Reject, fmt.Sprintf("Posts cannot be longer than %d characters", p.maxLength)}
+	}
+
+	if p.bannedTerms != nil && p.bannedTerms.MatchString(text) {
+		return Verdict{p.ruleAction, "Posts cannot contain banned terms"}
+	}
+
+	hosts := linkHosts(text)
+
+	if p.maxLinks > 0 && len(hosts) > p.maxLinks {
+		return Verdict{p.ruleAction, fmt.Sprintf("Posts cannot contain more than %d links", p.maxLinks)}
+	}
+
+	for _, host := range hosts {
+		if domain := p.disallowedDomain(host); domain != "" {
+			return Verdict{p.ruleAction, fmt.Sprintf("Posts cannot link to %s", domain)}
+		}
+	}
+
+	return Verdict{Allow, ""}
+}
+
+// linkHosts returns the host of each link in a post's markdown which leads
+// to another site, as rendered, so protocol-relative links like
+// //example.com are caught too. Links within Topical are left out.
+func linkHosts(text string) []string {
+	hosts := []string{}
+
+	for _, link := range markdown.Links(text) {
+		u, err := url.Parse(strings.TrimSpace(link))
+
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return hosts
+}
+
+func (p *Policy) disallowedDomain(host string) string {
+	host = strings.ToLower(host)
+
+	for _, d := range p.disallowedDomains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return d
+		}
+	}
+
+	return ""
+}
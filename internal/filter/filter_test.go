@@ -0,0 +1,49 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	policy := New([]string{"casino", "free money", "c++", "$scam"}, []string{"spam.example"}, 2, 60, Hold)
+
+	tests := []struct {
+		name string
+		text string
+		want Action
+	}{
+		{"allows ordinary posts", "Check out [Platter](https://github.com/jkulton/platter)", Allow},
+		{"rejects posts over the max length", "This message is far too long to be allowed by the content policy in place", Reject},
+		{"holds posts with banned terms in any case", "Visit our CASINO", Hold},
+		{"holds posts with banned phrases", "get free money", Hold},
+		{"only matches banned terms as whole words", "occasionally", Allow},
+		{"holds posts with too many links", "http://a.com http://b.com http://c.com", Hold},
+		{"holds posts linking to disallowed domains", "see https://spam.example/offer", Hold},
+		{"holds posts linking to subdomains of disallowed domains", "see http://www.Spam.example", Hold},
+		{"allows domains merely ending in a disallowed domain", "see https://notspam.example", Allow},
+		{"holds posts with banned terms ending in punctuation", "I love C++!", Hold},
+		{"holds posts with banned terms starting with punctuation", "a $scam here", Hold},
+		{"only matches punctuated banned terms standing alone", "abc++ or a$scammer", Allow},
+		{"holds protocol-relative links to disallowed domains", "[x](//spam.example/offer)", Hold},
+		{"holds reference links to disallowed domains", "[x][r]\n\n[r]: //spam.example", Hold},
+		{"holds images from disallowed domains", "![x](//spam.example/a.png)", Hold},
+		{"holds autolinks to disallowed domains", "<https://spam.example>", Hold},
+		{"counts protocol-relative links", "[a](//a.com) [b](//b.com) [c](//c.com)", Hold},
+		{"counts each markdown link once", "[a](https://a.com) [b](https://b.com)", Allow},
+		{"ignores links within Topical", "[a](/topics/1) [b](/topics/2) [c](/u/AK)", Allow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Check(tt.text); got.Action != tt.want {
+				t.Errorf("got action %d (%s) but wanted %d", got.Action, got.Reason, tt.want)
+			}
+		})
+	}
+
+	t.Run("an empty policy allows everything", func(t *testing.T) {
+		if got := New(nil, nil, 0, 0, Reject).Check("http://a.com http://b.com"); got.Action != Allow {
+			t.Errorf("got action %d but wanted %d", got.Action, Allow)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Package inbound parses email replies, keeping only what the sender wrote
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// ErrNoText is returned for mail without a plain text body
+var ErrNoText = errors.New("no plain text body")
+
+// Reply is an email sent to one or more addresses
+type Reply struct {
+	From string
+	// Recipients are the addresses the reply was delivered to, from its
+	// delivery headers as well as To and Cc
+	Recipients []string
+	// Automatic is true for auto-replies such as out of office messages,
+	// which shouldn't be posted
+	Automatic bool
+	// Text is the plain text body, with quoted text and signatures removed
+	Text string
+}
+
+// recipientHeaders are the headers recipients are read from, MTAs record
+// the envelope recipient in the delivery headers
+var recipientHeaders = []string{"Delivered-To", "X-Original-To", "To", "Cc"}
+
+// Parse reads an email, returning ErrNoText if it has no plain text body
+func Parse(r io.Reader) (*Reply, error) {
+	msg, err := mail.ReadMessage(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &Reply{From: from.Address, Automatic: automatic(msg.Header)}
+
+	for _, name := range recipientHeaders {
+		addresses, err := msg.Header.AddressList(name)
+
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addresses {
+			reply.Recipients = append(reply.Recipients, a.Address)
+		}
+	}
+
+	text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply.Text = StripQuoted(text)
+
+	return reply, nil
+}
+
+// automatic reports whether headers mark a message as sent automatically
+func automatic(h mail.Header) bool {
+	if submitted := strings.ToLower(h.Get("Auto-Submitted")); submitted != "" && submitted != "no" {
+		return true
+	}
+
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list", "auto_reply":
+		return true
+	}
+
+	return h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+// plainText returns the first text/plain part of a body, decoded
+func plainText(contentType string, encoding string, body io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+
+		for {
+			part, err := parts.NextRawPart()
+
+			if err == io.EOF {
+				return "", ErrNoText
+			}
+
+			if err != nil {
+				return "", err
+			}
+
+			text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+
+			if err != ErrNoText {
+				return text, err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", ErrNoText
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	b, err := ioutil.ReadAll(body)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))), nil
+}
+
+var (
+	// attribution matches the line mail clients put above quoted text,
+	// e.g. "On Mon, Jan 2, 2006 at 3:04 PM Topical <...> wrote:"
+	attribution = regexp.MustCompile(`(?i)^on\s.*\swrote:$`)
+	// separator matches a signature delimiter, or the header Outlook and
+	// others start quoted and forwarded messages with
+	separator = regexp.MustCompile(`(?i)^(--|-+ ?original message ?-+|_{10,}|from: .+@.+)$`)
+)
+
+// StripQuoted removes the text a reply quotes, everything from the first
+// attribution line, quoted line, or separator, along with any signature
+func StripQuoted(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := []string{}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, ">") || attribution.MatchString(trimmed) || separator.MatchString(trimmed) {
+			break
+		}
+
+		// Long attributions are often wrapped over two lines
+		if i+1 < len(lines) && attribution.MatchString(trimmed+" "+strings.TrimSpace(lines[i+1])) {
+			break
+		}
+
+		kept = append(kept, line)
+	}
+
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
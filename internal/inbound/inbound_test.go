@@ -0,0 +1,106 @@
+package inbound
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("reads the sender, recipients, and plain text", func(t *testing.T) {
+		raw := "From: JK <jk@example.com>\r\n" +
+			"To: reply+4-abc@reply.example.com\r\n" +
+			"Cc: Someone <someone@example.com>\r\n" +
+			"Subject: Re: Your digest\r\n" +
+			"\r\n" +
+			"Sounds good to me.\r\n" +
+			"\r\n" +
+			"On Mon, Jan 2, 2006 at 3:04 PM Topical <topical@example.com> wrote:\r\n" +
+			"> Earlier message\r\n"
+
+		reply, err := Parse(strings.NewReader(raw))
+
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if reply.From != "jk@example.com" {
+			t.Errorf("got from %q", reply.From)
+		}
+
+		if strings.Join(reply.Recipients, ",") != "reply+4-abc@reply.example.com,someone@example.com" {
+			t.Errorf("got recipients %v", reply.Recipients)
+		}
+
+		if reply.Text != "Sounds good to me." || reply.Automatic {
+			t.Errorf("got reply %+v", reply)
+		}
+	})
+
+	t.Run("reads the plain text part of multipart mail", func(t *testing.T) {
+		raw := "From: jk@example.com\r\n" +
+			"Delivered-To: reply+4-abc@reply.example.com\r\n" +
+			"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+			"\r\n" +
+			"--b1\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Caf=C3=A9 at noon?\r\n" +
+			"--b1\r\n" +
+			"Content-Type: text/html; charset=utf-8\r\n" +
+			"\r\n" +
+			"<p>Café at noon?</p>\r\n" +
+			"--b1--\r\n"
+
+		reply, err := Parse(strings.NewReader(raw))
+
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if reply.Text != "Café at noon?" || reply.Recipients[0] != "reply+4-abc@reply.example.com" {
+			t.Errorf("got reply %+v", reply)
+		}
+	})
+
+	t.Run("flags automatic replies", func(t *testing.T) {
+		raw := "From: jk@example.com\r\nAuto-Submitted: auto-replied\r\n\r\nI'm out of office.\r\n"
+		reply, err := Parse(strings.NewReader(raw))
+
+		if err != nil || !reply.Automatic {
+			t.Errorf("expected an automatic reply, got %+v %v", reply, err)
+		}
+	})
+
+	t.Run("rejects mail without plain text", func(t *testing.T) {
+		raw := "From: jk@example.com\r\nContent-Type: text/html\r\n\r\n<p>Hi</p>\r\n"
+
+		if _, err := Parse(strings.NewReader(raw)); err != ErrNoText {
+			t.Errorf("got error %v but wanted ErrNoText", err)
+		}
+	})
+}
+
+func TestStripQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"keeps unquoted text", "First line\n\nSecond line\n", "First line\n\nSecond line"},
+		{"removes quoted lines", "Reply\n> quoted\n> more", "Reply"},
+		{"removes wrapped attributions", "Reply\n\nOn Mon, Jan 2, 2006 at 3:04 PM Topical\n<topical@example.com> wrote:\n\nquoted", "Reply"},
+		{"removes signatures", "Reply\n-- \nJK\nSent from my phone", "Reply"},
+		{"removes outlook quotes", "Reply\n\n-----Original Message-----\nFrom: Topical", "Reply"},
+		{"removes outlook headers", "Reply\n________________________________\nFrom: Topical <topical@example.com>", "Reply"},
+		{"keeps markdown rules", "Before\n---\nAfter", "Before\n---\nAfter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuoted(tt.text); got != tt.want {
+				t.Errorf("got %q but wanted %q", got, tt.want)
+			}
+		})
+	}
+}
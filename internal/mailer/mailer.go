@@ -0,0 +1,100 @@
+// Package mailer sends plain text email through an SMTP relay
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config specifies the SMTP relay mail is sent through. Username and
+// Password are only used if Username is set.
+type Config struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Message is a plain text email. Headers are added to the ones the mailer
+// sets, e.g. List-Unsubscribe.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string
+}
+
+// Mailer sends messages through an SMTP relay
+type Mailer struct {
+	config Config
+	now    func() time.Time
+}
+
+// New returns a Mailer sending through the configured relay
+func New(config Config) *Mailer {
+	return &Mailer{config, time.Now}
+}
+
+// Send delivers a message to its recipient
+func (m *Mailer) Send(msg Message) error {
+	var auth smtp.Auth
+
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.Addr)
+
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	return smtp.SendMail(m.config.Addr, auth, m.config.From, []string{msg.To}, m.format(msg))
+}
+
+// format returns the message with its headers, ready to send
+func (m *Mailer) format(msg Message) []byte {
+	headers := map[string]string{
+		"From":                      m.config.From,
+		"To":                        msg.To,
+		"Subject":                   mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":                      m.now().Format(time.RFC1123Z),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "8bit",
+	}
+
+	for name, value := range msg.Headers {
+		headers[name] = value
+	}
+
+	names := make([]string, 0, len(headers))
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b bytes.Buffer
+
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, stripNewlines(headers[name]))
+	}
+
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return b.Bytes()
+}
+
+// stripNewlines keeps header values from injecting headers of their own
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
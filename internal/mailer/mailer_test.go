@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jkulton/topical/internal/mailer/mailertest"
+)
+
+func TestSend(t *testing.T) {
+	t.Run("delivers message through the relay", func(t *testing.T) {
+		relay := mailertest.New()
+		defer relay.Close()
+
+		m := New(Config{Addr: relay.Addr, Username: "topical", Password: "secret", From: "topical@example.com"})
+		err := m.Send(Message{
+			To:      "jk@example.com",
+			Subject: "Your digest",
+			Body:    "Line one\nLine two\n",
+			Headers: map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"},
+		})
+
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		messages := relay.Messages()
+
+		if len(messages) != 1 {
+			t.Fatalf("got %d messages but wanted 1", len(messages))
+		}
+
+		got := messages[0]
+
+		if got.From != "topical@example.com" || len(got.To) != 1 || got.To[0] != "jk@example.com" {
+			t.Errorf("got envelope from %q to %v", got.From, got.To)
+		}
+
+		if got.Username != "topical" {
+			t.Errorf("got username %q but wanted topical", got.Username)
+		}
+
+		if subject := got.Header.Get("Subject"); subject != "Your digest" {
+			t.Errorf("got subject %q", subject)
+		}
+
+		if unsubscribe := got.Header.Get("List-Unsubscribe"); unsubscribe != "<https://example.com/unsubscribe>" {
+			t.Errorf("got List-Unsubscribe %q", unsubscribe)
+		}
+
+		if !strings.Contains(got.Body, "Line one\nLine two") {
+			t.Errorf("got body %q", got.Body)
+		}
+	})
+
+	t.Run("keeps header values on one line", func(t *testing.T) {
+		m := New(Config{From: "topical@example.com"})
+		formatted := string(m.format(Message{To: "jk@example.com", Subject: "Hi", Headers: map[string]string{"X-Test": "a\r\nBcc: evil@example.com"}}))
+
+		if strings.Contains(formatted, "\r\nBcc:") {
+			t.Errorf("header injected into %q", formatted)
+		}
+	})
+
+	t.Run("returns relay errors", func(t *testing.T) {
+		relay := mailertest.New()
+		relay.Close()
+
+		if err := New(Config{Addr: relay.Addr, From: "topical@example.com"}).Send(Message{To: "jk@example.com"}); err == nil {
+			t.Error("expected an error sending to a closed relay")
+		}
+	})
+}
@@ -0,0 +1,172 @@
+// Package mailertest provides a stand-in SMTP relay for tests
+package mailertest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the Server
+type Message struct {
+	From     string
+	To       []string
+	Username string
+	Header   mail.Header
+	Body     string
+}
+
+// Server is an in-process SMTP relay accepting any mail, and any PLAIN
+// credentials, and keeping what it receives for inspection
+type Server struct {
+	Addr string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// New starts a Server listening on a random local port, close it with Close
+func New() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{Addr: l.Addr().String(), listener: l}
+	s.wg.Add(1)
+
+	go s.serve()
+
+	return s
+}
+
+// Messages returns the messages received so far, oldest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server, waiting for open connections to finish
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle speaks just enough SMTP for net/smtp's SendMail
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	msg := Message{}
+	tp.PrintfLine("220 mailertest ready")
+
+	for {
+		line, err := tp.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-mailertest")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			fields := strings.Fields(line)
+
+			if len(fields) != 3 || strings.ToUpper(fields[1]) != "PLAIN" {
+				tp.PrintfLine("504 unsupported authentication")
+				continue
+			}
+
+			credentials, err := base64.StdEncoding.DecodeString(fields[2])
+			parts := strings.Split(string(credentials), "\x00")
+
+			if err != nil || len(parts) != 3 {
+				tp.PrintfLine("501 malformed credentials")
+				continue
+			}
+
+			msg.Username = parts[1]
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.From = address(line)
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			msg.To = append(msg.To, address(line))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			parsed, err := mail.ReadMessage(bufio.NewReader(tp.DotReader()))
+
+			if err != nil {
+				tp.PrintfLine("554 malformed message")
+				continue
+			}
+
+			body, _ := ioutil.ReadAll(parsed.Body)
+			msg.Header = parsed.Header
+			msg.Body = string(body)
+
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+
+			msg = Message{Username: msg.Username}
+			tp.PrintfLine("250 queued")
+		case "RSET":
+			msg = Message{Username: msg.Username}
+			tp.PrintfLine("250 ok")
+		case "NOOP":
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unrecognized command")
+		}
+	}
+}
+
+// address returns the address in a MAIL FROM:<...> or RCPT TO:<...> line
+func address(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+
+	if start == -1 || end < start {
+		return ""
+	}
+
+	return line[start+1 : end]
+}
@@ -0,0 +1,59 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// bareURLPattern matches URLs written as plain text rather than as links
+var bareURLPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>()\[\]"'` + "`" + `]+`)
+
+// Links returns the destinations of the links, autolinks and images in
+// user-written markdown as they will be rendered, including relative and
+// protocol-relative ones, followed by URLs written as plain text, which
+// readers may still copy and follow.
+func Links(source string) []string {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+	links := []string{}
+	var plain bytes.Buffer
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		// Link text and alt text aren't scanned for URLs, so a link
+		// labelled with its own URL counts once
+		case *ast.Link:
+			links = append(links, string(n.Destination))
+			return ast.WalkSkipChildren, nil
+		case *ast.Image:
+			links = append(links, string(n.Destination))
+			return ast.WalkSkipChildren, nil
+		case *ast.AutoLink:
+			links = append(links, string(n.URL(src)))
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			// Inline parsers split text at characters like _ and @, so
+			// neighbouring text is joined back up before matching URLs
+			if _, ok := n.PreviousSibling().(*ast.Text); !ok {
+				plain.WriteByte(' ')
+			}
+
+			plain.Write(n.Segment.Value(src))
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, url := range bareURLPattern.FindAll(plain.Bytes(), -1) {
+		links = append(links, string(url))
+	}
+
+	return links
+}
@@ -0,0 +1,72 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	md = goldmark.New(
+		goldmark.WithParserOptions(
+			parser.WithInlineParsers(util.Prioritized(mentionParser{}, 500)),
+			parser.WithASTTransformers(
+				util.Prioritized(unlinkNestedMentions{}, 100),
+				util.Prioritized(linkAttributes{}, 100),
+			),
+		),
+		goldmark.WithRendererOptions(
+			renderer.WithNodeRenderers(util.Prioritized(mentionRenderer{}, 500)),
+		),
+	)
+	sanitizer = newSanitizer()
+)
+
+// Render converts user-written markdown to sanitized HTML. Links are marked
+// rel="ugc nofollow" and links to other sites open in a new tab, and
+// @mentions link to the mentioned author's profile.
+func Render(source string) (string, error) {
+	var unsafeHTML bytes.Buffer
+
+	if err := md.Convert([]byte(source), &unsafeHTML); err != nil {
+		return "", err
+	}
+
+	return string(sanitizer.SanitizeBytes(unsafeHTML.Bytes())), nil
+}
+
+// newSanitizer extends bluemonday's UGC policy, which adds rel="nofollow" to
+// links, to keep the rel="ugc" set on rendered links and the class marking
+// mentions, and open off-site links in a new tab with rel="noopener"
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^ugc$`)).OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^mention$`)).OnElements("a")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// linkAttributes marks every link in a document as user-generated content
+type linkAttributes struct{}
+
+func (linkAttributes) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n.(type) {
+		case *ast.Link, *ast.AutoLink:
+			n.SetAttributeString("rel", []byte("ugc"))
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
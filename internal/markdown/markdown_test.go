@@ -0,0 +1,102 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("renders markdown to HTML", func(t *testing.T) {
+		got, _ := Render("**bold**")
+
+		if strings.Contains(got, "<strong>bold</strong>") == false {
+			t.Errorf("got %s, expected bold text", got)
+		}
+	})
+
+	t.Run("strips unsafe HTML", func(t *testing.T) {
+		got, _ := Render(`[click](javascript:alert(1)) <script>alert(1)</script>`)
+
+		if strings.Contains(got, "javascript:") || strings.Contains(got, "<script>") {
+			t.Errorf("got %s, expected unsafe content removed", got)
+		}
+	})
+
+	t.Run("marks external links as nofollow ugc opening in a new tab", func(t *testing.T) {
+		got, _ := Render("[Platter](https://github.com/jkulton/platter) and <https://example.com>")
+		want := `<a href="https://github.com/jkulton/platter" rel="ugc nofollow noopener" target="_blank">Platter</a>`
+
+		if strings.Contains(got, want) == false {
+			t.Errorf("got %s, expected %s", got, want)
+		}
+
+		if strings.Count(got, `rel="ugc nofollow noopener"`) != 2 {
+			t.Errorf("got %s, expected autolink attributes", got)
+		}
+	})
+
+	t.Run("keeps relative links in the same tab", func(t *testing.T) {
+		got, _ := Render("[topic](/topics/1)")
+		want := `<a href="/topics/1" rel="ugc nofollow">topic</a>`
+
+		if strings.Contains(got, want) == false {
+			t.Errorf("got %s, expected %s", got, want)
+		}
+	})
+
+	t.Run("links mentions to author profiles", func(t *testing.T) {
+		got, _ := Render("thanks @AK and @BC-3")
+
+		if !strings.Contains(got, `<a class="mention" href="/u/AK" rel="nofollow">@AK</a>`) || !strings.Contains(got, `href="/u/BC-3"`) {
+			t.Errorf("got %s, expected mention links", got)
+		}
+	})
+}
+
+func TestMentions(t *testing.T) {
+	t.Run("returns each mention once", func(t *testing.T) {
+		got := Mentions("@AK said hi to @BC-3, **@AK** agreed")
+		want := []Mention{{Initials: "AK"}, {Initials: "BC", Theme: 3}}
+
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("got %v, expected %v", got, want)
+		}
+	})
+
+	t.Run("ignores mentions in code, links, words and longer names", func(t *testing.T) {
+		source := "`@AK` and a@BC.com and @DEF and [@GH](/x)\n\n```\n@IJ\n```\n\n    @KL"
+
+		if got := Mentions(source); len(got) != 0 {
+			t.Errorf("got %v, expected no mentions", got)
+		}
+	})
+
+	t.Run("ignores mentions in quotes", func(t *testing.T) {
+		got := Mentions("> thanks @AK\n> > and @BC\n\nyou're welcome @DE")
+
+		if len(got) != 1 || got[0].Initials != "DE" {
+			t.Errorf("got %v, expected only @DE", got)
+		}
+	})
+}
+
+func TestLinks(t *testing.T) {
+	t.Run("returns rendered link destinations and plain text URLs", func(t *testing.T) {
+		source := "[a](//a.com) ![b](https://b.com/i.png) <https://c.com> see https://d.com/x_y@z\n\n[e][ref]\n\n[ref]: /topics/1"
+		got := Links(source)
+		want := []string{"//a.com", "https://b.com/i.png", "https://c.com", "/topics/1", "https://d.com/x_y@z"}
+
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("got %v, expected %v", got, want)
+		}
+	})
+
+	t.Run("counts links labelled with their URL once", func(t *testing.T) {
+		got := Links("[https://a.example](https://a.example) ![https://b.example](https://b.example)")
+		want := []string{"https://a.example", "https://b.example"}
+
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("got %v, expected %v", got, want)
+		}
+	})
+}
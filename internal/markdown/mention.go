@@ -0,0 +1,162 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Mention is an @mention of an author by their initials, like @AK, and
+// optionally their theme, like @AK-3. Theme is 0 when not given.
+type Mention struct {
+	Initials string
+	Theme    int
+}
+
+// Path returns the profile page of the mentioned author
+func (m Mention) Path() string {
+	if m.Theme == 0 {
+		return "/u/" + m.Initials
+	}
+
+	return fmt.Sprintf("/u/%s-%d", m.Initials, m.Theme)
+}
+
+// String returns the mention as written
+func (m Mention) String() string {
+	if m.Theme == 0 {
+		return "@" + m.Initials
+	}
+
+	return fmt.Sprintf("@%s-%d", m.Initials, m.Theme)
+}
+
+// Mentions returns each author mentioned in user-written markdown once, in
+// the order first mentioned. Mentions in code spans, code blocks, link
+// text, and quotes are ignored, so quoting a message doesn't notify the
+// authors it mentions again.
+func Mentions(source string) []Mention {
+	doc := md.Parser().Parse(text.NewReader([]byte(source)))
+	seen := map[Mention]bool{}
+	mentions := []Mention{}
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if n.Kind() == ast.KindBlockquote {
+			return ast.WalkSkipChildren, nil
+		}
+
+		if m, ok := n.(*mentionNode); ok && entering && !seen[m.Mention] {
+			seen[m.Mention] = true
+			mentions = append(mentions, m.Mention)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return mentions
+}
+
+// kindMention is the AST node kind of mentions
+var kindMention = ast.NewNodeKind("Mention")
+
+// mentionNode is a mention in a document, rendered as a link to the
+// mentioned author's profile
+type mentionNode struct {
+	ast.BaseInline
+	Mention
+	segment text.Segment
+}
+
+func (n *mentionNode) Kind() ast.NodeKind {
+	return kindMention
+}
+
+func (n *mentionNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Mention": n.String()}, nil)
+}
+
+// mentionPattern matches a mention at the start of a line. Mentions must be
+// followed by a character which can't continue a word, which is matched
+// too and must be left out of the mention.
+var mentionPattern = regexp.MustCompile(`^@([A-Z]{2})(?:-([1-9][0-9]?))?(?:[^A-Za-z0-9_]|$)`)
+
+// mentionParser parses mentions, triggered by @. Code spans and blocks are
+// parsed before inline parsers run, so mentions in code are never seen.
+type mentionParser struct{}
+
+func (mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// An @ inside a word, like an email address, isn't a mention
+	if c := block.PrecendingCharacter(); unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' {
+		return nil
+	}
+
+	line, segment := block.PeekLine()
+	match := mentionPattern.FindSubmatchIndex(line)
+
+	if match == nil {
+		return nil
+	}
+
+	m := Mention{Initials: string(line[match[2]:match[3]])}
+	length := match[3]
+
+	if match[4] >= 0 {
+		m.Theme, _ = strconv.Atoi(string(line[match[4]:match[5]]))
+		length = match[5]
+	}
+
+	block.Advance(length)
+	return &mentionNode{Mention: m, segment: segment.WithStop(segment.Start + length)}
+}
+
+// mentionRenderer renders mentions as links to the mentioned author's profile
+type mentionRenderer struct{}
+
+func (r mentionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMention, r.render)
+}
+
+func (mentionRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		m := n.(*mentionNode)
+		fmt.Fprintf(w, `<a class="mention" href="%s">%s</a>`, m.Path(), m.String())
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+// unlinkNestedMentions turns mentions inside link text back into plain
+// text, since links can't be nested
+type unlinkNestedMentions struct{}
+
+func (unlinkNestedMentions) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	nested := []*mentionNode{}
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if m, ok := n.(*mentionNode); ok && entering {
+			for p := m.Parent(); p != nil; p = p.Parent() {
+				if _, ok := p.(*ast.Link); ok {
+					nested = append(nested, m)
+					break
+				}
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, m := range nested {
+		m.Parent().ReplaceChild(m.Parent(), m, ast.NewTextSegment(m.segment))
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/jkulton/topical/internal/session"
+)
+
+// CSRFFieldName is the form field carrying a CSRF token
+const CSRFFieldName = "csrf_token"
+
+// CSRF rejects requests with unsafe methods unless they include the session's
+// CSRF token, either as a form field or an X-CSRF-Token header. Requests to
+// exempt paths, such as endpoints browsers post to on their own, are let through.
+func CSRF(s session.TopicalSession, exemptPaths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, path := range exemptPaths {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			want, err := s.GetCSRFToken(r, w)
+
+			if err != nil {
+				log.Print("Error getting CSRF token", err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			got := r.Header.Get("X-CSRF-Token")
+
+			if got == "" {
+				got = r.PostFormValue(CSRFFieldName)
+			}
+
+			if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+				log.Printf("Rejected request with invalid CSRF token %s %q", r.Method, r.URL.Path)
+				http.Error(w, "Forbidden - invalid CSRF token, please reload the page and try again", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
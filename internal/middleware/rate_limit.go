@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jkulton/topical/internal/session"
+)
+
+// LimitedHandler is called when a request is rejected by a RateLimiter,
+// with the duration the client should wait before retrying
+type LimitedHandler func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+
+// RateLimiter limits requests using token buckets keyed by both the
+// client's session identity and IP address. Each bucket holds up to
+// `requests` tokens and refills at `requests` per `per`.
+type RateLimiter struct {
+	requests       int
+	per            time.Duration
+	session        session.TopicalSession
+	trustedProxies []*net.IPNet
+	onLimit        LimitedHandler
+	now            func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bursts of `requests` per `per`.
+// Requests from trusted proxies are attributed to the client they forward for.
+func NewRateLimiter(requests int, per time.Duration, s session.TopicalSession, trustedProxies []*net.IPNet, onLimit LimitedHandler) *RateLimiter {
+	if onLimit == nil {
+		onLimit = func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}
+	}
+
+	return &RateLimiter{
+		requests:       requests,
+		per:            per,
+		session:        s,
+		trustedProxies: trustedProxies,
+		onLimit:        onLimit,
+		now:            time.Now,
+		buckets:        map[string]*bucket{},
+	}
+}
+
+// Limit wraps a handler, responding with 429 and a Retry-After header once
+// either the client's session or IP has exhausted its bucket
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []string{"ip:" + ClientIP(r, rl.trustedProxies)}
+
+		if id, err := rl.session.GetID(r, w); err == nil {
+			keys = append(keys, "session:"+id)
+		}
+
+		if retryAfter := rl.take(keys...); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			rl.onLimit(w, r, retryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take removes a token from each keyed bucket if all of them have one available,
+// otherwise it returns how long until they will
+func (rl *RateLimiter) take(keys ...string) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	refillRate := float64(rl.requests) / rl.per.Seconds()
+	var wait time.Duration
+
+	for _, key := range keys {
+		b, ok := rl.buckets[key]
+
+		if !ok {
+			b = &bucket{tokens: float64(rl.requests), last: now}
+			rl.buckets[key] = b
+		}
+
+		b.tokens = math.Min(float64(rl.requests), b.tokens+now.Sub(b.last).Seconds()*refillRate)
+		b.last = now
+
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / refillRate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait > 0 {
+		return wait
+	}
+
+	for _, key := range keys {
+		rl.buckets[key].tokens--
+	}
+
+	return 0
+}
+
+// sweep drops buckets which have been idle long enough to refill completely,
+// as they are indistinguishable from new buckets
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.per {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= rl.per {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.lastSweep = now
+}
+
+// ClientIP returns the IP address of the client making a request. The
+// X-Forwarded-For header is only consulted when the request arrives from a
+// trusted proxy, and is read right to left skipping further trusted proxies.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trustedProxies) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+
+		if net.ParseIP(ip) == nil {
+			break
+		}
+
+		host = ip
+
+		if !isTrusted(ip, trustedProxies) {
+			break
+		}
+	}
+
+	return host
+}
+
+func isTrusted(host string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jkulton/topical/internal/session"
+)
+
+func newTestLimiter(requests int, per time.Duration, trustedProxies []*net.IPNet) (*RateLimiter, *mux.Router) {
+	limiter := NewRateLimiter(requests, per, session.NewSession("test"), trustedProxies, nil)
+	router := mux.NewRouter()
+	router.Handle("/path", limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).Methods("POST")
+	return limiter, router
+}
+
+func post(router *mux.Router, remoteAddr string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/path", nil)
+	req.RemoteAddr = remoteAddr
+	router.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("allows a burst then responds with 429 and Retry-After", func(t *testing.T) {
+		_, router := newTestLimiter(2, time.Minute, nil)
+
+		for i := 0; i < 2; i++ {
+			if rw := post(router, "1.2.3.4:1000"); rw.Code != http.StatusOK {
+				t.Errorf("request %d got status %d but wanted %d", i, rw.Code, http.StatusOK)
+			}
+		}
+
+		rw := post(router, "1.2.3.4:1000")
+
+		if rw.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %d but wanted %d", rw.Code, http.StatusTooManyRequests)
+		}
+
+		if rw.Header().Get("Retry-After") != "30" {
+			t.Errorf("got Retry-After %q but wanted %q", rw.Header().Get("Retry-After"), "30")
+		}
+	})
+
+	t.Run("limits clients independently", func(t *testing.T) {
+		_, router := newTestLimiter(1, time.Minute, nil)
+
+		post(router, "1.2.3.4:1000")
+
+		if rw := post(router, "5.6.7.8:1000"); rw.Code != http.StatusOK {
+			t.Errorf("got status %d but wanted %d", rw.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("refills tokens over time", func(t *testing.T) {
+		limiter, router := newTestLimiter(1, time.Minute, nil)
+		now := time.Now()
+		limiter.now = func() time.Time { return now }
+
+		post(router, "1.2.3.4:1000")
+		now = now.Add(time.Minute)
+
+		if rw := post(router, "1.2.3.4:1000"); rw.Code != http.StatusOK {
+			t.Errorf("got status %d but wanted %d", rw.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("calls limited handler when limited", func(t *testing.T) {
+		called := false
+		limiter := NewRateLimiter(1, time.Minute, session.NewSession("test"), nil, func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+			called = true
+		})
+		handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/path", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/path", nil))
+
+		if called == false {
+			t.Error("limited handler should have been called")
+		}
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	t.Run("ignores X-Forwarded-For from untrusted clients", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "1.2.3.4:1000"
+		req.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+		if ip := ClientIP(req, trusted); ip != "1.2.3.4" {
+			t.Errorf("got ip %s but wanted %s", ip, "1.2.3.4")
+		}
+	})
+
+	t.Run("uses the right-most untrusted X-Forwarded-For address from trusted proxies", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1000"
+		req.Header.Set("X-Forwarded-For", "9.9.9.9, 5.6.7.8, 10.0.0.2")
+
+		if ip := ClientIP(req, trusted); ip != "5.6.7.8" {
+			t.Errorf("got ip %s but wanted %s", ip, "5.6.7.8")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func serveWithSecurityHeaders(opts SecurityOptions) (*httptest.ResponseRecorder, string) {
+	var nonce string
+
+	router := mux.NewRouter()
+	router.HandleFunc("/path", func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r)
+	}).Methods("GET")
+	router.Use(SecurityHeaders(opts))
+
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest("GET", "/path", nil))
+
+	return rw, nonce
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Run("sets a CSP including the request's nonce", func(t *testing.T) {
+		rw, nonce := serveWithSecurityHeaders(SecurityOptions{FrameAncestors: "'none'", ReportURI: "/csp-report"})
+		csp := rw.Header().Get("Content-Security-Policy")
+
+		if nonce == "" || strings.Contains(csp, "script-src 'self' 'nonce-"+nonce+"'") == false {
+			t.Errorf("CSP %q should allow scripts with nonce %q", csp, nonce)
+		}
+
+		if strings.Contains(csp, "frame-ancestors 'none'") == false || strings.Contains(csp, "report-uri /csp-report") == false {
+			t.Errorf("CSP %q should include frame-ancestors and report-uri", csp)
+		}
+
+		if rw.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Error("expected X-Content-Type-Options header")
+		}
+
+		if rw.Header().Get("Strict-Transport-Security") != "" {
+			t.Error("HSTS should be disabled by default")
+		}
+	})
+
+	t.Run("uses a new nonce for every request", func(t *testing.T) {
+		_, first := serveWithSecurityHeaders(SecurityOptions{})
+		_, second := serveWithSecurityHeaders(SecurityOptions{})
+
+		if first == second {
+			t.Error("nonces should differ between requests")
+		}
+	})
+
+	t.Run("sends report-only policy and HSTS when configured", func(t *testing.T) {
+		rw, _ := serveWithSecurityHeaders(SecurityOptions{ReportOnly: true, HSTSMaxAge: time.Hour})
+
+		if rw.Header().Get("Content-Security-Policy") != "" || rw.Header().Get("Content-Security-Policy-Report-Only") == "" {
+			t.Error("policy should only be sent as report-only")
+		}
+
+		if rw.Header().Get("Strict-Transport-Security") != "max-age=3600; includeSubDomains" {
+			t.Errorf("got HSTS %q", rw.Header().Get("Strict-Transport-Security"))
+		}
+	})
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Digest is a recipient's request for a "daily" or "weekly" email summing
+// up activity in the topics they watch. Digests are only sent once the
+// recipient has confirmed they own Email.
+type Digest struct {
+	RecipientKey string
+	Email        string
+	Frequency    string
+	Confirmed    bool
+	LastSent     time.Time
+}
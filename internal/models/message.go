@@ -10,4 +10,16 @@ type Message struct {
 	AuthorInitials string
 	Posted         time.Time
 	AuthorTheme    int
+	Hidden         bool
+	Status         string
+	UserID         *int
+	AuthorTripcode string
+	AuthorKey      string
+	TopicTitle     string
+	Unread         bool
+	// ReplyToID is the earlier message in the topic this one quotes or
+	// replies to, if any, and ReplyToInitials the initials of its author
+	ReplyToID       *int
+	ReplyToInitials string
+	Reactions       []Reaction
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Notification tells a user about a new message in a topic they watch, of
+// kind "reply", or one mentioning them, of kind "mention"
+type Notification struct {
+	ID      *int
+	Kind    string
+	Read    bool
+	Created time.Time
+	Message *Message
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Poll is a question asked in a topic, readers vote for one of its options
+// or, if Multiple is set, any number of them
+type Poll struct {
+	ID        *int
+	TopicID   *int
+	Question  string
+	Multiple  bool
+	Closes    *time.Time
+	AuthorKey string
+	// Closed is true once the poll's author closes it or its close time passes
+	Closed  bool
+	Options []PollOption
+	// Voters is how many readers have voted, and Voted true if the reader
+	// viewing the poll is one of them
+	Voters int
+	Voted  bool
+}
+
+// PollOption is an option of a poll with the votes for it
+type PollOption struct {
+	ID    *int
+	Label string
+	Votes int
+	// Percent is the share of voters who chose the option
+	Percent int
+	// Chosen is true if the reader viewing the poll voted for the option
+	Chosen bool
+}
@@ -0,0 +1,11 @@
+package models
+
+// Preferences holds how a visitor likes pages shown, kept in their session.
+// Empty fields mean the defaults: automatic appearance, UTC, dates only,
+// and comfortable density.
+type Preferences struct {
+	Appearance string `json:",omitempty"`
+	Timezone   string `json:",omitempty"`
+	DateFormat string `json:",omitempty"`
+	Density    string `json:",omitempty"`
+}
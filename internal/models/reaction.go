@@ -0,0 +1,9 @@
+package models
+
+// Reaction is how many readers reacted to a message with an emoji
+type Reaction struct {
+	Emoji string
+	Count int
+	// Reacted is true if the reader viewing the message is one of them
+	Reacted bool
+}
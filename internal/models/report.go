@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ReportReasons lists the categories a reader can choose from when reporting a message
+var ReportReasons = []string{"spam", "harassment", "off-topic", "other"}
+
+// Report represents a reader flagging a message for moderator review,
+// reports have a M:1 relationship with Messages
+type Report struct {
+	ID        *int
+	MessageID *int
+	Reason    string
+	Details   string
+	SessionID string
+	Status    string
+	Created   time.Time
+	Message   *Message
+}
@@ -8,4 +8,5 @@ type Topic struct {
 	MessageCount   *int
 	AuthorInitials *string
 	AuthorTheme    *string
+	UnreadCount    int
 }
@@ -1,8 +1,38 @@
 package models
 
-// User is a struct representing a user account, the user stored
-// in a simple cookie and defines a name and theme for messages.
+import "regexp"
+
+// User is a struct representing a user account. Anonymous users are stored
+// in a simple cookie and only define a name and theme for messages, plus a
+// secret their tripcode is derived from, while registered users also have an
+// ID and a unique handle.
 type User struct {
-	Initials string
-	Theme    int
+	ID         *int   `json:",omitempty"`
+	Handle     string `json:",omitempty"`
+	Initials   string
+	Theme      int
+	TripSecret string `json:",omitempty"`
+}
+
+// Erased authors' messages are shown under these initials and theme, which
+// ValidInitials and ValidTheme reserve so no one can pick them
+const (
+	AnonymizedInitials = "XX"
+	AnonymizedTheme    = 0
+)
+
+// Themes is how many colors users pick from, numbered from 1
+const Themes = 7
+
+var initialsPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidInitials reports whether users may pick the initials: two capital
+// letters other than the anonymized ones
+func ValidInitials(initials string) bool {
+	return initialsPattern.MatchString(initials) && initials != AnonymizedInitials
+}
+
+// ValidTheme reports whether users may pick the theme
+func ValidTheme(theme int) bool {
+	return theme >= 1 && theme <= Themes
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Webhook is an endpoint new topics and messages are posted to, with
+// payloads signed by Secret
+type Webhook struct {
+	ID      *int
+	URL     string
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery is an event about a message to be posted to a webhook,
+// "topic.created" for the first message of a topic or "message.created"
+// for replies. Deliveries are "pending" until they succeed, becoming
+// "delivered", or run out of attempts, becoming "failed".
+type WebhookDelivery struct {
+	ID           *int
+	Webhook      *Webhook
+	Message      *Message
+	Event        string
+	Status       string
+	Attempts     int
+	NextAttempt  time.Time
+	ResponseCode int
+	Error        string
+	Created      time.Time
+	Updated      time.Time
+}
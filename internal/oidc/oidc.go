@@ -0,0 +1,419 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for ID tokens which fail validation
+	ErrInvalidToken = errors.New("invalid ID token")
+	// ErrUnknownKey is returned when an ID token is signed with a key the provider doesn't publish
+	ErrUnknownKey = errors.New("ID token signed with unknown key")
+)
+
+// leeway allows for clock drift between Topical and the identity provider
+const leeway = time.Minute
+
+// Config describes how Topical is registered with an OpenID Connect provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Claims are the ID token claims Topical reads
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+}
+
+// keyRefetchInterval is how often, at most, the provider's signing keys are
+// refetched, so tokens with made up key IDs can't make Topical hammer it
+const keyRefetchInterval = time.Minute
+
+// Provider runs the authorization code flow against an OpenID Connect
+// provider. Its endpoints are discovered on first use, and its signing keys
+// are refetched when a token is signed with an unknown key, at most once
+// every keyRefetchInterval.
+type Provider struct {
+	config Config
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	endpoints   *endpoints
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type endpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New returns a Provider for the given config
+func New(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// NewPKCE returns a PKCE code verifier and its S256 challenge
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = RandomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns a random URL-safe string for use as a state, nonce, or verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL to send users to for signing in
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	e, err := p.discover(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(e.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return e.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code for an ID token, returning its
+// claims once the token has been verified against nonce
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Claims, error) {
+	e, err := p.discover(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.config.ClientID},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+
+	if err := p.fetchJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	if token.IDToken == "" {
+		return nil, errors.New("exchanging code: no ID token in response")
+	}
+
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry, and
+// nonce, returning its claims
+func (p *Provider) Verify(ctx context.Context, rawToken string, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Only RS256 is accepted, ruling out "none" and HMAC keyed with public keys
+	if header.Algorithm != "RS256" {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := p.key(ctx, header.KeyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := p.now()
+
+	switch {
+	case claims.Issuer != p.config.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: not authorized for this client", ErrInvalidToken)
+	case now.After(time.Unix(claims.Expiry, 0).Add(leeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(leeway)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return &claims, nil
+}
+
+// discover fetches and caches the provider's endpoints
+func (p *Provider) discover(ctx context.Context) (*endpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var e endpoints
+
+	if err := p.fetchJSON(req, &e); err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+
+	if e.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovering provider: issuer %q does not match %q", e.Issuer, p.config.Issuer)
+	}
+
+	p.endpoints = &e
+
+	return p.endpoints, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// provider's keys if it isn't known. Unknown keys are rejected without
+// refetching while the last fetch, successful or not, is recent.
+func (p *Provider) key(ctx context.Context, id string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[id]
+	now := p.now()
+	coolingDown := !p.keysFetched.IsZero() && now.Sub(p.keysFetched) < keyRefetchInterval
+
+	if !ok && !coolingDown {
+		p.keysFetched = now
+	}
+
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if coolingDown {
+		return nil, ErrUnknownKey
+	}
+
+	e, err := p.discover(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.JWKSURI, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := p.fetchJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+
+		if errN != nil || errE != nil {
+			continue
+		}
+
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[id]; ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (p *Provider) fetchJSON(req *http.Request, v interface{}) error {
+	res, err := p.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", req.URL, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// audience is the aud claim, which may be a single string or a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+
+	*a = list
+
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jkulton/topical/internal/oidc/oidctest"
+)
+
+func setup() (*oidctest.IdP, *Provider) {
+	idp := oidctest.New("topical", "secret")
+	provider := New(Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "topical",
+		ClientSecret: "secret",
+		RedirectURL:  "http://topical.test/auth/oidc/callback",
+	})
+
+	return idp, provider
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	t.Run("exchanges a code for verified claims", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		idp.User["name"] = "Jane Doe"
+		verifier, challenge, _ := NewPKCE()
+
+		authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		res, err := client.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redirect, _ := url.Parse(res.Header.Get("Location"))
+
+		if redirect.Query().Get("state") != "state-1" {
+			t.Error("expected state to be returned")
+		}
+
+		claims, err := provider.Exchange(context.Background(), redirect.Query().Get("code"), verifier, "nonce-1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != "user-1" || claims.Name != "Jane Doe" {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("fails the exchange with the wrong PKCE verifier", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		_, challenge, _ := NewPKCE()
+		authURL, _ := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", challenge)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		res, _ := client.Get(authURL)
+		redirect, _ := url.Parse(res.Header.Get("Location"))
+
+		if _, err := provider.Exchange(context.Background(), redirect.Query().Get("code"), "wrong", "nonce-1"); err == nil {
+			t.Error("expected exchange to fail")
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims map[string]interface{})
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://elsewhere.test" }},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other-client" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"issued in the future", func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "other" }},
+		{"multiple audiences without azp", func(c map[string]interface{}) { c["aud"] = []string{"topical", "other"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			idp, provider := setup()
+			defer idp.Close()
+			claims := idp.Claims("nonce-1")
+			tt.modify(claims)
+
+			if _, err := provider.Verify(context.Background(), idp.Sign(claims), "nonce-1"); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("got %v but wanted %v", err, ErrInvalidToken)
+			}
+		})
+	}
+
+	t.Run("accepts a list audience with matching azp", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		claims := idp.Claims("nonce-1")
+		claims["aud"] = []string{"topical", "other"}
+		claims["azp"] = "topical"
+
+		if _, err := provider.Verify(context.Background(), idp.Sign(claims), "nonce-1"); err != nil {
+			t.Errorf("expected token to verify, got %v", err)
+		}
+	})
+
+	t.Run("rejects a tampered signature", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		token := idp.Sign(idp.Claims("nonce-1"))
+		tampered := token[:len(token)-4] + "AAAA"
+
+		if _, err := provider.Verify(context.Background(), tampered, "nonce-1"); err != ErrInvalidToken {
+			t.Errorf("got %v but wanted %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("rejects unsigned tokens", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		token := "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1c2VyLTEifQ."
+
+		if _, err := provider.Verify(context.Background(), token, ""); err != ErrInvalidToken {
+			t.Errorf("got %v but wanted %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("refetches keys for unknown key IDs", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		provider.Verify(context.Background(), idp.Sign(idp.Claims("nonce-1")), "nonce-1")
+		idp.KeyID = "rotated"
+		provider.now = func() time.Time { return time.Now().Add(keyRefetchInterval) }
+
+		if _, err := provider.Verify(context.Background(), idp.Sign(idp.Claims("nonce-1")), "nonce-1"); err != nil {
+			t.Errorf("expected token signed with rotated key to verify, got %v", err)
+		}
+	})
+
+	t.Run("rejects unknown key IDs without refetching while cooling down", func(t *testing.T) {
+		idp, provider := setup()
+		defer idp.Close()
+		provider.Verify(context.Background(), idp.Sign(idp.Claims("nonce-1")), "nonce-1")
+		idp.KeyID = "made-up"
+
+		for i := 0; i < 5; i++ {
+			if _, err := provider.Verify(context.Background(), idp.Sign(idp.Claims("nonce-1")), "nonce-1"); err == nil {
+				t.Error("expected token signed with an unknown key to be rejected")
+			}
+		}
+
+		if got := idp.KeyFetches(); got != 1 {
+			t.Errorf("got %d key fetches but wanted 1", got)
+		}
+	})
+}
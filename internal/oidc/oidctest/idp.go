@@ -0,0 +1,194 @@
+// Package oidctest provides a stand-in OpenID Connect provider for tests
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// IdP is an in-process identity provider supporting discovery, the
+// authorization code flow with PKCE, and RS256-signed ID tokens. Users
+// signing in are granted the claims in User.
+type IdP struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	KeyID        string
+	Key          *rsa.PrivateKey
+	User         map[string]interface{}
+
+	mu         sync.Mutex
+	codes      map[string]grant
+	keyFetches int
+}
+
+type grant struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// New starts an IdP accepting the given client, close it with Close
+func New(clientID string, clientSecret string) *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		panic(err)
+	}
+
+	idp := &IdP{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		KeyID:        "test-key",
+		Key:          key,
+		User:         map[string]interface{}{"sub": "user-1"},
+		codes:        map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+
+	return idp
+}
+
+// Issuer returns the IdP's issuer identifier
+func (idp *IdP) Issuer() string {
+	return idp.URL
+}
+
+// Sign returns an ID token with the given claims, signed with the IdP's key
+func (idp *IdP) Sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": idp.KeyID})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.Key, crypto.SHA256, digest[:])
+
+	if err != nil {
+		panic(err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Claims returns valid ID token claims for User with the given nonce
+func (idp *IdP) Claims(nonce string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":   idp.Issuer(),
+		"aud":   idp.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+
+	for k, v := range idp.User {
+		claims[k] = v
+	}
+
+	return claims
+}
+
+func (idp *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 idp.Issuer(),
+		"authorization_endpoint": idp.URL + "/authorize",
+		"token_endpoint":         idp.URL + "/token",
+		"jwks_uri":               idp.URL + "/jwks",
+	})
+}
+
+// authorize signs the user in without prompting, redirecting back with a code
+func (idp *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != idp.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	idp.mu.Lock()
+	idp.codes[code] = grant{q.Get("redirect_uri"), q.Get("nonce"), q.Get("code_challenge")}
+	idp.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *IdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+
+	if r.FormValue("grant_type") != "authorization_code" || clientID != idp.ClientID || clientSecret != idp.ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idp.mu.Lock()
+	g, ok := idp.codes[r.FormValue("code")]
+	delete(idp.codes, r.FormValue("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+
+	if !ok || g.redirectURI != r.FormValue("redirect_uri") || g.codeChallenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     idp.Sign(idp.Claims(g.nonce)),
+	})
+}
+
+// KeyFetches returns how many times the IdP's signing keys have been fetched
+func (idp *IdP) KeyFetches() int {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	return idp.keyFetches
+}
+
+func (idp *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	idp.keyFetches++
+	idp.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": idp.KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(idp.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.Key.E)).Bytes()),
+		}},
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
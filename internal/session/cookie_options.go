@@ -0,0 +1,50 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// CookieOptions configures the attributes of the session cookie
+type CookieOptions struct {
+	MaxAge   time.Duration
+	Domain   string
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+// DefaultCookieOptions are the cookie attributes used by NewSession
+var DefaultCookieOptions = CookieOptions{
+	MaxAge:   30 * 24 * time.Hour,
+	HTTPOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+func (o CookieOptions) sessionOptions() *sessions.Options {
+	return &sessions.Options{
+		Path:     "/",
+		Domain:   o.Domain,
+		MaxAge:   int(o.MaxAge.Seconds()),
+		Secure:   o.Secure,
+		HttpOnly: o.HTTPOnly,
+		SameSite: o.SameSite,
+	}
+}
+
+// codecsFromPairs returns codecs for the given key pairs which accept
+// cookies up to maxAge old
+func codecsFromPairs(maxAge time.Duration, keyPairs ...[]byte) []securecookie.Codec {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+
+	for _, c := range codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(maxAge.Seconds()))
+		}
+	}
+
+	return codecs
+}
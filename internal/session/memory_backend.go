@@ -0,0 +1,103 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps session records in memory. Sessions are lost when
+// Topical restarts and aren't shared between instances.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryBackend returns an empty MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{records: map[string]Record{}}
+}
+
+// Load returns a copy of the record with the given ID
+func (b *MemoryBackend) Load(id string) (*Record, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.records[id]
+
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return &r, nil
+}
+
+// Save inserts or updates a record, keeping an existing record's created and expiry times
+func (b *MemoryBackend) Save(r *Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record := *r
+
+	if existing, ok := b.records[r.ID]; ok {
+		record.Created = existing.Created
+		record.Expires = existing.Expires
+	}
+
+	b.records[r.ID] = record
+
+	return nil
+}
+
+// Touch updates a record's last seen time
+func (b *MemoryBackend) Touch(id string, lastSeen time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r, ok := b.records[id]; ok {
+		r.LastSeen = lastSeen
+		b.records[id] = r
+	}
+
+	return nil
+}
+
+// Delete removes a record
+func (b *MemoryBackend) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.records, id)
+
+	return nil
+}
+
+// DeleteUser removes every record belonging to a user
+func (b *MemoryBackend) DeleteUser(userID int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, r := range b.records {
+		if r.UserID != nil && *r.UserID == userID {
+			delete(b.records, id)
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpired removes expired and idle records
+func (b *MemoryBackend) DeleteExpired(now time.Time, idleSince time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+
+	for id, r := range b.records {
+		if now.After(r.Expires) || (!idleSince.IsZero() && r.LastSeen.Before(idleSince)) {
+			delete(b.records, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
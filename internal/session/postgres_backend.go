@@ -0,0 +1,81 @@
+package session
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgresBackend keeps session records in the sessions table, see schema.sql
+type PostgresBackend struct {
+	db *sql.DB
+}
+
+// NewPostgresBackend returns a PostgresBackend using db
+func NewPostgresBackend(db *sql.DB) *PostgresBackend {
+	return &PostgresBackend{db}
+}
+
+// Load returns the record with the given ID
+func (b *PostgresBackend) Load(id string) (*Record, error) {
+	r := Record{ID: id}
+	var userID sql.NullInt64
+	query := `SELECT data, user_id, created, last_seen, expires FROM sessions WHERE id = $1`
+	err := b.db.QueryRow(query, id).Scan(&r.Data, &userID, &r.Created, &r.LastSeen, &r.Expires)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		id := int(userID.Int64)
+		r.UserID = &id
+	}
+
+	return &r, nil
+}
+
+// Save inserts or updates a record, keeping an existing record's created and expiry times
+func (b *PostgresBackend) Save(r *Record) error {
+	query := `
+		INSERT INTO sessions (id, data, user_id, created, last_seen, expires)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE
+		SET data = EXCLUDED.data, user_id = EXCLUDED.user_id, last_seen = EXCLUDED.last_seen`
+	_, err := b.db.Exec(query, r.ID, r.Data, r.UserID, r.Created.UTC(), r.LastSeen.UTC(), r.Expires.UTC())
+	return err
+}
+
+// Touch updates a record's last seen time
+func (b *PostgresBackend) Touch(id string, lastSeen time.Time) error {
+	_, err := b.db.Exec(`UPDATE sessions SET last_seen = $2 WHERE id = $1`, id, lastSeen.UTC())
+	return err
+}
+
+// Delete removes a record
+func (b *PostgresBackend) Delete(id string) error {
+	_, err := b.db.Exec(`DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+// DeleteUser removes every record belonging to a user
+func (b *PostgresBackend) DeleteUser(userID int) error {
+	_, err := b.db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+// DeleteExpired removes expired and idle records
+func (b *PostgresBackend) DeleteExpired(now time.Time, idleSince time.Time) (int, error) {
+	query := `DELETE FROM sessions WHERE expires < $1 OR ($2 AND last_seen < $3)`
+	res, err := b.db.Exec(query, now.UTC(), !idleSince.IsZero(), idleSince.UTC())
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,256 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// ErrSessionNotFound is returned by backends for unknown session IDs
+var ErrSessionNotFound = errors.New("session not found")
+
+// touchInterval limits how often a session's last seen time is written for
+// reads alone, saves always update it
+const touchInterval = time.Minute
+
+// Record is a server-side session as kept by a Backend
+type Record struct {
+	ID       string
+	Data     []byte
+	UserID   *int
+	Created  time.Time
+	LastSeen time.Time
+	Expires  time.Time
+}
+
+// Backend persists the records behind a ServerStore
+type Backend interface {
+	// Load returns the record with the given ID, or ErrSessionNotFound
+	Load(id string) (*Record, error)
+	// Save inserts or updates a record. Updates keep the existing record's
+	// created and expiry times.
+	Save(r *Record) error
+	// Touch updates a record's last seen time
+	Touch(id string, lastSeen time.Time) error
+	// Delete removes a record
+	Delete(id string) error
+	// DeleteUser removes every record belonging to a user
+	DeleteUser(userID int) error
+	// DeleteExpired removes records which expired before now, or were last
+	// seen before idleSince if it isn't zero, returning how many were removed
+	DeleteExpired(now time.Time, idleSince time.Time) (int, error)
+}
+
+// ServerStore is a gorilla/sessions Store keeping session values on the
+// server, with only a signed session ID in the cookie. Sessions expire
+// MaxAge after creation, or after going unused for IdleTimeout.
+type ServerStore struct {
+	Options     *sessions.Options
+	IdleTimeout time.Duration
+	backend     Backend
+	codecs      []securecookie.Codec
+	now         func() time.Time
+}
+
+// NewServerStore returns a ServerStore saving sessions to backend, with
+// session IDs in a cookie with the given attributes, signed with keyPairs as
+// for NewCookieSession. An idleTimeout of 0 disables the idle timeout.
+func NewServerStore(backend Backend, opts CookieOptions, idleTimeout time.Duration, keyPairs ...[]byte) *ServerStore {
+	return &ServerStore{
+		Options:     opts.sessionOptions(),
+		IdleTimeout: idleTimeout,
+		backend:     backend,
+		codecs:      codecsFromPairs(opts.MaxAge, keyPairs...),
+		now:         time.Now,
+	}
+}
+
+// Get returns the cached session for the request, see sessions.Store
+func (s *ServerStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named in the request's cookie, returning a new
+// session if there is none or it has expired
+func (s *ServerStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.codecs...); err != nil {
+		return session, err
+	}
+
+	record, err := s.backend.Load(id)
+	if err == ErrSessionNotFound {
+		return session, nil
+	}
+
+	if err != nil {
+		return session, err
+	}
+
+	now := s.now()
+
+	if now.After(record.Expires) || (s.IdleTimeout > 0 && now.Sub(record.LastSeen) > s.IdleTimeout) {
+		return session, nil
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+
+	if now.Sub(record.LastSeen) > touchInterval {
+		if err := s.backend.Touch(id, now); err != nil {
+			log.Print(err.Error())
+		}
+	}
+
+	session.ID = id
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save writes the session to the backend and its ID to the cookie. A
+// negative MaxAge deletes the session.
+func (s *ServerStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+
+		session.ID = id
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return err
+	}
+
+	now := s.now()
+	record := &Record{
+		ID:       session.ID,
+		Data:     data.Bytes(),
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+
+	if userID, ok := session.Values["user_id"].(int); ok {
+		record.UserID = &userID
+	}
+
+	if err := s.backend.Save(record); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+
+	return nil
+}
+
+// Renew deletes the session's record so it is saved under a new ID,
+// preventing session fixation when a user logs in
+func (s *ServerStore) Renew(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+
+	if err := s.backend.Delete(session.ID); err != nil {
+		return err
+	}
+
+	session.ID = ""
+
+	return nil
+}
+
+// RevokeUser deletes every session belonging to a user
+func (s *ServerStore) RevokeUser(userID int) error {
+	return s.backend.DeleteUser(userID)
+}
+
+// StartJanitor purges expired and idle sessions from the backend every
+// interval until the returned stop function is called
+func (s *ServerStore) StartJanitor(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.purge()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (s *ServerStore) purge() {
+	now := s.now()
+	idleSince := time.Time{}
+
+	if s.IdleTimeout > 0 {
+		idleSince = now.Add(-s.IdleTimeout)
+	}
+
+	n, err := s.backend.DeleteExpired(now, idleSince)
+
+	if err != nil {
+		log.Print("Error purging sessions: ", err.Error())
+		return
+	}
+
+	if n > 0 {
+		log.Printf("Purged %d expired sessions", n)
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
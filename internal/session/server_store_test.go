@@ -0,0 +1,165 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// nextRequest returns a request carrying the cookies set on res
+func nextRequest(res *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+
+	for _, c := range res.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	return req
+}
+
+func newServerSession() (*Session, *ServerStore, *MemoryBackend) {
+	backend := NewMemoryBackend()
+	opts := DefaultCookieOptions
+	opts.MaxAge = 24 * time.Hour
+	store := NewServerStore(backend, opts, time.Hour, []byte("test"))
+	return NewStoreSession(store), store, backend
+}
+
+func TestServerStore(t *testing.T) {
+	t.Run("keeps values on the server with only the ID in the cookie", func(t *testing.T) {
+		s, _, backend := newServerSession()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+
+		s.SaveUser(&models.User{Initials: "JK", Theme: 3}, req, res)
+
+		if len(backend.records) != 1 {
+			t.Errorf("got %d records but wanted 1", len(backend.records))
+		}
+
+		user, err := s.GetUser(nextRequest(res))
+
+		if err != nil || user.Initials != "JK" {
+			t.Error("expected user to be loaded from the backend")
+		}
+	})
+
+	t.Run("ignores forged session IDs", func(t *testing.T) {
+		s, _, _ := newServerSession()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: "forged"})
+
+		if _, err := s.GetUser(req); err == nil {
+			t.Error("expected no user")
+		}
+	})
+
+	t.Run("expires sessions after max age", func(t *testing.T) {
+		s, store, _ := newServerSession()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		s.SaveUser(&models.User{Initials: "JK", Theme: 3}, req, res)
+
+		store.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+
+		if _, err := s.GetUser(nextRequest(res)); err == nil {
+			t.Error("expected session to have expired")
+		}
+	})
+
+	t.Run("expires idle sessions", func(t *testing.T) {
+		s, store, _ := newServerSession()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		s.SaveUser(&models.User{Initials: "JK", Theme: 3}, req, res)
+
+		store.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+
+		if _, err := s.GetUser(nextRequest(res)); err != nil {
+			t.Error("expected session to be active")
+		}
+
+		store.now = func() time.Time { return time.Now().Add(80 * time.Minute) }
+
+		if _, err := s.GetUser(nextRequest(res)); err != nil {
+			t.Error("expected reading the session to have reset its idle timeout")
+		}
+
+		store.now = func() time.Time { return time.Now().Add(3 * time.Hour) }
+
+		if _, err := s.GetUser(nextRequest(res)); err == nil {
+			t.Error("expected session to have gone idle")
+		}
+	})
+
+	t.Run("moves the session to a new ID on log in", func(t *testing.T) {
+		s, _, backend := newServerSession()
+		req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		s.SaveFlash("hello", req, res)
+		before := res.Result().Cookies()[0].Value
+
+		res = httptest.NewRecorder()
+		s.SaveUserID(7, req, res)
+
+		if res.Result().Cookies()[0].Value == before || len(backend.records) != 1 {
+			t.Error("expected session to be saved under a new ID")
+		}
+
+		if id, _ := s.GetUserID(nextRequest(res)); id != 7 {
+			t.Errorf("got user ID %d but wanted 7", id)
+		}
+	})
+
+	t.Run("logs a user out everywhere", func(t *testing.T) {
+		s, _, backend := newServerSession()
+		laptop := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		s.SaveUserID(7, laptop, httptest.NewRecorder())
+		phone := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		res := httptest.NewRecorder()
+		s.SaveUserID(7, phone, res)
+		other := httptest.NewRequest(http.MethodGet, "/topics", nil)
+		s.SaveUserID(8, other, httptest.NewRecorder())
+
+		if err := s.LogoutEverywhere(nextRequest(res), httptest.NewRecorder()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range backend.records {
+			if r.UserID != nil && *r.UserID == 7 {
+				t.Error("expected user's sessions to be deleted")
+			}
+		}
+
+		if len(backend.records) != 2 {
+			t.Errorf("got %d records but wanted the other user's and the renewed session", len(backend.records))
+		}
+	})
+
+	t.Run("purges expired and idle sessions", func(t *testing.T) {
+		s, store, backend := newServerSession()
+		s.SaveFlash("old", httptest.NewRequest(http.MethodGet, "/topics", nil), httptest.NewRecorder())
+
+		store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		s.SaveFlash("new", httptest.NewRequest(http.MethodGet, "/topics", nil), httptest.NewRecorder())
+		store.purge()
+
+		if len(backend.records) != 1 {
+			t.Errorf("got %d records but wanted 1", len(backend.records))
+		}
+	})
+}
+
+func TestLogoutEverywhereCookieStore(t *testing.T) {
+	s := NewSession("test")
+	req := httptest.NewRequest(http.MethodGet, "/topics", nil)
+	res := httptest.NewRecorder()
+	s.SaveUserID(7, req, res)
+
+	if err := s.LogoutEverywhere(req, res); err != ErrRevokeUnsupported {
+		t.Errorf("got %v but wanted %v", err, ErrRevokeUnsupported)
+	}
+}
@@ -1,6 +1,8 @@
 package session
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"log"
@@ -14,23 +16,68 @@ import (
 type TopicalSession interface {
 	GetUser(r *http.Request) (*models.User, error)
 	SaveUser(u *models.User, r *http.Request, w http.ResponseWriter) error
+	GetUserID(r *http.Request) (int, error)
+	SaveUserID(id int, r *http.Request, w http.ResponseWriter) error
+	ClearUser(r *http.Request, w http.ResponseWriter) error
+	SaveLoginState(state string, r *http.Request, w http.ResponseWriter) error
+	PopLoginState(r *http.Request, w http.ResponseWriter) (string, error)
+	LogoutEverywhere(r *http.Request, w http.ResponseWriter) error
+	GetPreferences(r *http.Request) models.Preferences
+	SavePreferences(p models.Preferences, r *http.Request, w http.ResponseWriter) error
 	SaveFlash(message string, r *http.Request, w http.ResponseWriter) error
 	GetFlashes(r *http.Request, w http.ResponseWriter) ([]string, error)
+	GetID(r *http.Request, w http.ResponseWriter) (string, error)
+	SetModerator(isModerator bool, r *http.Request, w http.ResponseWriter) error
+	IsModerator(r *http.Request) bool
+	GetCSRFToken(r *http.Request, w http.ResponseWriter) (string, error)
 }
 
-// Session is a struct which wraps a gorilla/sessions CookieStore
+// ErrRevokeUnsupported is returned by LogoutEverywhere when sessions are
+// kept in cookies, which can't be revoked
+var ErrRevokeUnsupported = errors.New("session store does not support revoking sessions")
+
+// Session is a struct which wraps a gorilla/sessions Store
 // and implements a few methods used for retrieval and storage of session items.
 type Session struct {
-	session *sessions.CookieStore
+	session sessions.Store
+}
+
+// renewer is implemented by stores which can move a session to a new ID
+type renewer interface {
+	Renew(session *sessions.Session) error
+}
+
+// revoker is implemented by stores which can delete all of a user's sessions
+type revoker interface {
+	RevokeUser(userID int) error
 }
 
-// NewSession returns a new session instance, based on a provided key
+// NewSession returns a new session instance keeping sessions in cookies,
+// based on a provided key and DefaultCookieOptions
 func NewSession(sessionKey string) *Session {
-	s := sessions.NewCookieStore([]byte(sessionKey))
+	return NewCookieSession(DefaultCookieOptions, []byte(sessionKey))
+}
+
+// NewCookieSession returns a new session instance keeping sessions in
+// cookies with the given attributes. keyPairs are authentication and
+// encryption keys, as for sessions.NewCookieStore: cookies are written with
+// the first pair and read with any, so keys can be rotated by adding a new
+// pair in front of the old one.
+func NewCookieSession(opts CookieOptions, keyPairs ...[]byte) *Session {
+	s := &sessions.CookieStore{
+		Codecs:  codecsFromPairs(opts.MaxAge, keyPairs...),
+		Options: opts.sessionOptions(),
+	}
+
 	return &Session{s}
 }
 
-// GetUser returns the the User from the session, if present
+// NewStoreSession returns a new session instance keeping sessions in the given store
+func NewStoreSession(store sessions.Store) *Session {
+	return &Session{store}
+}
+
+// GetUser returns the the anonymous User from the session, if present
 func (s *Session) GetUser(r *http.Request) (*models.User, error) {
 	session, _ := s.session.Get(r, "s")
 	val := session.Values["user"]
@@ -44,7 +91,7 @@ func (s *Session) GetUser(r *http.Request) (*models.User, error) {
 	return u, nil
 }
 
-// SaveUser saves a user to the session
+// SaveUser saves an anonymous user to the session, replacing any logged in account
 func (s *Session) SaveUser(u *models.User, r *http.Request, w http.ResponseWriter) error {
 	session, _ := s.session.Get(r, "s")
 	j, err := json.Marshal(u)
@@ -54,6 +101,7 @@ func (s *Session) SaveUser(u *models.User, r *http.Request, w http.ResponseWrite
 	}
 
 	session.Values["user"] = string(j)
+	delete(session.Values, "user_id")
 
 	if err := session.Save(r, w); err != nil {
 		return errors.New("Unable to save user")
@@ -62,6 +110,159 @@ func (s *Session) SaveUser(u *models.User, r *http.Request, w http.ResponseWrite
 	return nil
 }
 
+// GetUserID returns the ID of the account logged in to the session, if present
+func (s *Session) GetUserID(r *http.Request) (int, error) {
+	session, _ := s.session.Get(r, "s")
+	id, ok := session.Values["user_id"].(int)
+
+	if !ok {
+		return 0, errors.New("User ID not found")
+	}
+
+	return id, nil
+}
+
+// SaveUserID logs an account in to the session, replacing any anonymous
+// user. Stores which support it move the session to a new ID.
+func (s *Session) SaveUserID(id int, r *http.Request, w http.ResponseWriter) error {
+	session, _ := s.session.Get(r, "s")
+	session.Values["user_id"] = id
+	delete(session.Values, "user")
+
+	if store, ok := s.session.(renewer); ok {
+		if err := store.Renew(session); err != nil {
+			log.Print(err.Error())
+			return err
+		}
+	}
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ClearUser removes the anonymous user or logged in account from the session
+func (s *Session) ClearUser(r *http.Request, w http.ResponseWriter) error {
+	session, _ := s.session.Get(r, "s")
+	delete(session.Values, "user")
+	delete(session.Values, "user_id")
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// LogoutEverywhere ends every session logged in to the current account,
+// including this one. Returns ErrRevokeUnsupported for cookie sessions.
+func (s *Session) LogoutEverywhere(r *http.Request, w http.ResponseWriter) error {
+	store, ok := s.session.(revoker)
+
+	if !ok {
+		return ErrRevokeUnsupported
+	}
+
+	session, _ := s.session.Get(r, "s")
+	id, ok := session.Values["user_id"].(int)
+
+	if !ok {
+		return errors.New("User ID not found")
+	}
+
+	if err := store.RevokeUser(id); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	delete(session.Values, "user_id")
+
+	if store, ok := s.session.(renewer); ok {
+		if err := store.Renew(session); err != nil {
+			log.Print(err.Error())
+			return err
+		}
+	}
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetPreferences returns the display preferences saved in the session, or
+// the defaults if none were saved
+func (s *Session) GetPreferences(r *http.Request) models.Preferences {
+	session, _ := s.session.Get(r, "s")
+	var p models.Preferences
+
+	if val, ok := session.Values["preferences"].(string); ok {
+		json.Unmarshal([]byte(val), &p)
+	}
+
+	return p
+}
+
+// SavePreferences saves display preferences to the session. They are kept
+// when users log in or out.
+func (s *Session) SavePreferences(p models.Preferences, r *http.Request, w http.ResponseWriter) error {
+	session, _ := s.session.Get(r, "s")
+	j, err := json.Marshal(p)
+
+	if err != nil {
+		return errors.New("Unable to save preferences")
+	}
+
+	session.Values["preferences"] = string(j)
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SaveLoginState saves state for a sign in started with an identity
+// provider, to be checked when the provider redirects back
+func (s *Session) SaveLoginState(state string, r *http.Request, w http.ResponseWriter) error {
+	session, _ := s.session.Get(r, "s")
+	session.Values["login_state"] = state
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// PopLoginState returns and removes the saved sign in state, so each sign
+// in can only be completed once
+func (s *Session) PopLoginState(r *http.Request, w http.ResponseWriter) (string, error) {
+	session, _ := s.session.Get(r, "s")
+	state, ok := session.Values["login_state"].(string)
+
+	if !ok {
+		return "", errors.New("Login state not found")
+	}
+
+	delete(session.Values, "login_state")
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return "", err
+	}
+
+	return state, nil
+}
+
 // SaveFlash saves a flash message to the session
 func (s *Session) SaveFlash(message string, r *http.Request, w http.ResponseWriter) error {
 	session, _ := s.session.Get(r, "s")
@@ -96,3 +297,83 @@ func (s *Session) GetFlashes(r *http.Request, w http.ResponseWriter) ([]string,
 
 	return flashStrings, nil
 }
+
+// GetID returns a random identifier unique to the session, creating and
+// saving one if the session does not have one yet.
+func (s *Session) GetID(r *http.Request, w http.ResponseWriter) (string, error) {
+	session, _ := s.session.Get(r, "s")
+
+	if id, ok := session.Values["id"].(string); ok {
+		return id, nil
+	}
+
+	id, err := randomToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	session.Values["id"] = id
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetCSRFToken returns the token forms must include to prove they were
+// rendered for this session, creating and saving one if needed.
+func (s *Session) GetCSRFToken(r *http.Request, w http.ResponseWriter) (string, error) {
+	session, _ := s.session.Get(r, "s")
+
+	if token, ok := session.Values["csrf"].(string); ok {
+		return token, nil
+	}
+
+	token, err := randomToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	session.Values["csrf"] = token
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return "", err
+	}
+
+	return token, nil
+}
+
+// SetModerator marks or unmarks the session as belonging to a moderator
+func (s *Session) SetModerator(isModerator bool, r *http.Request, w http.ResponseWriter) error {
+	session, _ := s.session.Get(r, "s")
+	session.Values["moderator"] = isModerator
+
+	if err := session.Save(r, w); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// IsModerator reports whether the session belongs to a moderator
+func (s *Session) IsModerator(r *http.Request) bool {
+	session, _ := s.session.Get(r, "s")
+	isModerator, _ := session.Values["moderator"].(bool)
+	return isModerator
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
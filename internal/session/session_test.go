@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestUser(t *testing.T) {
@@ -36,6 +37,82 @@ func TestUser(t *testing.T) {
 	})
 }
 
+func TestUserID(t *testing.T) {
+	t.Run("save and return user ID, replacing anonymous user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+		s.SaveUser(&models.User{Initials: "JK", Theme: 0}, req, res)
+		s.SaveUserID(7, req, res)
+
+		if id, _ := s.GetUserID(req); id != 7 {
+			t.Errorf("got user ID %d but wanted 7", id)
+		}
+
+		if _, err := s.GetUser(req); err == nil {
+			t.Error("anonymous user should have been removed")
+		}
+	})
+
+	t.Run("clears user ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+		s.SaveUserID(7, req, res)
+		s.ClearUser(req, res)
+
+		if _, err := s.GetUserID(req); err == nil {
+			t.Error("expected error to be present")
+		}
+	})
+}
+
+func TestPreferences(t *testing.T) {
+	t.Run("save and return preferences, keeping them across logout", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+		s.SaveUser(&models.User{Initials: "JK", Theme: 0}, req, res)
+		s.SavePreferences(models.Preferences{Appearance: "dark", Timezone: "Europe/Paris"}, req, res)
+		s.ClearUser(req, res)
+
+		if p := s.GetPreferences(req); p.Appearance != "dark" || p.Timezone != "Europe/Paris" {
+			t.Errorf("got preferences %+v", p)
+		}
+	})
+
+	t.Run("returns defaults if none saved", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+
+		s := NewSession("test")
+
+		if p := s.GetPreferences(req); p != (models.Preferences{}) {
+			t.Errorf("got preferences %+v but wanted defaults", p)
+		}
+	})
+}
+
+func TestLoginState(t *testing.T) {
+	t.Run("returns saved state once", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+		s.SaveLoginState("abc", req, res)
+
+		if state, _ := s.PopLoginState(req, res); state != "abc" {
+			t.Errorf("got state %q but wanted abc", state)
+		}
+
+		if _, err := s.PopLoginState(req, res); err == nil {
+			t.Error("expected state to be removed")
+		}
+	})
+}
+
 func TestFlashes(t *testing.T) {
 	t.Run("save and return flashes", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
@@ -72,3 +149,118 @@ func TestFlashes(t *testing.T) {
 		}
 	})
 }
+
+func TestID(t *testing.T) {
+	t.Run("returns the same id for the same session", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+
+		first, _ := s.GetID(req, res)
+		second, _ := s.GetID(req, res)
+
+		if first == "" || first != second {
+			t.Error("session id should be stable once created")
+		}
+	})
+
+	t.Run("returns different ids for different sessions", func(t *testing.T) {
+		s := NewSession("test")
+
+		first, _ := s.GetID(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		second, _ := s.GetID(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+		if first == second {
+			t.Error("session ids should differ between sessions")
+		}
+	})
+}
+
+func TestModerator(t *testing.T) {
+	t.Run("sessions are not moderators by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+
+		s := NewSession("test")
+
+		if s.IsModerator(req) {
+			t.Error("session should not be a moderator")
+		}
+	})
+
+	t.Run("set and return moderator status", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+		s.SetModerator(true, req, res)
+
+		if s.IsModerator(req) == false {
+			t.Error("session should be a moderator")
+		}
+	})
+}
+
+func TestCSRFToken(t *testing.T) {
+	t.Run("returns the same token for the same session", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+
+		s := NewSession("test")
+
+		first, _ := s.GetCSRFToken(req, res)
+		second, _ := s.GetCSRFToken(req, res)
+
+		if first == "" || first != second {
+			t.Error("csrf token should be stable once created")
+		}
+	})
+}
+
+func TestCookieSession(t *testing.T) {
+	oldKey := []byte("old-authentication-key-0123456789")
+	newKey := []byte("new-authentication-key-0123456789")
+	encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+
+	saveUser := func(s *Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		res := httptest.NewRecorder()
+		s.SaveUser(&models.User{Initials: "JK", Theme: 0}, req, res)
+		return res
+	}
+
+	withCookies := func(res *httptest.ResponseRecorder) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/topics/12", nil)
+		for _, c := range res.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		return req
+	}
+
+	t.Run("reads cookies written with a rotated out key", func(t *testing.T) {
+		res := saveUser(NewCookieSession(DefaultCookieOptions, oldKey, encryptionKey))
+		rotated := NewCookieSession(DefaultCookieOptions, newKey, encryptionKey, oldKey, encryptionKey)
+
+		if _, err := rotated.GetUser(withCookies(res)); err != nil {
+			t.Error("expected cookie signed with the old key to be accepted")
+		}
+	})
+
+	t.Run("rejects cookies written with an unknown key", func(t *testing.T) {
+		res := saveUser(NewCookieSession(DefaultCookieOptions, oldKey, encryptionKey))
+		replaced := NewCookieSession(DefaultCookieOptions, newKey, encryptionKey)
+
+		if _, err := replaced.GetUser(withCookies(res)); err == nil {
+			t.Error("expected cookie signed with an unknown key to be rejected")
+		}
+	})
+
+	t.Run("sets configured cookie attributes", func(t *testing.T) {
+		opts := CookieOptions{MaxAge: time.Hour, Domain: "example.com", Secure: true, HTTPOnly: true, SameSite: http.SameSiteStrictMode}
+		cookie := saveUser(NewCookieSession(opts, newKey)).Result().Cookies()[0]
+
+		if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Domain != "example.com" || cookie.MaxAge != 3600 {
+			t.Errorf("unexpected cookie attributes %+v", cookie)
+		}
+	})
+}
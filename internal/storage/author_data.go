@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrAuthorNotFound is returned when no messages are stored with an author key
+var ErrAuthorNotFound = errors.New("no messages from author")
+
+// GetMessagesByAuthorKey returns every message stored with the given author
+// key, oldest first, with their topic titles and reactions. Content is
+// returned as the author wrote it rather than rendered, and includes pending
+// and hidden messages, since it is the author's own data.
+func (s *Storage) GetMessagesByAuthorKey(authorKey string) ([]models.Message, error) {
+	messages := []models.Message{}
+	query := `
+		SELECT messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.status, messages.hidden, messages.author_tripcode
+		FROM messages
+		INNER JOIN topics ON topics.id = messages.topic_id
+		WHERE messages.author_key = $1
+		ORDER BY messages.posted ASC, messages.id ASC;`
+
+	rows, err := s.db.Query(query, authorKey)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, topicID, authorTheme int
+		var title, content, authorInitials, status, tripcode string
+		var hidden bool
+		var posted time.Time
+
+		if err = rows.Scan(&id, &topicID, &title, &content, &authorInitials, &authorTheme, &posted, &status, &hidden, &tripcode); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		messages = append(messages, models.Message{
+			ID:             &id,
+			TopicID:        &topicID,
+			TopicTitle:     title,
+			Content:        content,
+			AuthorInitials: authorInitials,
+			AuthorTheme:    authorTheme,
+			Posted:         posted,
+			Status:         status,
+			Hidden:         hidden,
+			AuthorTripcode: tripcode,
+			AuthorKey:      authorKey,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	if err := s.withReactions(messages, authorKey); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// CountMessagesByAuthorKey returns how many messages are stored with the
+// given author key, including pending and hidden ones
+func (s *Storage) CountMessagesByAuthorKey(authorKey string) (int, error) {
+	count := 0
+	query := `SELECT COUNT(*) FROM messages WHERE author_key = $1`
+
+	if err := s.db.QueryRow(query, authorKey).Scan(&count); err != nil {
+		log.Print(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetLatestAuthorMessage returns the most recent message stored with the
+// given author key, with the initials, theme, account, and tripcode it was
+// posted under, or ErrAuthorNotFound if there is none
+func (s *Storage) GetLatestAuthorMessage(authorKey string) (*models.Message, error) {
+	if authorKey == "" {
+		return nil, ErrAuthorNotFound
+	}
+
+	m := models.Message{AuthorKey: authorKey}
+	var id, topicID int
+	query := `
+		SELECT id, topic_id, author_initials, author_theme, user_id, author_tripcode
+		FROM messages
+		WHERE author_key = $1
+		ORDER BY posted DESC, id DESC
+		LIMIT 1`
+	err := s.db.QueryRow(query, authorKey).Scan(&id, &topicID, &m.AuthorInitials, &m.AuthorTheme, &m.UserID, &m.AuthorTripcode)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthorNotFound
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	m.ID = &id
+	m.TopicID = &topicID
+
+	return &m, nil
+}
+
+// EraseMessagesByAuthorKey removes every message stored with the given
+// author key, returning how many were affected, and forgets which topics
+// they've read and watch, their notifications and email digest. When
+// anonymize is true the messages are kept but stripped of everything tying
+// them to their author; otherwise they are deleted along with their
+// reports, and topics left without messages are deleted too.
+func (s *Storage) EraseMessagesByAuthorKey(authorKey string, anonymize bool) (int, error) {
+	if authorKey == "" {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return 0, err
+	}
+
+	forget := []string{
+		`DELETE FROM reads WHERE reader_key = $1`,
+		`DELETE FROM subscriptions WHERE subscriber_key = $1`,
+		`DELETE FROM notifications WHERE recipient_key = $1`,
+		`DELETE FROM digests WHERE recipient_key = $1`,
+		`DELETE FROM message_reactions WHERE reactor_key = $1`,
+		`DELETE FROM poll_votes WHERE voter_key = $1`,
+		`UPDATE polls SET author_key = '' WHERE author_key = $1`,
+	}
+
+	for _, query := range forget {
+		if _, err := tx.Exec(query, authorKey); err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if anonymize {
+		anonymizeMessages := `
+			UPDATE messages
+			SET author_initials = $2, author_theme = $3, user_id = NULL, author_tripcode = '', author_key = ''
+			WHERE author_key = $1`
+		result, err := tx.Exec(anonymizeMessages, authorKey, models.AnonymizedInitials, models.AnonymizedTheme)
+
+		if err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return 0, err
+		}
+
+		count, _ := result.RowsAffected()
+		return int(count), tx.Commit()
+	}
+
+	deleteReports := `DELETE FROM reports WHERE message_id IN (SELECT id FROM messages WHERE author_key = $1)`
+
+	if _, err := tx.Exec(deleteReports, authorKey); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return 0, err
+	}
+
+	rows, err := tx.Query(`DELETE FROM messages WHERE author_key = $1 RETURNING topic_id`, authorKey)
+
+	if err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return 0, err
+	}
+
+	topicIDs := []int{}
+
+	for rows.Next() {
+		var topicID int
+
+		if err := rows.Scan(&topicID); err != nil {
+			log.Print(err.Error())
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+
+		topicIDs = append(topicIDs, topicID)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return 0, err
+	}
+
+	deleteEmptyTopics := `
+		DELETE FROM topics
+		WHERE id = ANY($1) AND NOT EXISTS (SELECT 1 FROM messages WHERE messages.topic_id = topics.id)`
+
+	if _, err := tx.Exec(deleteEmptyTopics, pq.Array(topicIDs)); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return 0, err
+	}
+
+	return len(topicIDs), tx.Commit()
+}
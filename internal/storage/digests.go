@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// SaveDigest sets the recipient's digest email and frequency, setting
+// whether it's confirmed. Changing the email means it must be confirmed again.
+func (s *Storage) SaveDigest(d *models.Digest) (*models.Digest, error) {
+	query := `
+		INSERT INTO digests (recipient_key, email, frequency) VALUES ($1, $2, $3)
+		ON CONFLICT (recipient_key) DO UPDATE
+		SET email = EXCLUDED.email, frequency = EXCLUDED.frequency,
+			confirmed = digests.confirmed AND digests.email = EXCLUDED.email
+		RETURNING confirmed, last_sent`
+
+	if err := s.db.QueryRow(query, d.RecipientKey, d.Email, d.Frequency).Scan(&d.Confirmed, &d.LastSent); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// ClaimDigestConfirmation records that a confirmation email is being sent for
+// the recipient's digest, returning false without recording it if one was sent
+// to the recipient, or to their address, within the last interval
+func (s *Storage) ClaimDigestConfirmation(recipientKey string, interval time.Duration) (bool, error) {
+	query := `
+		UPDATE digests SET confirmation_sent = NOW()
+		WHERE recipient_key = $1
+			AND (confirmation_sent IS NULL OR confirmation_sent <= NOW() - make_interval(secs => $2))
+			AND NOT EXISTS (
+				SELECT 1 FROM digests other
+				WHERE lower(other.email) = lower(digests.email)
+					AND other.confirmation_sent > NOW() - make_interval(secs => $2)
+			)`
+
+	res, err := s.db.Exec(query, recipientKey, interval.Seconds())
+
+	if err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	claimed, err := res.RowsAffected()
+
+	if err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	return claimed > 0, nil
+}
+
+// GetDigest returns the recipient's digest, or nil if they haven't asked for one
+func (s *Storage) GetDigest(recipientKey string) (*models.Digest, error) {
+	d := models.Digest{RecipientKey: recipientKey}
+	query := `SELECT email, frequency, confirmed, last_sent FROM digests WHERE recipient_key = $1`
+	err := s.db.QueryRow(query, recipientKey).Scan(&d.Email, &d.Frequency, &d.Confirmed, &d.LastSent)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// GetConfirmedDigestsByEmail returns the confirmed digests sent to an email,
+// compared case-insensitively
+func (s *Storage) GetConfirmedDigestsByEmail(email string) ([]models.Digest, error) {
+	digests := []models.Digest{}
+	query := `
+		SELECT recipient_key, email, frequency, last_sent
+		FROM digests
+		WHERE confirmed = true AND lower(email) = lower($1)`
+
+	rows, err := s.db.Query(query, email)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d := models.Digest{Confirmed: true}
+
+		if err = rows.Scan(&d.RecipientKey, &d.Email, &d.Frequency, &d.LastSent); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		digests = append(digests, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+// ConfirmDigest confirms the recipient owns the email their digest is sent
+// to, returning false if their digest has since moved to another email.
+// Digests start counting activity from when they're first confirmed.
+func (s *Storage) ConfirmDigest(recipientKey string, email string) (bool, error) {
+	query := `
+		UPDATE digests SET confirmed = true, last_sent = (CASE WHEN confirmed THEN last_sent ELSE NOW() END)
+		WHERE recipient_key = $1 AND email = $2`
+	result, err := s.db.Exec(query, recipientKey, email)
+
+	if err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+
+	if err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteDigest stops sending the recipient digests
+func (s *Storage) DeleteDigest(recipientKey string) error {
+	if _, err := s.db.Exec(`DELETE FROM digests WHERE recipient_key = $1`, recipientKey); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetDueDigests returns the confirmed digests which haven't been sent for a
+// day, or a week for weekly digests
+func (s *Storage) GetDueDigests() ([]models.Digest, error) {
+	digests := []models.Digest{}
+	query := `
+		SELECT recipient_key, email, frequency, last_sent
+		FROM digests
+		WHERE confirmed = true AND last_sent <= NOW() - (CASE frequency WHEN 'daily' THEN interval '1 day' ELSE interval '7 days' END)
+		ORDER BY last_sent ASC`
+
+	rows, err := s.db.Query(query)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d := models.Digest{Confirmed: true}
+
+		if err = rows.Scan(&d.RecipientKey, &d.Email, &d.Frequency, &d.LastSent); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		digests = append(digests, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+// GetDigestActivity returns the visible messages posted since the given time
+// in topics the recipient watches, other than their own, oldest first. It
+// also returns the time, by the database's clock, the activity was read up
+// to, taken before reading so messages posted meanwhile are left for the
+// next digest.
+func (s *Storage) GetDigestActivity(recipientKey string, since time.Time) ([]models.Message, time.Time, error) {
+	messages := []models.Message{}
+	var until time.Time
+
+	if err := s.db.QueryRow(`SELECT NOW()::timestamp`).Scan(&until); err != nil {
+		log.Print(err.Error())
+		return nil, until, err
+	}
+
+	query := `
+		SELECT messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted
+		FROM subscriptions
+		INNER JOIN topics ON topics.id = subscriptions.topic_id
+		INNER JOIN messages ON messages.topic_id = subscriptions.topic_id
+		WHERE subscriptions.subscriber_key = $1 AND messages.posted > $2 AND messages.posted <= $3
+			AND messages.status = 'approved' AND messages.hidden = false
+			AND messages.author_key <> subscriptions.subscriber_key
+		ORDER BY messages.posted ASC, messages.id ASC`
+
+	rows, err := s.db.Query(query, recipientKey, since, until)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, until, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, topicID, authorTheme int
+		var title, content, authorInitials string
+		var posted time.Time
+
+		if err = rows.Scan(&id, &topicID, &title, &content, &authorInitials, &authorTheme, &posted); err != nil {
+			log.Print(err.Error())
+			return nil, until, err
+		}
+
+		messages = append(messages, models.Message{
+			ID:             &id,
+			TopicID:        &topicID,
+			TopicTitle:     title,
+			Content:        content,
+			AuthorInitials: authorInitials,
+			AuthorTheme:    authorTheme,
+			Posted:         posted,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, until, err
+	}
+
+	return messages, until, nil
+}
+
+// MarkDigestSent records the recipient's digest was sent with the activity
+// up to until, so the next one covers activity from then on
+func (s *Storage) MarkDigestSent(recipientKey string, until time.Time) error {
+	if _, err := s.db.Exec(`UPDATE digests SET last_sent = $2 WHERE recipient_key = $1`, recipientKey, until); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// notify notifies the authors a message mentions and everyone watching its
+// topic, except its author, and queues its delivery to every webhook, once
+// the message is visible to readers. Messages which are pending or hidden
+// are skipped, and notified when they're approved instead. Mentions reach
+// everyone who has posted under the mentioned initials, in any topic, and
+// someone both mentioned and watching is notified once.
+func notify(e execer, messageID int) error {
+	mentioned := `
+		INSERT INTO notifications (recipient_key, message_id, kind)
+		SELECT DISTINCT mentioned.author_key, messages.id, 'mention'
+		FROM messages
+		INNER JOIN mentions ON mentions.message_id = messages.id
+		INNER JOIN messages mentioned ON mentioned.author_initials = mentions.initials
+			AND (mentions.theme = 0 OR mentioned.author_theme = mentions.theme)
+		WHERE messages.id = $1 AND messages.status = 'approved' AND messages.hidden = false
+			AND mentioned.author_key <> '' AND mentioned.author_key <> messages.author_key
+		ON CONFLICT (recipient_key, message_id) DO NOTHING`
+
+	subscribed := `
+		INSERT INTO notifications (recipient_key, message_id, kind)
+		SELECT subscriptions.subscriber_key, messages.id, 'reply'
+		FROM subscriptions
+		INNER JOIN messages ON messages.topic_id = subscriptions.topic_id
+		WHERE messages.id = $1 AND messages.status = 'approved' AND messages.hidden = false
+			AND subscriptions.subscriber_key <> messages.author_key
+		ON CONFLICT (recipient_key, message_id) DO NOTHING`
+
+	// A topic is announced by its first visible message
+	webhooks := `
+		INSERT INTO webhook_deliveries (webhook_id, message_id, event)
+		SELECT webhooks.id, messages.id, (CASE WHEN EXISTS (
+			SELECT 1 FROM messages earlier
+			WHERE earlier.topic_id = messages.topic_id AND earlier.id < messages.id
+				AND earlier.status = 'approved' AND earlier.hidden = false
+		) THEN 'message.created' ELSE 'topic.created' END)
+		FROM webhooks, messages
+		WHERE messages.id = $1 AND messages.status = 'approved' AND messages.hidden = false
+		ON CONFLICT (webhook_id, message_id) DO NOTHING`
+
+	for _, query := range []string{mentioned, subscribed, webhooks} {
+		if _, err := e.Exec(query, messageID); err != nil {
+			log.Print(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe has the subscriber watch a topic
+func (s *Storage) Subscribe(subscriberKey string, topicID int) error {
+	query := `
+		INSERT INTO subscriptions (subscriber_key, topic_id) VALUES ($1, $2)
+		ON CONFLICT (subscriber_key, topic_id) DO NOTHING`
+
+	if _, err := s.db.Exec(query, subscriberKey, topicID); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Unsubscribe stops the subscriber watching a topic
+func (s *Storage) Unsubscribe(subscriberKey string, topicID int) error {
+	query := `DELETE FROM subscriptions WHERE subscriber_key = $1 AND topic_id = $2`
+
+	if _, err := s.db.Exec(query, subscriberKey, topicID); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// IsSubscribed reports whether the subscriber watches a topic
+func (s *Storage) IsSubscribed(subscriberKey string, topicID int) (bool, error) {
+	var subscribed bool
+	query := `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE subscriber_key = $1 AND topic_id = $2)`
+
+	if err := s.db.QueryRow(query, subscriberKey, topicID).Scan(&subscribed); err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	return subscribed, nil
+}
+
+// GetNotifications returns the recipient's most recent notifications, newest
+// first, leaving out messages which have since been hidden
+func (s *Storage) GetNotifications(recipientKey string, limit int) ([]models.Notification, error) {
+	notifications := []models.Notification{}
+	query := `
+		SELECT notifications.id, notifications.kind, notifications.read, notifications.created, messages.id, messages.topic_id, topics.title, messages.author_initials, messages.author_theme, messages.posted
+		FROM notifications
+		INNER JOIN messages ON messages.id = notifications.message_id
+		INNER JOIN topics ON topics.id = messages.topic_id
+		WHERE notifications.recipient_key = $1 AND messages.status = 'approved' AND messages.hidden = false
+		ORDER BY notifications.created DESC, notifications.id DESC
+		LIMIT $2;`
+
+	rows, err := s.db.Query(query, recipientKey, limit)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, messageID, topicID, authorTheme int
+		var read bool
+		var kind, title, authorInitials string
+		var created, posted time.Time
+
+		if err = rows.Scan(&id, &kind, &read, &created, &messageID, &topicID, &title, &authorInitials, &authorTheme, &posted); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		notifications = append(notifications, models.Notification{
+			ID:      &id,
+			Kind:    kind,
+			Read:    read,
+			Created: created,
+			Message: &models.Message{
+				ID:             &messageID,
+				TopicID:        &topicID,
+				TopicTitle:     title,
+				AuthorInitials: authorInitials,
+				AuthorTheme:    authorTheme,
+				Posted:         posted,
+			},
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications returns how many of the recipient's notifications
+// they haven't seen
+func (s *Storage) CountUnreadNotifications(recipientKey string) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(notifications.id)
+		FROM notifications
+		INNER JOIN messages ON messages.id = notifications.message_id
+		WHERE notifications.recipient_key = $1 AND notifications.read = false
+			AND messages.status = 'approved' AND messages.hidden = false`
+
+	if err := s.db.QueryRow(query, recipientKey).Scan(&count); err != nil {
+		log.Print(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead marks all of the recipient's notifications as seen
+func (s *Storage) MarkNotificationsRead(recipientKey string) error {
+	query := `UPDATE notifications SET read = true WHERE recipient_key = $1 AND read = false`
+
+	if _, err := s.db.Exec(query, recipientKey); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
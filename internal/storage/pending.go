@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/markdown"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// HasApprovedMessage reports whether the author has ever had a message approved
+func (s *Storage) HasApprovedMessage(authorKey string) (bool, error) {
+	approved := false
+	query := `SELECT EXISTS (SELECT 1 FROM messages WHERE author_key = $1 AND author_key <> '' AND status = 'approved')`
+
+	if err := s.db.QueryRow(query, authorKey).Scan(&approved); err != nil {
+		log.Print(err.Error())
+		return false, err
+	}
+
+	return approved, nil
+}
+
+// GetPendingMessages returns messages awaiting moderator approval, oldest first
+func (s *Storage) GetPendingMessages() ([]models.Message, error) {
+	messages := []models.Message{}
+	query := `
+		SELECT messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted
+		FROM messages
+		INNER JOIN topics ON topics.id = messages.topic_id
+		WHERE messages.status = 'pending' AND messages.hidden = false
+		ORDER BY messages.posted ASC;`
+
+	rows, err := s.db.Query(query)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, topicID, authorTheme int
+		var title, content, authorInitials string
+		var posted time.Time
+
+		if err = rows.Scan(&id, &topicID, &title, &content, &authorInitials, &authorTheme, &posted); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		safeHTML, err := markdown.Render(content)
+
+		if err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		messages = append(messages, models.Message{
+			ID:             &id,
+			TopicID:        &topicID,
+			TopicTitle:     title,
+			Content:        safeHTML,
+			AuthorInitials: authorInitials,
+			AuthorTheme:    authorTheme,
+			Posted:         posted,
+			Status:         "pending",
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// SetMessageStatus approves or rejects a message, notifying subscribers to
+// its topic and the authors it mentions when it is approved
+func (s *Storage) SetMessageStatus(id int, status string) error {
+	if _, err := s.db.Exec(`UPDATE messages SET status = $1 WHERE id = $2`, status, id); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	if status == "approved" {
+		return notify(s.db, id)
+	}
+
+	return nil
+}
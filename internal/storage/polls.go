@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrPollClosed is returned when voting in a poll which has closed
+var ErrPollClosed = errors.New("poll closed")
+
+// CreatePoll inserts a poll into the DB with its options, setting their IDs
+func (s *Storage) CreatePoll(p *models.Poll) (*models.Poll, error) {
+	id := 0
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	insertPoll := `
+		INSERT INTO polls (topic_id, question, multiple, closes, author_key) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	if err := tx.QueryRow(insertPoll, *p.TopicID, p.Question, p.Multiple, p.Closes, p.AuthorKey).Scan(&id); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return nil, err
+	}
+
+	for i := range p.Options {
+		optionID := 0
+		insertOption := `INSERT INTO poll_options (poll_id, position, label) VALUES ($1, $2, $3) RETURNING id`
+
+		if err := tx.QueryRow(insertOption, id, i, p.Options[i].Label).Scan(&optionID); err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return nil, err
+		}
+
+		p.Options[i].ID = &optionID
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	p.ID = &id
+
+	return p, nil
+}
+
+// GetPoll retrieves the poll in a topic visible to the viewer, with its
+// results and the viewer's votes, returning nil if there is none
+func (s *Storage) GetPoll(topicID int, v Viewer) (*models.Poll, error) {
+	var id int
+	p := models.Poll{ID: &id, TopicID: &topicID}
+	query := `
+		SELECT polls.id, polls.question, polls.multiple, polls.closes, polls.author_key,
+			polls.closed OR COALESCE(polls.closes <= NOW(), false),
+			(SELECT COUNT(DISTINCT voter_key) FROM poll_votes WHERE poll_votes.poll_id = polls.id)
+		FROM polls
+		WHERE polls.topic_id = $1 AND EXISTS (
+			SELECT 1 FROM messages WHERE messages.topic_id = polls.topic_id AND ` + visibleTo("$2", "$3") + `
+		)`
+
+	err := s.db.QueryRow(query, topicID, v.ReaderKey, v.Moderator).Scan(&id, &p.Question, &p.Multiple, &p.Closes, &p.AuthorKey, &p.Closed, &p.Voters)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	options := `
+		SELECT poll_options.id, poll_options.label, COUNT(poll_votes.voter_key), BOOL_OR(poll_votes.voter_key = $2)
+		FROM poll_options
+		LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+		WHERE poll_options.poll_id = $1
+		GROUP BY poll_options.id
+		ORDER BY poll_options.position ASC`
+
+	rows, err := s.db.Query(options, id, v.ReaderKey)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var optionID int
+		var chosen sql.NullBool
+		o := models.PollOption{ID: &optionID}
+
+		if err = rows.Scan(&optionID, &o.Label, &o.Votes, &chosen); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		o.Chosen = chosen.Bool && v.ReaderKey != ""
+
+		if p.Voters > 0 {
+			o.Percent = o.Votes * 100 / p.Voters
+		}
+
+		if o.Chosen {
+			p.Voted = true
+		}
+
+		p.Options = append(p.Options, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Vote records a reader's vote for options of a poll, replacing any vote
+// they made before, returning ErrPollClosed if the poll has closed. Options
+// which aren't the poll's are ignored.
+func (s *Storage) Vote(pollID int, voterKey string, optionIDs []int) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	var closed bool
+	lock := `SELECT closed OR COALESCE(closes <= NOW(), false) FROM polls WHERE id = $1 FOR UPDATE`
+
+	if err := tx.QueryRow(lock, pollID).Scan(&closed); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	if closed {
+		tx.Rollback()
+		return ErrPollClosed
+	}
+
+	clearVote := `DELETE FROM poll_votes WHERE poll_id = $1 AND voter_key = $2`
+
+	if _, err := tx.Exec(clearVote, pollID, voterKey); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	insertVotes := `
+		INSERT INTO poll_votes (poll_id, option_id, voter_key)
+		SELECT poll_id, id, $2 FROM poll_options WHERE poll_id = $1 AND id = ANY($3)`
+
+	if _, err := tx.Exec(insertVotes, pollID, voterKey, pq.Array(optionIDs)); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SetPollClosed closes or reopens a poll. Reopening a poll whose close time
+// has passed clears its close time, leaving it open until closed again.
+func (s *Storage) SetPollClosed(pollID int, closed bool) error {
+	query := `
+		UPDATE polls
+		SET closed = $2, closes = (CASE WHEN NOT $2 AND closes <= NOW() THEN NULL ELSE closes END)
+		WHERE id = $1`
+
+	if _, err := s.db.Exec(query, pollID, closed); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
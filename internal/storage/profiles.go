@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/markdown"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// GetAuthorMessages returns messages posted under the given initials and
+// theme that are visible to the viewer, newest first, with their topic
+// titles. A theme of 0 matches every theme. offset and limit select a page.
+func (s *Storage) GetAuthorMessages(initials string, theme int, limit int, offset int, v Viewer) ([]models.Message, error) {
+	messages := []models.Message{}
+	query := `
+		SELECT messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.status, messages.author_tripcode
+		FROM messages
+		INNER JOIN topics ON topics.id = messages.topic_id
+		WHERE messages.author_initials = $1 AND ($2 = 0 OR messages.author_theme = $2) AND ` + visibleTo("$3", "$4") + `
+		ORDER BY messages.posted DESC, messages.id DESC
+		LIMIT $5 OFFSET $6;`
+
+	rows, err := s.db.Query(query, initials, theme, v.ReaderKey, v.Moderator, limit, offset)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, topicID, authorTheme int
+		var title, content, authorInitials, status, tripcode string
+		var posted time.Time
+
+		if err = rows.Scan(&id, &topicID, &title, &content, &authorInitials, &authorTheme, &posted, &status, &tripcode); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		safeHTML, err := markdown.Render(content)
+
+		if err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		messages = append(messages, models.Message{
+			ID:             &id,
+			TopicID:        &topicID,
+			TopicTitle:     title,
+			Content:        safeHTML,
+			AuthorInitials: authorInitials,
+			AuthorTheme:    authorTheme,
+			Posted:         posted,
+			Status:         status,
+			AuthorTripcode: tripcode,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return messages, nil
+}
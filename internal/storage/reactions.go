@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"log"
+
+	"github.com/jkulton/topical/internal/models"
+	"github.com/lib/pq"
+)
+
+// ToggleReaction reacts to a message with an emoji on behalf of a reader.
+// Readers have one reaction per message, so reacting with another emoji
+// replaces their reaction and reacting with the same emoji again removes it.
+func (s *Storage) ToggleReaction(messageID int, reactorKey string, emoji string) error {
+	remove := `DELETE FROM message_reactions WHERE message_id = $1 AND reactor_key = $2 AND emoji = $3`
+	result, err := s.db.Exec(remove, messageID, reactorKey, emoji)
+
+	if err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		return nil
+	}
+
+	react := `
+		INSERT INTO message_reactions (message_id, reactor_key, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, reactor_key) DO UPDATE SET emoji = EXCLUDED.emoji, created = NOW()`
+
+	if _, err := s.db.Exec(react, messageID, reactorKey, emoji); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetReactions returns the reactions to each of the messages, in the order
+// they were first used on a message, noting which the reader reacted with
+func (s *Storage) GetReactions(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error) {
+	reactions := map[int][]models.Reaction{}
+
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	query := `
+		SELECT message_id, emoji, COUNT(*), BOOL_OR(reactor_key = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created) ASC, emoji ASC`
+
+	rows, err := s.db.Query(query, pq.Array(messageIDs), reactorKey)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var r models.Reaction
+
+		if err = rows.Scan(&messageID, &r.Emoji, &r.Count, &r.Reacted); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		reactions[messageID] = append(reactions[messageID], r)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return reactions, nil
+}
+
+// withReactions sets the reactions of each message, as seen by the reader
+func (s *Storage) withReactions(messages []models.Message, reactorKey string) error {
+	ids := make([]int, 0, len(messages))
+
+	for _, m := range messages {
+		ids = append(ids, *m.ID)
+	}
+
+	reactions, err := s.GetReactions(ids, reactorKey)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = reactions[*messages[i].ID]
+	}
+
+	return nil
+}
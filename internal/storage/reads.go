@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+)
+
+// GetLastRead returns the ID of the last message the reader has seen in a
+// topic, or 0 if they haven't opened it
+func (s *Storage) GetLastRead(readerKey string, topicID int) (int, error) {
+	var messageID int
+	query := `SELECT last_read_message_id FROM reads WHERE reader_key = $1 AND topic_id = $2`
+	err := s.db.QueryRow(query, readerKey, topicID).Scan(&messageID)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return 0, err
+	}
+
+	return messageID, nil
+}
+
+// MarkRead records that the reader has seen a topic up to the given
+// message. The last read message never moves backwards.
+func (s *Storage) MarkRead(readerKey string, topicID int, messageID int) error {
+	query := `
+		INSERT INTO reads (reader_key, topic_id, last_read_message_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (reader_key, topic_id) DO UPDATE
+		SET last_read_message_id = GREATEST(reads.last_read_message_id, EXCLUDED.last_read_message_id), updated = NOW()`
+
+	if _, err := s.db.Exec(query, readerKey, topicID, messageID); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
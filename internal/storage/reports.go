@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/markdown"
+	"github.com/jkulton/topical/internal/models"
+)
+
+// ErrDuplicateReport is returned when a session reports the same message twice
+var ErrDuplicateReport = errors.New("message already reported by this session")
+
+// CreateReport inserts a report into the DB, returning ErrDuplicateReport if
+// the reporting session has already reported the message
+func (s *Storage) CreateReport(r *models.Report) (*models.Report, error) {
+	id := 0
+	query := `
+		INSERT INTO reports (message_id, reason, details, session_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, session_id) DO NOTHING
+		RETURNING id`
+	err := s.db.QueryRow(query, *r.MessageID, r.Reason, r.Details, r.SessionID).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrDuplicateReport
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	r.ID = &id
+
+	return r, nil
+}
+
+// GetOpenReports returns all reports awaiting moderator review along with
+// the reported message, oldest first
+func (s *Storage) GetOpenReports() ([]models.Report, error) {
+	reports := []models.Report{}
+	query := `
+		SELECT reports.id, reports.reason, reports.details, reports.created,
+			messages.id, messages.topic_id, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.hidden
+		FROM reports
+		INNER JOIN messages ON messages.id = reports.message_id
+		WHERE reports.status = 'open'
+		ORDER BY reports.created ASC;`
+
+	rows, err := s.db.Query(query)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var reportID, messageID, topicID, authorTheme int
+		var reason, details, content, authorInitials string
+		var created, posted time.Time
+		var hidden bool
+
+		err = rows.Scan(&reportID, &reason, &details, &created, &messageID, &topicID, &content, &authorInitials, &authorTheme, &posted, &hidden)
+
+		if err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		safeHTML, err := markdown.Render(content)
+
+		if err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		reports = append(reports, models.Report{
+			ID:        &reportID,
+			MessageID: &messageID,
+			Reason:    reason,
+			Details:   details,
+			Status:    "open",
+			Created:   created,
+			Message: &models.Message{
+				ID:             &messageID,
+				TopicID:        &topicID,
+				Content:        safeHTML,
+				AuthorInitials: authorInitials,
+				AuthorTheme:    authorTheme,
+				Posted:         posted,
+				Hidden:         hidden,
+			},
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// ResolveReport closes a report with the given status. When hideMessage is true
+// the reported message is hidden and every open report against it is resolved.
+func (s *Storage) ResolveReport(id int, status string, hideMessage bool) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE reports SET status = $1 WHERE id = $2`, status, id); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	if hideMessage {
+		hide := `UPDATE messages SET hidden = true WHERE id = (SELECT message_id FROM reports WHERE id = $1)`
+
+		if _, err := tx.Exec(hide, id); err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return err
+		}
+
+		resolve := `
+			UPDATE reports SET status = 'resolved'
+			WHERE status = 'open' AND message_id = (SELECT message_id FROM reports WHERE id = $1)`
+
+		if _, err := tx.Exec(resolve, id); err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ApproveReport unhides the reported message, for instance one held by the
+// content filter, resolves every open report against it, and notifies
+// subscribers to its topic and the authors it mentions
+func (s *Storage) ApproveReport(id int) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	var messageID int
+	unhide := `UPDATE messages SET hidden = false WHERE id = (SELECT message_id FROM reports WHERE id = $1) RETURNING id`
+
+	if err := tx.QueryRow(unhide, id).Scan(&messageID); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	resolve := `
+		UPDATE reports SET status = 'resolved'
+		WHERE status = 'open' AND message_id = (SELECT message_id FROM reports WHERE id = $1)`
+
+	if _, err := tx.Exec(resolve, id); err != nil {
+		log.Print(err.Error())
+		tx.Rollback()
+		return err
+	}
+
+	if err := notify(tx, messageID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
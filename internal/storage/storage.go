@@ -1,27 +1,91 @@
 package storage
 
 import (
-	"bytes"
 	"database/sql"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/jkulton/topical/internal/markdown"
 	"github.com/jkulton/topical/internal/models"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/yuin/goldmark"
 )
 
+// ErrMessageNotFound is returned when no message visible to a viewer has an ID
+var ErrMessageNotFound = errors.New("message not found")
+
 // Storage is an interface for interacting with a storage layer
 type Storage struct {
 	db *sql.DB
 }
 
+// Viewer describes who is reading topics, deciding which pending messages
+// they may see. Pending messages are visible to their author and moderators.
+// ReaderKey identifies the reader by their author key, for pending
+// messages, unread counts and reactions, and is empty for visitors who
+// haven't joined.
+type Viewer struct {
+	Moderator bool
+	ReaderKey string
+}
+
 // TopicalStore implements an CRUD action interface for topics/messages
 type TopicalStore interface {
-	GetTopic(id int) (*models.Topic, error)
-	GetRecentTopics() ([]models.Topic, error)
+	GetTopic(id int, v Viewer) (*models.Topic, error)
+	GetMessage(id int, v Viewer) (*models.Message, error)
+	GetRecentTopics(v Viewer) ([]models.Topic, error)
 	CreateMessage(m *models.Message) (*models.Message, error)
 	CreateTopic(title string) (*models.Topic, error)
+	CreateReport(r *models.Report) (*models.Report, error)
+	GetOpenReports() ([]models.Report, error)
+	ResolveReport(id int, status string, hideMessage bool) error
+	ApproveReport(id int) error
+	HasApprovedMessage(authorKey string) (bool, error)
+	GetPendingMessages() ([]models.Message, error)
+	SetMessageStatus(id int, status string) error
+	CreateUser(u *models.User, passwordHash string) (*models.User, error)
+	GetUser(id int) (*models.User, error)
+	GetUserCredentials(handle string) (*models.User, string, error)
+	GetOrCreateExternalUser(externalID string, u *models.User) (*models.User, error)
+	GetAuthorMessages(initials string, theme int, limit int, offset int, v Viewer) ([]models.Message, error)
+	GetMessagesByAuthorKey(authorKey string) ([]models.Message, error)
+	CountMessagesByAuthorKey(authorKey string) (int, error)
+	EraseMessagesByAuthorKey(authorKey string, anonymize bool) (int, error)
+	GetLastRead(readerKey string, topicID int) (int, error)
+	MarkRead(readerKey string, topicID int, messageID int) error
+	Subscribe(subscriberKey string, topicID int) error
+	Unsubscribe(subscriberKey string, topicID int) error
+	IsSubscribed(subscriberKey string, topicID int) (bool, error)
+	GetNotifications(recipientKey string, limit int) ([]models.Notification, error)
+	CountUnreadNotifications(recipientKey string) (int, error)
+	MarkNotificationsRead(recipientKey string) error
+	SaveDigest(d *models.Digest) (*models.Digest, error)
+	GetDigest(recipientKey string) (*models.Digest, error)
+	ClaimDigestConfirmation(recipientKey string, interval time.Duration) (bool, error)
+	ConfirmDigest(recipientKey string, email string) (bool, error)
+	DeleteDigest(recipientKey string) error
+	GetConfirmedDigestsByEmail(email string) ([]models.Digest, error)
+	GetLatestAuthorMessage(authorKey string) (*models.Message, error)
+	CreateWebhook(w *models.Webhook) (*models.Webhook, error)
+	GetWebhooks() ([]models.Webhook, error)
+	DeleteWebhook(id int) error
+	GetWebhookDeliveries(limit int) ([]models.WebhookDelivery, error)
+	RetryWebhookDelivery(id int) error
+	ToggleReaction(messageID int, reactorKey string, emoji string) error
+	GetReactions(messageIDs []int, reactorKey string) (map[int][]models.Reaction, error)
+	CreatePoll(p *models.Poll) (*models.Poll, error)
+	GetPoll(topicID int, v Viewer) (*models.Poll, error)
+	Vote(pollID int, voterKey string, optionIDs []int) error
+	SetPollClosed(pollID int, closed bool) error
+}
+
+// visibleTo is a SQL condition matching messages a Viewer may see, given
+// placeholders for the viewer's author key and moderator status. Messages
+// without an author key, like anonymized ones, are never the viewer's own.
+func visibleTo(keyParam string, moderatorParam string) string {
+	return `messages.hidden = false AND (
+		messages.status = 'approved' OR
+		(messages.status = 'pending' AND (` + moderatorParam + ` OR (messages.author_key <> '' AND messages.author_key = ` + keyParam + `)))
+	)`
 }
 
 // New returns a new TopicalStore
@@ -29,18 +93,20 @@ func New(db *sql.DB) *Storage {
 	return &Storage{db}
 }
 
-// GetTopic retrieves a topic from DB by topic
-func (s *Storage) GetTopic(id int) (*models.Topic, error) {
+// GetTopic retrieves a topic from DB by topic, with the messages visible to the viewer
+func (s *Storage) GetTopic(id int, v Viewer) (*models.Topic, error) {
 	topic := models.Topic{}
 	messages := []models.Message{}
 	query := `
-		SELECT topics.id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.id
+		SELECT topics.id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.id, messages.status, messages.author_tripcode,
+			messages.reply_to_message_id, COALESCE(replied.author_initials, '')
 		FROM topics
 		INNER JOIN messages ON messages.topic_id = topics.id
-		WHERE topics.id = $1
+		LEFT JOIN messages replied ON replied.id = messages.reply_to_message_id
+		WHERE topics.id = $1 AND ` + visibleTo("$2", "$3") + `
 		ORDER BY posted ASC;`
 
-	rows, err := s.db.Query(query, id)
+	rows, err := s.db.Query(query, id, v.ReaderKey, v.Moderator)
 
 	if err != nil {
 		log.Fatal(err)
@@ -51,11 +117,11 @@ func (s *Storage) GetTopic(id int) (*models.Topic, error) {
 
 	for rows.Next() {
 		var topicID, authorTheme, messageID int
-		var title, content, authorInitials string
+		var title, content, authorInitials, status, tripcode, replyToInitials string
+		var replyToID sql.NullInt64
 		var posted time.Time
-		var unsafeHTML bytes.Buffer
 
-		if err = rows.Scan(&topicID, &title, &content, &authorInitials, &authorTheme, &posted, &messageID); err != nil {
+		if err = rows.Scan(&topicID, &title, &content, &authorInitials, &authorTheme, &posted, &messageID, &status, &tripcode, &replyToID, &replyToInitials); err != nil {
 			log.Fatal(err)
 			return nil, err
 		}
@@ -63,19 +129,28 @@ func (s *Storage) GetTopic(id int) (*models.Topic, error) {
 		topic.ID = &topicID
 		topic.Title = title
 
-		if err := goldmark.Convert([]byte(content), &unsafeHTML); err != nil {
+		safeHTML, err := markdown.Render(content)
+
+		if err != nil {
 			log.Print(err.Error())
 			return nil, err
 		}
-		safeHTML := bluemonday.UGCPolicy().SanitizeBytes(unsafeHTML.Bytes())
 
 		messages = append(messages, models.Message{
 			ID:             &messageID,
-			Content:        string(safeHTML),
+			Content:        safeHTML,
 			AuthorInitials: authorInitials,
 			Posted:         posted,
 			AuthorTheme:    authorTheme,
+			Status:         status,
+			AuthorTripcode: tripcode,
 		})
+
+		if replyToID.Valid {
+			id := int(replyToID.Int64)
+			messages[len(messages)-1].ReplyToID = &id
+			messages[len(messages)-1].ReplyToInitials = replyToInitials
+		}
 	}
 
 	if err = rows.Err(); err != nil {
@@ -83,26 +158,77 @@ func (s *Storage) GetTopic(id int) (*models.Topic, error) {
 		return nil, err
 	}
 
+	// Replies only link to messages the viewer can see
+	shown := map[int]bool{}
+
+	for i := range messages {
+		shown[*messages[i].ID] = true
+
+		if messages[i].ReplyToID != nil && !shown[*messages[i].ReplyToID] {
+			messages[i].ReplyToID = nil
+			messages[i].ReplyToInitials = ""
+		}
+	}
+
+	if err := s.withReactions(messages, v.ReaderKey); err != nil {
+		return nil, err
+	}
+
 	topic.Messages = &messages
 
 	return &topic, nil
 }
 
+// GetMessage retrieves a message visible to the viewer with its content as
+// its author wrote it, returning ErrMessageNotFound if there is none
+func (s *Storage) GetMessage(id int, v Viewer) (*models.Message, error) {
+	m := models.Message{}
+	var messageID, topicID int
+	query := `
+		SELECT messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials, messages.author_theme, messages.posted, messages.status
+		FROM messages
+		INNER JOIN topics ON topics.id = messages.topic_id
+		WHERE messages.id = $1 AND ` + visibleTo("$2", "$3")
+	err := s.db.QueryRow(query, id, v.ReaderKey, v.Moderator).Scan(&messageID, &topicID, &m.TopicTitle, &m.Content, &m.AuthorInitials, &m.AuthorTheme, &m.Posted, &m.Status)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	m.ID = &messageID
+	m.TopicID = &topicID
+
+	return &m, nil
+}
+
 // GetRecentTopics returns a list of the 50 most recently posted-on topics
-func (s *Storage) GetRecentTopics() ([]models.Topic, error) {
+// visible to the viewer, counting only the messages they may see and how
+// many of those they haven't read
+func (s *Storage) GetRecentTopics(v Viewer) ([]models.Topic, error) {
 	topics := []models.Topic{}
+	visible := visibleTo("$1", "$2")
 	query := `
 		SELECT DISTINCT topics.id, topics.title,
-			(SELECT COUNT(messages.id) FROM messages WHERE topic_id = topics.id) AS "message_count",
-			(SELECT author_initials FROM messages WHERE topic_id = topics.id ORDER BY posted ASC LIMIT 1) AS "author_initials",
-			(SELECT author_theme FROM messages WHERE topic_id = topics.id ORDER BY posted ASC LIMIT 1) AS "author_theme",
-			(SELECT posted FROM messages WHERE topic_id = topics.id ORDER BY posted DESC LIMIT 1) AS "last_message"
+			(SELECT COUNT(messages.id) FROM messages WHERE topic_id = topics.id AND ` + visible + `) AS "message_count",
+			(SELECT author_initials FROM messages WHERE topic_id = topics.id AND ` + visible + ` ORDER BY posted ASC LIMIT 1) AS "author_initials",
+			(SELECT author_theme FROM messages WHERE topic_id = topics.id AND ` + visible + ` ORDER BY posted ASC LIMIT 1) AS "author_theme",
+			(SELECT posted FROM messages WHERE topic_id = topics.id AND ` + visible + ` ORDER BY posted DESC LIMIT 1) AS "last_message",
+			(CASE WHEN $3 = '' THEN 0 ELSE (
+				SELECT COUNT(messages.id) FROM messages
+				WHERE topic_id = topics.id AND ` + visible + ` AND messages.id > COALESCE(
+					(SELECT last_read_message_id FROM reads WHERE reads.reader_key = $3 AND reads.topic_id = topics.id), 0)
+			) END) AS "unread_count"
 		FROM topics
 		INNER JOIN messages
-		ON topics.id = messages.topic_id
+		ON topics.id = messages.topic_id AND ` + visible + `
 		ORDER BY last_message DESC
 		LIMIT 50;`
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, v.ReaderKey, v.Moderator, v.ReaderKey)
 
 	if err != nil {
 		log.Fatal(err)
@@ -112,9 +238,9 @@ func (s *Storage) GetRecentTopics() ([]models.Topic, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var id, messageCount int
+		var id, messageCount, unreadCount int
 		var title, authorInitials, authorTheme, posted string
-		err = rows.Scan(&id, &title, &messageCount, &authorInitials, &authorTheme, &posted)
+		err = rows.Scan(&id, &title, &messageCount, &authorInitials, &authorTheme, &posted, &unreadCount)
 		if err != nil {
 			log.Fatal(err)
 			return nil, err
@@ -126,6 +252,7 @@ func (s *Storage) GetRecentTopics() ([]models.Topic, error) {
 			MessageCount:   &messageCount,
 			AuthorInitials: &authorInitials,
 			AuthorTheme:    &authorTheme,
+			UnreadCount:    unreadCount,
 		})
 	}
 
@@ -137,16 +264,54 @@ func (s *Storage) GetRecentTopics() ([]models.Topic, error) {
 	return topics, nil
 }
 
-// CreateMessage inserts a message into the DB
+// CreateMessage inserts a message into the DB with the mentions in it,
+// setting its ID and posted time, and notifies subscribers to its topic and
+// the authors it mentions
 func (s *Storage) CreateMessage(m *models.Message) (*models.Message, error) {
-	sql := `INSERT INTO messages (topic_id, content, author_initials, author_theme) VALUES ($1, $2, $3, $4)`
-	_, err := s.db.Exec(sql, *m.TopicID, m.Content, m.AuthorInitials, m.AuthorTheme)
+	id := 0
+	if m.Status == "" {
+		m.Status = "approved"
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	sql := `
+		INSERT INTO messages (topic_id, content, author_initials, author_theme, hidden, status, user_id, author_tripcode, author_key, reply_to_message_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, posted`
+	err = tx.QueryRow(sql, *m.TopicID, m.Content, m.AuthorInitials, m.AuthorTheme, m.Hidden, m.Status, m.UserID, m.AuthorTripcode, m.AuthorKey, m.ReplyToID).Scan(&id, &m.Posted)
 
 	if err != nil {
 		log.Print(err.Error())
+		tx.Rollback()
 		return nil, err
 	}
 
+	for _, mention := range markdown.Mentions(m.Content) {
+		insertMention := `INSERT INTO mentions (message_id, initials, theme) VALUES ($1, $2, $3)`
+
+		if _, err := tx.Exec(insertMention, id, mention.Initials, mention.Theme); err != nil {
+			log.Print(err.Error())
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	m.ID = &id
+
+	// The message is saved either way, so failing to notify is only logged
+	notify(s.db, id)
+
 	return m, nil
 }
 
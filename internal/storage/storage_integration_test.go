@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jkulton/topical/internal/models"
 	_ "github.com/lib/pq" // Postgres driver
@@ -81,10 +82,10 @@ func TestCreateMessageIntegration(t *testing.T) {
 		content := "Test Message"
 		store := New(th.DB)
 
-		topics, _ := store.GetRecentTopics()
+		topics, _ := store.GetRecentTopics(Viewer{})
 		topicID := topics[0].ID
 		message, _ := store.CreateMessage(&models.Message{TopicID: topicID, Content: content, AuthorInitials: "JK", AuthorTheme: 1})
-		topic, _ := store.GetTopic(*message.TopicID)
+		topic, _ := store.GetTopic(*message.TopicID, Viewer{})
 		lastMessageInTopic := (*topic.Messages)[len(*topic.Messages)-1]
 
 		if strings.Contains(lastMessageInTopic.Content, content) == false {
@@ -95,17 +96,34 @@ func TestCreateMessageIntegration(t *testing.T) {
 	})
 }
 
+func TestTripcodeIntegration(t *testing.T) {
+	t.Run("returns message tripcodes with topics", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Tripcodes")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "hi", AuthorInitials: "JK", AuthorTheme: 1, AuthorTripcode: "ABCDEFGH"})
+
+		topic, _ = store.GetTopic(*topic.ID, Viewer{})
+
+		if (*topic.Messages)[0].AuthorTripcode != "ABCDEFGH" {
+			t.Error("expected tripcode to be stored with the message")
+		}
+
+		testTeardown(th)
+	})
+}
+
 func TestGetTopicIntegration(t *testing.T) {
 	t.Run("returns existing topic", func(t *testing.T) {
 		th := testSetup()
 
 		store := New(th.DB)
-		topics, _ := store.GetRecentTopics()
+		topics, _ := store.GetRecentTopics(Viewer{})
 
 		firstTopic := topics[0]
 		topicID := firstTopic.ID
 
-		topic, _ := store.GetTopic(*topicID)
+		topic, _ := store.GetTopic(*topicID, Viewer{})
 
 		if topic.Title != firstTopic.Title {
 			t.Error("expected topic not returned")
@@ -119,7 +137,7 @@ func TestGetRecentTopicsIntegration(t *testing.T) {
 	t.Run("returns list of recent topics", func(t *testing.T) {
 		th := testSetup()
 
-		topics, _ := New(th.DB).GetRecentTopics()
+		topics, _ := New(th.DB).GetRecentTopics(Viewer{})
 
 		if len(topics) != 3 {
 			t.Error("expected three recent topics")
@@ -138,7 +156,7 @@ func TestCreateTopicIntegration(t *testing.T) {
 		topic, _ := store.CreateTopic(title)
 		topicID := topic.ID
 		store.CreateMessage(&models.Message{TopicID: topicID, Content: "new message", AuthorInitials: "JK", AuthorTheme: 1})
-		recentTopics, _ := store.GetRecentTopics()
+		recentTopics, _ := store.GetRecentTopics(Viewer{})
 		firstTopic := recentTopics[0]
 
 		if firstTopic.Title != title {
@@ -146,3 +164,671 @@ func TestCreateTopicIntegration(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateReportIntegration(t *testing.T) {
+	t.Run("rejects a second report of a message from the same session", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		messageID := 1
+
+		store.CreateReport(&models.Report{MessageID: &messageID, Reason: "spam", SessionID: "abc"})
+		_, err := store.CreateReport(&models.Report{MessageID: &messageID, Reason: "other", SessionID: "abc"})
+
+		if err != ErrDuplicateReport {
+			t.Error("expected duplicate report error")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestResolveReportIntegration(t *testing.T) {
+	t.Run("hides reported message and closes its reports", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topics, _ := store.GetRecentTopics(Viewer{})
+		topic, _ := store.GetTopic(*topics[0].ID, Viewer{})
+		reported := (*topic.Messages)[0]
+
+		report, _ := store.CreateReport(&models.Report{MessageID: reported.ID, Reason: "spam", SessionID: "abc"})
+		store.CreateReport(&models.Report{MessageID: reported.ID, Reason: "harassment", SessionID: "def"})
+		store.ResolveReport(*report.ID, "resolved", true)
+
+		topic, _ = store.GetTopic(*topics[0].ID, Viewer{})
+		openReports, _ := store.GetOpenReports()
+
+		for _, m := range *topic.Messages {
+			if *m.ID == *reported.ID {
+				t.Error("expected hidden message to be excluded from topic")
+			}
+		}
+
+		if len(openReports) != 0 {
+			t.Error("expected all reports on hidden message to be resolved")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestPendingMessagesIntegration(t *testing.T) {
+	t.Run("shows pending messages only to their author and moderators", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Pending topic")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first post", AuthorInitials: "JK", AuthorTheme: 1, Status: "pending", AuthorKey: "abc"})
+
+		if topic, _ := store.GetTopic(*topic.ID, Viewer{ReaderKey: "def"}); topic.ID != nil {
+			t.Error("expected pending topic to be hidden from other readers")
+		}
+
+		if topic, _ := store.GetTopic(*topic.ID, Viewer{ReaderKey: "abc"}); topic.ID == nil {
+			t.Error("expected pending topic to be visible to its author")
+		}
+
+		if topic, _ := store.GetTopic(*topic.ID, Viewer{Moderator: true}); topic.ID == nil {
+			t.Error("expected pending topic to be visible to moderators")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("approving a message marks its author as approved", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Pending topic")
+		message, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first post", AuthorInitials: "JK", AuthorTheme: 1, Status: "pending", AuthorKey: "abc"})
+
+		before, _ := store.HasApprovedMessage("abc")
+		store.SetMessageStatus(*message.ID, "approved")
+		after, _ := store.HasApprovedMessage("abc")
+
+		if before || !after {
+			t.Error("expected author to be approved only after approval")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestUsersIntegration(t *testing.T) {
+	t.Run("creates a user and looks it up by ID and handle", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		user, _ := store.CreateUser(&models.User{Handle: "Jon", Initials: "JK", Theme: 3}, "hash")
+
+		if found, _ := store.GetUser(*user.ID); found.Handle != "Jon" {
+			t.Error("expected to find user by ID")
+		}
+
+		found, hash, _ := store.GetUserCredentials("jon")
+
+		if *found.ID != *user.ID || hash != "hash" {
+			t.Error("expected to find user credentials by case-insensitive handle")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("refuses duplicate handles", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		store.CreateUser(&models.User{Handle: "Jon", Initials: "JK", Theme: 3}, "hash")
+
+		if _, err := store.CreateUser(&models.User{Handle: "JON", Initials: "JK", Theme: 3}, "hash"); err != ErrHandleTaken {
+			t.Errorf("got %v but wanted %v", err, ErrHandleTaken)
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("returns ErrUserNotFound for unknown users", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+
+		if _, err := store.GetUser(999); err != ErrUserNotFound {
+			t.Errorf("got %v but wanted %v", err, ErrUserNotFound)
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestExternalUsersIntegration(t *testing.T) {
+	t.Run("creates an account once per external ID, avoiding taken handles", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		store.CreateUser(&models.User{Handle: "jane", Initials: "JD", Theme: 3}, "hash")
+
+		first, _ := store.GetOrCreateExternalUser("https://id.test|1", &models.User{Handle: "jane", Initials: "JD", Theme: 2})
+		second, _ := store.GetOrCreateExternalUser("https://id.test|1", &models.User{Handle: "jane", Initials: "JD", Theme: 2})
+
+		if first.Handle != "jane2" {
+			t.Errorf("got handle %s but wanted jane2", first.Handle)
+		}
+
+		if *first.ID != *second.ID {
+			t.Error("expected the same account for the same external ID")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestGetAuthorMessagesIntegration(t *testing.T) {
+	t.Run("returns an author's visible messages newest first, a page at a time", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Profiles")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first", AuthorInitials: "ZZ", AuthorTheme: 2})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "second", AuthorInitials: "ZZ", AuthorTheme: 2})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "other theme", AuthorInitials: "ZZ", AuthorTheme: 3})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "hidden", AuthorInitials: "ZZ", AuthorTheme: 2, Hidden: true})
+
+		page, _ := store.GetAuthorMessages("ZZ", 2, 1, 0, Viewer{})
+
+		if len(page) != 1 || !strings.Contains(page[0].Content, "second") || page[0].TopicTitle != "Profiles" {
+			t.Errorf("unexpected first page %+v", page)
+		}
+
+		page, _ = store.GetAuthorMessages("ZZ", 2, 10, 1, Viewer{})
+
+		if len(page) != 1 || !strings.Contains(page[0].Content, "first") {
+			t.Errorf("unexpected second page %+v", page)
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestAuthorDataIntegration(t *testing.T) {
+	t.Run("exports every message stored with an author key", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Export")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "**mine**", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "abc"})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "held", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "abc", Hidden: true})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "theirs", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "def"})
+
+		messages, _ := store.GetMessagesByAuthorKey("abc")
+
+		if len(messages) != 2 || messages[0].Content != "**mine**" || messages[0].TopicTitle != "Export" {
+			t.Errorf("unexpected export %+v", messages)
+		}
+
+		if count, _ := store.CountMessagesByAuthorKey("abc"); count != 2 {
+			t.Errorf("got count %d but wanted 2", count)
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("anonymizes messages, keeping their content", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Anonymize")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "mine", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "abc", AuthorTripcode: "ABCDEFGH"})
+
+		count, _ := store.EraseMessagesByAuthorKey("abc", true)
+		topic, _ = store.GetTopic(*topic.ID, Viewer{})
+		message := (*topic.Messages)[0]
+
+		if count != 1 || message.AuthorInitials != "XX" || message.AuthorTripcode != "" {
+			t.Errorf("unexpected anonymized message %+v", message)
+		}
+
+		if messages, _ := store.GetMessagesByAuthorKey("abc"); len(messages) != 0 {
+			t.Error("expected anonymized messages to no longer match the author key")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("deletes messages and their reports, and topics left empty", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Delete")
+		message, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "mine", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "abc"})
+		store.CreateReport(&models.Report{MessageID: message.ID, Reason: "spam", SessionID: "def"})
+
+		count, err := store.EraseMessagesByAuthorKey("abc", false)
+
+		if err != nil || count != 1 {
+			t.Errorf("got %d, %v but wanted 1 deleted message", count, err)
+		}
+
+		if topic, _ := store.GetTopic(*topic.ID, Viewer{}); topic.ID != nil {
+			t.Error("expected empty topic to be deleted")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestReadsIntegration(t *testing.T) {
+	t.Run("counts messages posted since the reader last read a topic", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Unread")
+		first, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first", AuthorInitials: "JK", AuthorTheme: 1})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "second", AuthorInitials: "JK", AuthorTheme: 1})
+
+		store.MarkRead("abc", *topic.ID, *first.ID)
+		store.MarkRead("abc", *topic.ID, 0)
+		topics, _ := store.GetRecentTopics(Viewer{ReaderKey: "abc"})
+
+		if topics[0].UnreadCount != 1 {
+			t.Errorf("got %d unread messages but wanted 1", topics[0].UnreadCount)
+		}
+
+		if lastRead, _ := store.GetLastRead("abc", *topic.ID); lastRead != *first.ID {
+			t.Errorf("got last read %d but wanted %d", lastRead, *first.ID)
+		}
+
+		if topics, _ := store.GetRecentTopics(Viewer{}); topics[0].UnreadCount != 0 {
+			t.Error("expected no unread counts for visitors without a reader key")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestNotificationsIntegration(t *testing.T) {
+	t.Run("notifies subscribers other than the author of visible replies", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Watched")
+		store.Subscribe("abc", *topic.ID)
+		store.Subscribe("def", *topic.ID)
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "reply", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "def"})
+		pending, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "pending", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "def", Status: "pending"})
+
+		if count, _ := store.CountUnreadNotifications("abc"); count != 1 {
+			t.Errorf("got %d notifications but wanted 1", count)
+		}
+
+		if count, _ := store.CountUnreadNotifications("def"); count != 0 {
+			t.Error("expected authors not to be notified of their own messages")
+		}
+
+		store.SetMessageStatus(*pending.ID, "approved")
+		notifications, _ := store.GetNotifications("abc", 10)
+
+		if len(notifications) != 2 || notifications[0].Message.TopicTitle != "Watched" {
+			t.Errorf("unexpected notifications %+v", notifications)
+		}
+
+		store.MarkNotificationsRead("abc")
+
+		if count, _ := store.CountUnreadNotifications("abc"); count != 0 {
+			t.Error("expected notifications to be read")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("stops notifying after unsubscribing", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Unwatched")
+		store.Subscribe("abc", *topic.ID)
+		store.Unsubscribe("abc", *topic.ID)
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "reply", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "def"})
+
+		if subscribed, _ := store.IsSubscribed("abc", *topic.ID); subscribed {
+			t.Error("expected subscription to be removed")
+		}
+
+		if count, _ := store.CountUnreadNotifications("abc"); count != 0 {
+			t.Error("expected no notifications")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestMentionsIntegration(t *testing.T) {
+	t.Run("notifies mentioned authors, even those new to the topic", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		elsewhere, _ := store.CreateTopic("Elsewhere")
+		topic, _ := store.CreateTopic("Mentions")
+		store.CreateMessage(&models.Message{TopicID: elsewhere.ID, Content: "hello", AuthorInitials: "AK", AuthorTheme: 3, AuthorKey: "abc"})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "hi", AuthorInitials: "AK", AuthorTheme: 5, AuthorKey: "def"})
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "thanks @AK-3, not `@AK`", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "ghi"})
+
+		notifications, _ := store.GetNotifications("abc", 10)
+
+		if len(notifications) != 1 || notifications[0].Kind != "mention" {
+			t.Errorf("unexpected notifications %+v", notifications)
+		}
+
+		if count, _ := store.CountUnreadNotifications("def"); count != 0 {
+			t.Error("expected authors with another theme not to be notified")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestRepliesIntegration(t *testing.T) {
+	t.Run("links replies to visible messages they refer to", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Quoted")
+		first, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first **post**", AuthorInitials: "JK", AuthorTheme: 1})
+		pending, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "pending", AuthorInitials: "AK", AuthorTheme: 1, Status: "pending", AuthorKey: "abc"})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "agreed", AuthorInitials: "BC", AuthorTheme: 1, ReplyToID: first.ID})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "me too", AuthorInitials: "BC", AuthorTheme: 1, ReplyToID: pending.ID})
+
+		if m, _ := store.GetMessage(*first.ID, Viewer{}); m == nil || m.Content != "first **post**" {
+			t.Errorf("unexpected message %+v", m)
+		}
+
+		if _, err := store.GetMessage(*pending.ID, Viewer{ReaderKey: "def"}); err != ErrMessageNotFound {
+			t.Errorf("got %v but wanted ErrMessageNotFound", err)
+		}
+
+		topic, _ = store.GetTopic(*topic.ID, Viewer{})
+		messages := *topic.Messages
+
+		if len(messages) != 3 || messages[1].ReplyToID == nil || *messages[1].ReplyToID != *first.ID || messages[1].ReplyToInitials != "JK" {
+			t.Errorf("unexpected messages %+v", messages)
+		}
+
+		if messages[2].ReplyToID != nil {
+			t.Error("expected replies to hidden messages not to link to them")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestDigestsIntegration(t *testing.T) {
+	t.Run("requires confirming the email again when it changes", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+
+		d, _ := store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "jk@example.com", Frequency: "daily"})
+
+		if d.Confirmed {
+			t.Error("expected new digests to be unconfirmed")
+		}
+
+		if confirmed, _ := store.ConfirmDigest("abc", "other@example.com"); confirmed {
+			t.Error("expected another email not to confirm")
+		}
+
+		if confirmed, _ := store.ConfirmDigest("abc", "jk@example.com"); !confirmed {
+			t.Error("expected digest to be confirmed")
+		}
+
+		d, _ = store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "jk@example.com", Frequency: "weekly"})
+
+		if !d.Confirmed {
+			t.Error("expected changing frequency to keep the digest confirmed")
+		}
+
+		d, _ = store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "new@example.com", Frequency: "weekly"})
+
+		if d.Confirmed {
+			t.Error("expected changing email to require confirmation")
+		}
+
+		store.DeleteDigest("abc")
+
+		if d, _ := store.GetDigest("abc"); d != nil {
+			t.Error("expected digest to be deleted")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("throttles confirmations per recipient and address", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "jk@example.com", Frequency: "daily"})
+		store.SaveDigest(&models.Digest{RecipientKey: "def", Email: "JK@example.com", Frequency: "daily"})
+		store.SaveDigest(&models.Digest{RecipientKey: "ghi", Email: "ak@example.com", Frequency: "daily"})
+
+		if claimed, _ := store.ClaimDigestConfirmation("abc", time.Minute); !claimed {
+			t.Error("expected the first confirmation to be sent")
+		}
+
+		if claimed, _ := store.ClaimDigestConfirmation("abc", time.Minute); claimed {
+			t.Error("expected a second confirmation to the recipient to wait")
+		}
+
+		if claimed, _ := store.ClaimDigestConfirmation("def", time.Minute); claimed {
+			t.Error("expected a second confirmation to the address to wait")
+		}
+
+		if claimed, _ := store.ClaimDigestConfirmation("ghi", time.Minute); !claimed {
+			t.Error("expected other addresses to be confirmed")
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("finds due digests and their activity", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Digested")
+		store.Subscribe("abc", *topic.ID)
+		store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "jk@example.com", Frequency: "daily"})
+		store.SaveDigest(&models.Digest{RecipientKey: "def", Email: "ak@example.com", Frequency: "daily"})
+		store.ConfirmDigest("abc", "jk@example.com")
+		th.DB.Exec(`UPDATE digests SET last_sent = NOW() - interval '2 days'`)
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "reply", AuthorInitials: "AK", AuthorTheme: 1, AuthorKey: "def"})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "own", AuthorInitials: "JK", AuthorTheme: 1, AuthorKey: "abc"})
+
+		due, _ := store.GetDueDigests()
+
+		if len(due) != 1 || due[0].RecipientKey != "abc" {
+			t.Fatalf("expected only the confirmed digest to be due, got %+v", due)
+		}
+
+		activity, until, _ := store.GetDigestActivity("abc", due[0].LastSent)
+
+		if len(activity) != 1 || activity[0].Content != "reply" || activity[0].TopicTitle != "Digested" {
+			t.Errorf("unexpected activity %+v", activity)
+		}
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "meanwhile", AuthorInitials: "AK", AuthorTheme: 1, AuthorKey: "def"})
+		store.MarkDigestSent("abc", until)
+
+		if due, _ := store.GetDueDigests(); len(due) != 0 {
+			t.Error("expected no digests due after sending")
+		}
+
+		if activity, _, _ := store.GetDigestActivity("abc", until); len(activity) != 1 || activity[0].Content != "meanwhile" {
+			t.Errorf("expected messages posted while sending to be in the next digest, got %+v", activity)
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestReplyByEmailIntegration(t *testing.T) {
+	t.Run("finds confirmed digests by email and the author's latest identity", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Replies")
+		store.SaveDigest(&models.Digest{RecipientKey: "abc", Email: "JK@example.com", Frequency: "daily"})
+		store.SaveDigest(&models.Digest{RecipientKey: "def", Email: "jk@example.com", Frequency: "daily"})
+		store.ConfirmDigest("abc", "JK@example.com")
+
+		digests, _ := store.GetConfirmedDigestsByEmail("jk@example.com")
+
+		if len(digests) != 1 || digests[0].RecipientKey != "abc" {
+			t.Errorf("expected only the confirmed digest, got %+v", digests)
+		}
+
+		if _, err := store.GetLatestAuthorMessage("abc"); err != ErrAuthorNotFound {
+			t.Errorf("got error %v but wanted ErrAuthorNotFound", err)
+		}
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first", AuthorInitials: "AK", AuthorTheme: 1, AuthorKey: "abc"})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "second", AuthorInitials: "JK", AuthorTheme: 2, AuthorKey: "abc", AuthorTripcode: "TRIP"})
+
+		latest, _ := store.GetLatestAuthorMessage("abc")
+
+		if latest == nil || latest.AuthorInitials != "JK" || latest.AuthorTheme != 2 || latest.AuthorTripcode != "TRIP" || latest.UserID != nil {
+			t.Errorf("unexpected latest message %+v", latest)
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestWebhooksIntegration(t *testing.T) {
+	t.Run("queues deliveries of visible messages to every webhook", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		store.CreateWebhook(&models.Webhook{URL: "https://example.com/hook", Secret: "s3cret"})
+		topic, _ := store.CreateTopic("Hooked")
+
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first post", AuthorInitials: "JK", AuthorTheme: 1})
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "reply", AuthorInitials: "JK", AuthorTheme: 1})
+		pending, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "pending", AuthorInitials: "JK", AuthorTheme: 1, Status: "pending"})
+
+		due, _ := store.GetDueWebhookDeliveries(10)
+
+		if len(due) != 2 || due[0].Event != "topic.created" || due[1].Event != "message.created" {
+			t.Fatalf("unexpected deliveries %+v", due)
+		}
+
+		store.SetMessageStatus(*pending.ID, "approved")
+
+		if due, _ := store.GetDueWebhookDeliveries(10); len(due) != 3 {
+			t.Errorf("got %d deliveries but wanted 3 after approval", len(due))
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("records attempts and retries failed deliveries", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		webhook, _ := store.CreateWebhook(&models.Webhook{URL: "https://example.com/hook", Secret: "s3cret"})
+		topic, _ := store.CreateTopic("Hooked")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first post", AuthorInitials: "JK", AuthorTheme: 1})
+
+		due, _ := store.GetDueWebhookDeliveries(10)
+		store.RecordWebhookAttempt(*due[0].ID, "failed", 500, "responded 500", 0)
+
+		if due, _ := store.GetDueWebhookDeliveries(10); len(due) != 0 {
+			t.Error("expected failed deliveries not to be due")
+		}
+
+		log, _ := store.GetWebhookDeliveries(10)
+
+		if len(log) != 1 || log[0].Status != "failed" || log[0].Attempts != 1 || log[0].ResponseCode != 500 {
+			t.Errorf("unexpected delivery log %+v", log)
+		}
+
+		store.RetryWebhookDelivery(*due[0].ID)
+
+		if due, _ := store.GetDueWebhookDeliveries(10); len(due) != 1 {
+			t.Error("expected retried delivery to be due")
+		}
+
+		store.DeleteWebhook(*webhook.ID)
+
+		if log, _ := store.GetWebhookDeliveries(10); len(log) != 0 {
+			t.Error("expected deliveries to be deleted with their webhook")
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestReactionsIntegration(t *testing.T) {
+	t.Run("toggles one reaction per reader and counts them", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Reactions")
+		message, _ := store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "first post", AuthorInitials: "JK", AuthorTheme: 1})
+
+		store.ToggleReaction(*message.ID, "abc", "👍")
+		store.ToggleReaction(*message.ID, "def", "👍")
+		store.ToggleReaction(*message.ID, "ghi", "🎉")
+		store.ToggleReaction(*message.ID, "ghi", "👍")
+
+		topic, _ = store.GetTopic(*topic.ID, Viewer{ReaderKey: "abc"})
+		reactions := (*topic.Messages)[0].Reactions
+
+		if len(reactions) != 1 || reactions[0].Count != 3 || !reactions[0].Reacted {
+			t.Errorf("unexpected reactions %+v", reactions)
+		}
+
+		store.ToggleReaction(*message.ID, "abc", "👍")
+		got, _ := store.GetReactions([]int{*message.ID}, "abc")
+
+		if r := got[*message.ID]; len(r) != 1 || r[0].Count != 2 || r[0].Reacted {
+			t.Errorf("unexpected reactions %+v after removing one", r)
+		}
+
+		store.EraseMessagesByAuthorKey("def", true)
+		got, _ = store.GetReactions([]int{*message.ID}, "")
+
+		if r := got[*message.ID]; len(r) != 1 || r[0].Count != 1 {
+			t.Errorf("expected erasing a reader's data to remove their reactions, got %+v", r)
+		}
+
+		testTeardown(th)
+	})
+}
+
+func TestPollsIntegration(t *testing.T) {
+	t.Run("records one ballot per voter and stops votes once closed", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		topic, _ := store.CreateTopic("Polls")
+		store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "vote!", AuthorInitials: "JK", AuthorTheme: 1})
+		poll, _ := store.CreatePoll(&models.Poll{TopicID: topic.ID, Question: "Best bird?", AuthorKey: "abc", Options: []models.PollOption{{Label: "Heron"}, {Label: "Wren"}}})
+		heron, wren := *poll.Options[0].ID, *poll.Options[1].ID
+
+		store.Vote(*poll.ID, "abc", []int{heron})
+		store.Vote(*poll.ID, "def", []int{heron})
+		store.Vote(*poll.ID, "abc", []int{wren})
+
+		got, _ := store.GetPoll(*topic.ID, Viewer{ReaderKey: "abc"})
+
+		if got.Voters != 2 || got.Options[0].Votes != 1 || got.Options[1].Percent != 50 || !got.Options[1].Chosen || !got.Voted {
+			t.Errorf("unexpected poll %+v", got)
+		}
+
+		store.SetPollClosed(*poll.ID, true)
+
+		if err := store.Vote(*poll.ID, "ghi", []int{heron}); err != ErrPollClosed {
+			t.Errorf("got error %v voting in a closed poll but wanted ErrPollClosed", err)
+		}
+
+		testTeardown(th)
+	})
+
+	t.Run("closes polls at their close time whatever its timezone", func(t *testing.T) {
+		th := testSetup()
+		store := New(th.DB)
+		zone := time.FixedZone("UTC+10", 10*60*60)
+		now := time.Now().Truncate(time.Second).In(zone)
+		soon, past := now.Add(time.Hour), now.Add(-time.Hour)
+
+		for closes, closed := range map[*time.Time]bool{&soon: false, &past: true} {
+			topic, _ := store.CreateTopic("Polls")
+			store.CreateMessage(&models.Message{TopicID: topic.ID, Content: "vote!", AuthorInitials: "JK", AuthorTheme: 1})
+			store.CreatePoll(&models.Poll{TopicID: topic.ID, Question: "Best bird?", Closes: closes, Options: []models.PollOption{{Label: "Heron"}, {Label: "Wren"}}})
+
+			if got, _ := store.GetPoll(*topic.ID, Viewer{}); got.Closed != closed || !got.Closes.Equal(*closes) {
+				t.Errorf("got poll closing %s closed %v but wanted %s closed %v", got.Closes, got.Closed, closes, closed)
+			}
+		}
+
+		testTeardown(th)
+	})
+}
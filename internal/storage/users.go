@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+var (
+	// ErrHandleTaken is returned when registering a handle already in use,
+	// handles are compared case-insensitively
+	ErrHandleTaken = errors.New("handle already taken")
+	// ErrUserNotFound is returned when no account matches a lookup
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// CreateUser inserts an account into the DB with the given password hash,
+// setting its ID. Returns ErrHandleTaken if the handle is in use.
+func (s *Storage) CreateUser(u *models.User, passwordHash string) (*models.User, error) {
+	id := 0
+	query := `
+		INSERT INTO users (handle, password_hash, initials, theme)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ((lower(handle))) DO NOTHING
+		RETURNING id`
+	err := s.db.QueryRow(query, u.Handle, passwordHash, u.Initials, u.Theme).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrHandleTaken
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	u.ID = &id
+
+	return u, nil
+}
+
+// GetUser retrieves an account by ID, returning ErrUserNotFound if it doesn't exist
+func (s *Storage) GetUser(id int) (*models.User, error) {
+	u := models.User{ID: &id}
+	query := `SELECT handle, initials, theme FROM users WHERE id = $1`
+	err := s.db.QueryRow(query, id).Scan(&u.Handle, &u.Initials, &u.Theme)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// GetUserCredentials retrieves an account and its password hash by handle,
+// returning ErrUserNotFound if no account has the handle. Accounts signing
+// in through an identity provider have an empty password hash.
+func (s *Storage) GetUserCredentials(handle string) (*models.User, string, error) {
+	id := 0
+	u := models.User{}
+	passwordHash := ""
+	query := `SELECT id, handle, initials, theme, COALESCE(password_hash, '') FROM users WHERE lower(handle) = lower($1)`
+	err := s.db.QueryRow(query, handle).Scan(&id, &u.Handle, &u.Initials, &u.Theme, &passwordHash)
+
+	if err == sql.ErrNoRows {
+		return nil, "", ErrUserNotFound
+	}
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, "", err
+	}
+
+	u.ID = &id
+
+	return &u, passwordHash, nil
+}
+
+// GetOrCreateExternalUser retrieves the account linked to an identity
+// provider's externalID, creating one from u if there isn't one yet. If u's
+// handle is taken, a numeric suffix is added to it.
+func (s *Storage) GetOrCreateExternalUser(externalID string, u *models.User) (*models.User, error) {
+	handle := u.Handle
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		existing := models.User{}
+		id := 0
+		query := `SELECT id, handle, initials, theme FROM users WHERE external_id = $1`
+		err := s.db.QueryRow(query, externalID).Scan(&id, &existing.Handle, &existing.Initials, &existing.Theme)
+
+		if err == nil {
+			existing.ID = &id
+			return &existing, nil
+		}
+
+		if err != sql.ErrNoRows {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		if attempt > 1 {
+			suffix := fmt.Sprintf("%d", attempt)
+			if len(handle)+len(suffix) > 20 {
+				handle = handle[:20-len(suffix)]
+			}
+			u.Handle = handle + suffix
+		}
+
+		query = `
+			INSERT INTO users (handle, initials, theme, external_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+			RETURNING id`
+		err = s.db.QueryRow(query, u.Handle, u.Initials, u.Theme, externalID).Scan(&id)
+
+		if err == nil {
+			u.ID = &id
+			return u, nil
+		}
+
+		// A conflict means the handle is taken, or the account was created by
+		// a concurrent sign in, which the next attempt picks up
+		if err != sql.ErrNoRows {
+			log.Print(err.Error())
+			return nil, err
+		}
+	}
+
+	return nil, ErrHandleTaken
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+// CreateWebhook inserts a webhook into the DB, setting its ID
+func (s *Storage) CreateWebhook(w *models.Webhook) (*models.Webhook, error) {
+	id := 0
+	query := `INSERT INTO webhooks (url, secret) VALUES ($1, $2) RETURNING id, created`
+
+	if err := s.db.QueryRow(query, w.URL, w.Secret).Scan(&id, &w.Created); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	w.ID = &id
+
+	return w, nil
+}
+
+// GetWebhooks returns every webhook, oldest first
+func (s *Storage) GetWebhooks() ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	rows, err := s.db.Query(`SELECT id, url, secret, created FROM webhooks ORDER BY id ASC`)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		w := models.Webhook{ID: &id}
+
+		if err = rows.Scan(&id, &w.URL, &w.Secret, &w.Created); err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook along with its deliveries
+func (s *Storage) DeleteWebhook(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// deliveryColumns are the columns scanned by scanDelivery
+const deliveryColumns = `
+	webhook_deliveries.id, webhook_deliveries.event, webhook_deliveries.status, webhook_deliveries.attempts,
+	webhook_deliveries.next_attempt, webhook_deliveries.response_code, webhook_deliveries.error,
+	webhook_deliveries.created, webhook_deliveries.updated,
+	webhooks.id, webhooks.url, webhooks.secret,
+	messages.id, messages.topic_id, topics.title, messages.content, messages.author_initials,
+	messages.author_theme, messages.author_tripcode, messages.posted`
+
+// deliveryJoins joins deliveries to their webhook, message, and topic
+const deliveryJoins = `
+	FROM webhook_deliveries
+	INNER JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+	INNER JOIN messages ON messages.id = webhook_deliveries.message_id
+	INNER JOIN topics ON topics.id = messages.topic_id`
+
+// scanDelivery scans a row of deliveryColumns. Message content is left as
+// the author wrote it.
+func scanDelivery(rows *sql.Rows) (models.WebhookDelivery, error) {
+	var id, webhookID, messageID, topicID int
+	d := models.WebhookDelivery{ID: &id, Webhook: &models.Webhook{ID: &webhookID}, Message: &models.Message{ID: &messageID, TopicID: &topicID}}
+
+	err := rows.Scan(&id, &d.Event, &d.Status, &d.Attempts, &d.NextAttempt, &d.ResponseCode, &d.Error, &d.Created, &d.Updated,
+		&webhookID, &d.Webhook.URL, &d.Webhook.Secret,
+		&messageID, &topicID, &d.Message.TopicTitle, &d.Message.Content, &d.Message.AuthorInitials,
+		&d.Message.AuthorTheme, &d.Message.AuthorTripcode, &d.Message.Posted)
+
+	return d, err
+}
+
+// queryDeliveries returns the deliveries matched by a query selecting deliveryColumns
+func (s *Storage) queryDeliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	rows, err := s.db.Query(query, args...)
+
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+
+		if err != nil {
+			log.Print(err.Error())
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhookDeliveries returns the most recently updated deliveries, for the delivery log
+func (s *Storage) GetWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + deliveryJoins + `
+		ORDER BY webhook_deliveries.updated DESC, webhook_deliveries.id DESC
+		LIMIT $1`
+
+	return s.queryDeliveries(query, limit)
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is
+// due, oldest first
+func (s *Storage) GetDueWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + deliveryJoins + `
+		WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt <= NOW()
+		ORDER BY webhook_deliveries.next_attempt ASC, webhook_deliveries.id ASC
+		LIMIT $1`
+
+	return s.queryDeliveries(query, limit)
+}
+
+// RecordWebhookAttempt records an attempt to deliver, setting the
+// delivery's status and, if it's still pending, when to try again
+func (s *Storage) RecordWebhookAttempt(id int, status string, responseCode int, errMessage string, retryIn time.Duration) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, response_code = $3, error = $4, attempts = attempts + 1,
+			next_attempt = NOW() + $5 * interval '1 millisecond', updated = NOW()
+		WHERE id = $1`
+
+	if _, err := s.db.Exec(query, id, status, responseCode, errMessage, retryIn.Milliseconds()); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RetryWebhookDelivery queues a delivery to be attempted again right away
+func (s *Storage) RetryWebhookDelivery(id int) error {
+	query := `
+		UPDATE webhook_deliveries SET status = 'pending', next_attempt = NOW(), updated = NOW()
+		WHERE id = $1 AND status <> 'pending'`
+
+	if _, err := s.db.Exec(query, id); err != nil {
+		log.Print(err.Error())
+		return err
+	}
+
+	return nil
+}
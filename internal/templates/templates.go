@@ -3,12 +3,20 @@ package templates
 import (
 	"html/template"
 	"log"
+	"strings"
+	texttemplate "text/template"
 )
 
+// csrfField renders a hidden form input carrying a CSRF token
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="csrf_token" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
 // GenerateTemplates generates and returns templates instance
 func GenerateTemplates(templatesGlob string) (*template.Template, error) {
 	funcMap := template.FuncMap{
-		"noescape": func(str string) template.HTML { return template.HTML(str) },
+		"noescape":  func(str string) template.HTML { return template.HTML(str) },
+		"csrfField": csrfField,
 	}
 
 	templates, err := template.New("").Funcs(funcMap).ParseGlob(templatesGlob)
@@ -21,3 +29,25 @@ func GenerateTemplates(templatesGlob string) (*template.Template, error) {
 
 	return templates, nil
 }
+
+// GenerateEmailTemplates generates and returns plain text email templates
+func GenerateEmailTemplates(templatesGlob string) (*texttemplate.Template, error) {
+	funcMap := texttemplate.FuncMap{
+		"indent": indent,
+	}
+
+	templates, err := texttemplate.New("").Funcs(funcMap).ParseGlob(templatesGlob)
+
+	if err != nil {
+		log.Print("Error generating email templates:")
+		log.Print(err)
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// indent prefixes every line of s with prefix, for quoting messages in email
+func indent(prefix string, s string) string {
+	return prefix + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+prefix)
+}
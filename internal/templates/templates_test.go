@@ -13,3 +13,45 @@ func TestGenerateTemplates(t *testing.T) {
 		}
 	})
 }
+
+func TestGenerateEmailTemplates(t *testing.T) {
+	t.Run("parses the email templates", func(t *testing.T) {
+		emails, err := GenerateEmailTemplates("../../web/emails/*.tmpl")
+
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		for _, name := range []string{"digest", "digest-confirm"} {
+			if emails.Lookup(name) == nil {
+				t.Errorf("missing email template %q", name)
+			}
+		}
+	})
+
+	t.Run("returns error if generating templates fails", func(t *testing.T) {
+		if _, err := GenerateEmailTemplates(""); err == nil {
+			t.Error("expected for error to be returned from template generator")
+		}
+	})
+}
+
+func TestIndent(t *testing.T) {
+	got := indent("> ", "first\nsecond\n")
+	want := "> first\n> second"
+
+	if got != want {
+		t.Errorf("got %q but wanted %q", got, want)
+	}
+}
+
+func TestCSRFField(t *testing.T) {
+	t.Run("renders an escaped hidden input", func(t *testing.T) {
+		got := string(csrfField(`a"b`))
+		want := `<input type="hidden" name="csrf_token" value="a&#34;b">`
+
+		if got != want {
+			t.Errorf("got %s but wanted %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,232 @@
+// Package webhook posts new topics and messages to webhooks, signing each
+// payload so receivers can check it came from Topical
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+const (
+	// maxAttempts is how many times a delivery is tried before it fails
+	maxAttempts = 6
+	// baseBackoff is how long to wait after the first failed attempt,
+	// doubling after each attempt after that
+	baseBackoff = time.Minute
+	// batchSize is how many due deliveries are attempted at a time
+	batchSize = 50
+	// maxErrorLength is how much of a failed response is kept in the delivery log
+	maxErrorLength = 200
+)
+
+// SignatureHeader carries the payload's signature, "sha256=" followed by
+// the hex HMAC-SHA256 of the request body keyed with the webhook's secret
+const SignatureHeader = "X-Topical-Signature"
+
+// Store is the storage the Worker reads and records deliveries in
+type Store interface {
+	GetDueWebhookDeliveries(limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(id int, status string, responseCode int, errMessage string, retryIn time.Duration) error
+}
+
+// Worker delivers pending webhook deliveries in the background, with
+// permalinks in payloads pointing at baseURL
+type Worker struct {
+	store   Store
+	client  *http.Client
+	baseURL string
+}
+
+// payload is the JSON body posted to webhooks
+type payload struct {
+	Event      string         `json:"event"`
+	DeliveryID int            `json:"delivery_id"`
+	Topic      payloadTopic   `json:"topic"`
+	Message    payloadMessage `json:"message"`
+	Author     payloadAuthor  `json:"author"`
+}
+
+type payloadTopic struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type payloadMessage struct {
+	ID        int       `json:"id"`
+	Content   string    `json:"content"`
+	Posted    time.Time `json:"posted"`
+	Permalink string    `json:"permalink"`
+}
+
+type payloadAuthor struct {
+	Initials   string `json:"initials"`
+	Theme      int    `json:"theme"`
+	Tripcode   string `json:"tripcode,omitempty"`
+	ProfileURL string `json:"profile_url"`
+}
+
+// New returns a Worker, client may be nil to use a client with a 10 second timeout
+func New(store Store, client *http.Client, baseURL string) *Worker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Worker{store, client, strings.TrimRight(baseURL, "/")}
+}
+
+// NewSecret returns a random secret to sign a webhook's payloads with
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the SignatureHeader value for a body signed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start delivers due deliveries every interval until the returned stop function is called
+func (w *Worker) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w.DeliverDue()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// DeliverDue attempts every due delivery once, returning how many succeeded
+func (w *Worker) DeliverDue() int {
+	deliveries, err := w.store.GetDueWebhookDeliveries(batchSize)
+
+	if err != nil {
+		log.Print("Error getting webhook deliveries: ", err.Error())
+		return 0
+	}
+
+	delivered := 0
+
+	for _, d := range deliveries {
+		code, err := w.deliver(d)
+		status, retryIn, message := "delivered", time.Duration(0), ""
+
+		if err != nil {
+			status, retryIn, message = "pending", backoff(d.Attempts+1), err.Error()
+
+			if d.Attempts+1 >= maxAttempts {
+				status = "failed"
+			}
+
+			log.Printf("Error delivering webhook %d to %s: %s", *d.ID, d.Webhook.URL, message)
+		} else {
+			delivered++
+		}
+
+		if err := w.store.RecordWebhookAttempt(*d.ID, status, code, message, retryIn); err != nil {
+			log.Print("Error recording webhook attempt: ", err.Error())
+		}
+	}
+
+	return delivered
+}
+
+// deliver posts a delivery's payload to its webhook, returning the
+// response code and an error unless the webhook responded with a 2xx
+func (w *Worker) deliver(d models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(w.payload(d))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.Webhook.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Topical-Webhook")
+	req.Header.Set("X-Topical-Event", d.Event)
+	req.Header.Set("X-Topical-Delivery", strconv.Itoa(*d.ID))
+	req.Header.Set(SignatureHeader, Sign(d.Webhook.Secret, body))
+
+	res, err := w.client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return res.StatusCode, fmt.Errorf("responded %s: %s", res.Status, strings.TrimSpace(string(excerpt)))
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+
+	return res.StatusCode, nil
+}
+
+func (w *Worker) payload(d models.WebhookDelivery) payload {
+	m := d.Message
+	topicURL := fmt.Sprintf("%s/topics/%d", w.baseURL, *m.TopicID)
+
+	return payload{
+		Event:      d.Event,
+		DeliveryID: *d.ID,
+		Topic:      payloadTopic{ID: *m.TopicID, Title: m.TopicTitle, URL: topicURL},
+		Message: payloadMessage{
+			ID:        *m.ID,
+			Content:   m.Content,
+			Posted:    m.Posted,
+			Permalink: fmt.Sprintf("%s#message-%d", topicURL, *m.ID),
+		},
+		Author: payloadAuthor{
+			Initials:   m.AuthorInitials,
+			Theme:      m.AuthorTheme,
+			Tripcode:   m.AuthorTripcode,
+			ProfileURL: fmt.Sprintf("%s/u/%s-%d", w.baseURL, m.AuthorInitials, m.AuthorTheme),
+		},
+	}
+}
+
+// backoff returns how long to wait after a delivery's attempt-th failed attempt
+func backoff(attempt int) time.Duration {
+	return baseBackoff << uint(attempt-1)
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jkulton/topical/internal/models"
+)
+
+type attempt struct {
+	id           int
+	status       string
+	responseCode int
+	errMessage   string
+	retryIn      time.Duration
+}
+
+type fakeStore struct {
+	due      []models.WebhookDelivery
+	attempts []attempt
+}
+
+func (s *fakeStore) GetDueWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	return s.due, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(id int, status string, responseCode int, errMessage string, retryIn time.Duration) error {
+	s.attempts = append(s.attempts, attempt{id, status, responseCode, errMessage, retryIn})
+	return nil
+}
+
+func newDelivery(id int, url string, attempts int) models.WebhookDelivery {
+	webhookID, messageID, topicID := 1, 12, 4
+
+	return models.WebhookDelivery{
+		ID:       &id,
+		Event:    "topic.created",
+		Attempts: attempts,
+		Webhook:  &models.Webhook{ID: &webhookID, URL: url, Secret: "secret"},
+		Message: &models.Message{
+			ID:             &messageID,
+			TopicID:        &topicID,
+			TopicTitle:     "Gardening",
+			Content:        "Hello **there**",
+			AuthorInitials: "JK",
+			AuthorTheme:    3,
+			AuthorTripcode: "TRIP",
+			Posted:         time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	t.Run("posts signed payloads to webhooks", func(t *testing.T) {
+		var got map[string]interface{}
+		var headers http.Header
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			headers = r.Header
+
+			if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+				t.Error("expected a valid signature")
+			}
+
+			json.Unmarshal(body, &got)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer receiver.Close()
+
+		store := &fakeStore{due: []models.WebhookDelivery{newDelivery(7, receiver.URL, 0)}}
+
+		if delivered := New(store, nil, "https://topical.example.com/").DeliverDue(); delivered != 1 {
+			t.Errorf("got %d delivered but wanted 1", delivered)
+		}
+
+		if headers.Get("X-Topical-Event") != "topic.created" || headers.Get("X-Topical-Delivery") != "7" || headers.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected headers %v", headers)
+		}
+
+		topic := got["topic"].(map[string]interface{})
+		message := got["message"].(map[string]interface{})
+		author := got["author"].(map[string]interface{})
+
+		if got["event"] != "topic.created" || topic["title"] != "Gardening" || topic["url"] != "https://topical.example.com/topics/4" {
+			t.Errorf("unexpected payload %v", got)
+		}
+
+		if message["content"] != "Hello **there**" || message["permalink"] != "https://topical.example.com/topics/4#message-12" {
+			t.Errorf("unexpected message %v", message)
+		}
+
+		if author["initials"] != "JK" || author["tripcode"] != "TRIP" || author["profile_url"] != "https://topical.example.com/u/JK-3" {
+			t.Errorf("unexpected author %v", author)
+		}
+
+		want := attempt{7, "delivered", http.StatusNoContent, "", 0}
+
+		if len(store.attempts) != 1 || store.attempts[0] != want {
+			t.Errorf("got attempts %+v but wanted %+v", store.attempts, want)
+		}
+	})
+
+	t.Run("retries failed deliveries with backoff", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		}))
+		defer receiver.Close()
+
+		store := &fakeStore{due: []models.WebhookDelivery{newDelivery(7, receiver.URL, 2)}}
+
+		if delivered := New(store, nil, "").DeliverDue(); delivered != 0 {
+			t.Errorf("got %d delivered but wanted 0", delivered)
+		}
+
+		got := store.attempts[0]
+
+		if got.status != "pending" || got.responseCode != http.StatusServiceUnavailable || got.retryIn != 4*time.Minute {
+			t.Errorf("unexpected attempt %+v", got)
+		}
+
+		if got.errMessage != "responded 503 Service Unavailable: down for maintenance" {
+			t.Errorf("got error %q", got.errMessage)
+		}
+	})
+
+	t.Run("fails deliveries out of attempts", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		receiver.Close()
+
+		store := &fakeStore{due: []models.WebhookDelivery{newDelivery(7, receiver.URL, maxAttempts-1)}}
+		New(store, nil, "").DeliverDue()
+
+		if got := store.attempts[0]; got.status != "failed" || got.responseCode != 0 || got.errMessage == "" {
+			t.Errorf("unexpected attempt %+v", got)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 5: 16 * time.Minute} {
+		if got := backoff(attempt); got != want {
+			t.Errorf("got backoff %s after attempt %d but wanted %s", got, attempt, want)
+		}
+	}
+}
@@ -10,4 +10,161 @@ CREATE TABLE IF NOT EXISTS messages (
   author_initials char(2) NOT NULL CHECK (author_initials ~ '^[A-Z]{2}$'),
   author_theme integer NOT NULL,
   posted timestamp NOT NULL DEFAULT NOW()
-);
\ No newline at end of file
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS hidden boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS reports (
+  id serial PRIMARY KEY,
+  message_id integer REFERENCES messages (id) NOT NULL,
+  reason text NOT NULL CHECK (reason IN ('spam', 'harassment', 'off-topic', 'other')),
+  details text NOT NULL DEFAULT '',
+  session_id text NOT NULL,
+  status text NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+  created timestamp NOT NULL DEFAULT NOW(),
+  UNIQUE (message_id, session_id)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'approved' CHECK (status IN ('pending', 'approved', 'rejected'));
+
+CREATE TABLE IF NOT EXISTS users (
+  id serial PRIMARY KEY,
+  handle text NOT NULL CHECK (handle ~ '^[A-Za-z0-9_]{3,20}$'),
+  password_hash text NOT NULL,
+  initials char(2) NOT NULL CHECK (initials ~ '^[A-Z]{2}$'),
+  theme integer NOT NULL,
+  created timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_handle_idx ON users (lower(handle));
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS user_id integer REFERENCES users (id);
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id text UNIQUE;
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id text PRIMARY KEY,
+  data bytea NOT NULL,
+  user_id integer REFERENCES users (id) ON DELETE CASCADE,
+  created timestamp NOT NULL,
+  last_seen timestamp NOT NULL,
+  expires timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_idx ON sessions (expires);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS author_tripcode text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS messages_author_idx ON messages (author_initials, author_theme, posted DESC);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS author_key text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS messages_author_key_idx ON messages (author_key);
+
+CREATE TABLE IF NOT EXISTS reads (
+  reader_key text NOT NULL,
+  topic_id integer REFERENCES topics (id) ON DELETE CASCADE NOT NULL,
+  last_read_message_id integer NOT NULL,
+  updated timestamp NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (reader_key, topic_id)
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+  subscriber_key text NOT NULL,
+  topic_id integer REFERENCES topics (id) ON DELETE CASCADE NOT NULL,
+  created timestamp NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (subscriber_key, topic_id)
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_topic_id_idx ON subscriptions (topic_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id serial PRIMARY KEY,
+  recipient_key text NOT NULL,
+  message_id integer REFERENCES messages (id) ON DELETE CASCADE NOT NULL,
+  read boolean NOT NULL DEFAULT false,
+  created timestamp NOT NULL DEFAULT NOW(),
+  UNIQUE (recipient_key, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_recipient_idx ON notifications (recipient_key, created DESC);
+
+CREATE TABLE IF NOT EXISTS mentions (
+  message_id integer REFERENCES messages (id) ON DELETE CASCADE NOT NULL,
+  initials char(2) NOT NULL CHECK (initials ~ '^[A-Z]{2}$'),
+  theme integer NOT NULL DEFAULT 0,
+  PRIMARY KEY (message_id, initials, theme)
+);
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'reply' CHECK (kind IN ('reply', 'mention'));
+
+CREATE TABLE IF NOT EXISTS digests (
+  recipient_key text PRIMARY KEY,
+  email text NOT NULL,
+  frequency text NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+  confirmed boolean NOT NULL DEFAULT false,
+  last_sent timestamp NOT NULL DEFAULT NOW(),
+  created timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id serial PRIMARY KEY,
+  url text NOT NULL,
+  secret text NOT NULL,
+  created timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id serial PRIMARY KEY,
+  webhook_id integer REFERENCES webhooks (id) ON DELETE CASCADE NOT NULL,
+  message_id integer REFERENCES messages (id) ON DELETE CASCADE NOT NULL,
+  event text NOT NULL CHECK (event IN ('topic.created', 'message.created')),
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt timestamp NOT NULL DEFAULT NOW(),
+  response_code integer NOT NULL DEFAULT 0,
+  error text NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT NOW(),
+  updated timestamp NOT NULL DEFAULT NOW(),
+  UNIQUE (webhook_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_to_message_id integer REFERENCES messages (id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS message_reactions (
+  message_id integer REFERENCES messages (id) ON DELETE CASCADE NOT NULL,
+  reactor_key text NOT NULL,
+  emoji text NOT NULL,
+  created timestamp NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (message_id, reactor_key)
+);
+
+CREATE TABLE IF NOT EXISTS polls (
+  id serial PRIMARY KEY,
+  topic_id integer REFERENCES topics (id) ON DELETE CASCADE NOT NULL UNIQUE,
+  question text NOT NULL,
+  multiple boolean NOT NULL DEFAULT false,
+  closes timestamptz,
+  closed boolean NOT NULL DEFAULT false,
+  author_key text NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+  id serial PRIMARY KEY,
+  poll_id integer REFERENCES polls (id) ON DELETE CASCADE NOT NULL,
+  position integer NOT NULL,
+  label text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+  poll_id integer REFERENCES polls (id) ON DELETE CASCADE NOT NULL,
+  option_id integer REFERENCES poll_options (id) ON DELETE CASCADE NOT NULL,
+  voter_key text NOT NULL,
+  created timestamp NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (option_id, voter_key)
+);
+
+CREATE INDEX IF NOT EXISTS poll_votes_voter_idx ON poll_votes (poll_id, voter_key);
+
+CREATE INDEX IF NOT EXISTS messages_author_key_status_idx ON messages (author_key, status);
+
+ALTER TABLE digests ADD COLUMN IF NOT EXISTS confirmation_sent timestamptz;
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/jkulton/topical/internal/config"
 	_ "github.com/lib/pq" // Postgres driver
 	"log"
@@ -17,16 +18,13 @@ func main() {
 
 	defer db.Close()
 
-	_, err = db.Exec(`DROP TABLE messages`)
+	// Tables are dropped in dependency order, referencing tables first
+	for _, table := range []string{"poll_votes", "poll_options", "polls", "message_reactions", "webhook_deliveries", "webhooks", "digests", "mentions", "notifications", "subscriptions", "reads", "reports", "messages", "sessions", "users", "topics"} {
+		_, err = db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table))
 
-	if err != nil {
-		panic(err)
-	}
-
-	_, err = db.Exec(`DROP TABLE topics`)
-
-	if err != nil {
-		panic(err)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 }
@@ -0,0 +1,55 @@
+// Solves the proof-of-work challenge on protected forms before they submit:
+// finds a counter such that sha256(challenge + ":" + counter) starts with
+// the required number of zero bits. Needs a secure context (HTTPS or localhost).
+(function () {
+  function leadingZeroBits(bytes) {
+    var zeros = 0;
+
+    for (var i = 0; i < bytes.length; i++) {
+      if (bytes[i] === 0) {
+        zeros += 8;
+        continue;
+      }
+
+      return zeros + Math.clz32(bytes[i]) - 24;
+    }
+
+    return zeros;
+  }
+
+  async function solve(token, difficulty) {
+    var encoder = new TextEncoder();
+
+    for (var i = 0; ; i++) {
+      var digest = await crypto.subtle.digest("SHA-256", encoder.encode(token + ":" + i));
+
+      if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+        return String(i);
+      }
+    }
+  }
+
+  document.querySelectorAll("input[name=challenge]").forEach(function (input) {
+    var form = input.form;
+    var solution = form.querySelector("input[name=challenge_solution]");
+    var button = form.querySelector("button[type=submit]");
+
+    form.addEventListener("submit", function (event) {
+      if (solution.value !== "") {
+        return;
+      }
+
+      event.preventDefault();
+
+      if (button) {
+        button.disabled = true;
+        button.textContent = "Checking…";
+      }
+
+      solve(input.value, parseInt(input.dataset.difficulty, 10)).then(function (value) {
+        solution.value = value;
+        form.submit();
+      });
+    });
+  });
+})();
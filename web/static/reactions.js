@@ -0,0 +1,82 @@
+// Toggles reactions without reloading the page: reaction forms are sent with
+// fetch, asking for JSON, and the message's reactions are redrawn from the
+// response. Forms submit as usual if the request fails.
+(function () {
+  function reactionForm(action, token, reaction) {
+    var form = document.createElement("form");
+    form.className = "reaction-form reaction-count";
+    form.method = "post";
+    form.action = action;
+
+    var csrf = document.createElement("input");
+    csrf.type = "hidden";
+    csrf.name = "csrf_token";
+    csrf.value = token;
+
+    var button = document.createElement("button");
+    button.type = "submit";
+    button.name = "emoji";
+    button.value = reaction.emoji;
+    button.className = reaction.reacted ? "reaction reaction-reacted" : "reaction";
+    button.textContent = reaction.emoji + " " + reaction.count;
+
+    form.append(csrf, button);
+    return form;
+  }
+
+  function render(container, form, reactions) {
+    var action = form.action;
+    var token = form.querySelector("input[name=csrf_token]").value;
+    var picker = container.querySelector(".reaction-picker");
+
+    container.querySelectorAll(".reaction-count").forEach(function (node) {
+      node.remove();
+    });
+
+    reactions.forEach(function (reaction) {
+      container.insertBefore(reactionForm(action, token, reaction), picker);
+    });
+
+    if (picker) {
+      picker.open = false;
+    }
+  }
+
+  document.addEventListener("submit", function (event) {
+    var form = event.target;
+
+    if (!form.classList.contains("reaction-form") || form.dataset.fallback) {
+      return;
+    }
+
+    event.preventDefault();
+
+    var submitter = event.submitter;
+    var data = new URLSearchParams(new FormData(form));
+
+    if (submitter && submitter.name) {
+      data.append(submitter.name, submitter.value);
+    }
+
+    fetch(form.action, {
+      method: "POST",
+      body: data,
+      credentials: "same-origin",
+      headers: { Accept: "application/json" },
+    })
+      .then(function (response) {
+        if (!response.ok) {
+          throw new Error(response.statusText);
+        }
+
+        return response.json();
+      })
+      .then(function (body) {
+        render(form.closest(".reactions"), form, body.reactions);
+      })
+      .catch(function () {
+        form.dataset.fallback = "true";
+        form.requestSubmit(submitter);
+      });
+  });
+})();